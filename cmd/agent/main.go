@@ -2,14 +2,22 @@ package main
 
 import (
 	"context"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/mohammadhptp/pulse/internal/agent"
+	"github.com/mohammadhptp/pulse/internal/agent/parser"
+	"github.com/mohammadhptp/pulse/internal/agent/pipeline"
+	"github.com/mohammadhptp/pulse/internal/storage"
+	"github.com/mohammadhptp/pulse/pkg/health"
 	"github.com/mohammadhptp/pulse/pkg/logger"
+	"github.com/mohammadhptp/pulse/pkg/metrics"
 	"github.com/mohammadhptp/pulse/pkg/transport"
+	"github.com/mohammadhptp/pulse/pkg/ui"
 	"github.com/segmentio/kafka-go"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
@@ -50,9 +58,10 @@ func main() {
 		logger.Fatal("HTTP_ENDPOINT is not set")
 	}
 
+	// The topic is set per message, as the pipeline may route events to
+	// other topics.
 	writer := kafka.NewWriter(kafka.WriterConfig{
 		Brokers:      []string{broker},
-		Topic:        topic,
 		Balancer:     &kafka.LeastBytes{},
 		BatchTimeout: 10 * time.Millisecond,
 	})
@@ -64,23 +73,196 @@ func main() {
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
 
+	checks := health.New()
+
 	go func() {
 		sig := <-signals
 		logger.Info("Shutdown signal received", zap.String("signal", sig.String()))
+
+		// Report not ready while draining, so that load balancers stop
+		// sending events before the transports close.
+		checks.SetDraining()
+		if delay := viper.GetDuration("SHUTDOWN_DRAIN_DELAY"); delay > 0 {
+			logger.Info("Draining before shutdown", zap.Duration("delay", delay))
+			time.Sleep(delay)
+		}
 		cancel()
 	}()
 
+	storage.SetLimits(storage.Limits{
+		DefaultRange:         viper.GetDuration("QUERY_DEFAULT_RANGE"),
+		MaxRange:             viper.GetDuration("QUERY_MAX_RANGE"),
+		MaxExecutionTime:     viper.GetDuration("QUERY_MAX_EXECUTION_TIME"),
+		MaxRowsToRead:        viper.GetUint64("QUERY_MAX_ROWS_TO_READ"),
+		LongMaxExecutionTime: viper.GetDuration("LONG_QUERY_MAX_EXECUTION_TIME"),
+		LongMaxRowsToRead:    viper.GetUint64("LONG_QUERY_MAX_ROWS_TO_READ"),
+		MaxPerPage:           viper.GetInt("QUERY_MAX_PER_PAGE"),
+	})
+
 	httpTransport := transport.NewHTTPTransport(httpPort, httpEndpoint)
+	httpTransport.SetMaxExportRows(viper.GetInt("EXPORT_MAX_ROWS"))
+	httpTransport.SetJobResultTTL(viper.GetDuration("JOB_RESULT_TTL"))
+	httpTransport.SetMaxJobRows(viper.GetInt("JOB_MAX_ROWS"))
+	transports := []transport.EventProducer{httpTransport}
+
+	otlpPort := viper.GetInt("OTLP_HTTP_PORT")
+	if otlpPort != 0 {
+		transports = append(transports, transport.NewOTLPTransport(otlpPort))
+	}
+
+	grpcPort := viper.GetInt("GRPC_PORT")
+	if grpcPort != 0 {
+		transports = append(transports, transport.NewGRPCTransport(
+			grpcPort,
+			viper.GetInt("GRPC_MAX_RECV_MSG_SIZE"),
+			viper.GetDuration("GRPC_TIMEOUT")))
+	}
+
+	syslogConfig := transport.SyslogConfig{
+		UDPAddr:     viper.GetString("SYSLOG_UDP_ADDR"),
+		TCPAddr:     viper.GetString("SYSLOG_TCP_ADDR"),
+		TLSAddr:     viper.GetString("SYSLOG_TLS_ADDR"),
+		TLSCertFile: viper.GetString("SYSLOG_TLS_CERT_FILE"),
+		TLSKeyFile:  viper.GetString("SYSLOG_TLS_KEY_FILE"),
+	}
+	if syslogConfig.UDPAddr != "" || syslogConfig.TCPAddr != "" || syslogConfig.TLSAddr != "" {
+		if syslogConfig.TLSAddr != "" && (syslogConfig.TLSCertFile == "" || syslogConfig.TLSKeyFile == "") {
+			logger.Fatal("SYSLOG_TLS_CERT_FILE and SYSLOG_TLS_KEY_FILE are required when SYSLOG_TLS_ADDR is set")
+		}
+		transports = append(transports, transport.NewSyslogTransport(syslogConfig))
+	}
+
+	lokiPort := viper.GetInt("LOKI_PORT")
+	if lokiPort != 0 {
+		transports = append(transports, transport.NewLokiTransport(
+			lokiPort,
+			splitList(viper.GetString("LOKI_SERVICE_LABELS")),
+			splitList(viper.GetString("LOKI_HOST_LABELS"))))
+	}
+
+	esPort := viper.GetInt("ES_PORT")
+	if esPort != 0 {
+		transports = append(transports, transport.NewElasticsearchTransport(
+			esPort,
+			viper.GetString("ES_VERSION"),
+			transport.ElasticsearchFields{
+				Timestamp: viper.GetString("ES_TIMESTAMP_FIELD"),
+				Level:     viper.GetString("ES_LEVEL_FIELD"),
+				Service:   viper.GetString("ES_SERVICE_FIELD"),
+				Host:      viper.GetString("ES_HOST_FIELD"),
+				Message:   viper.GetString("ES_MESSAGE_FIELD"),
+			}))
+	}
+
+	hecPort := viper.GetInt("HEC_PORT")
+	if hecPort != 0 {
+		transports = append(transports, transport.NewSplunkTransport(
+			hecPort,
+			splitList(viper.GetString("HEC_TOKENS"))))
+	}
+
+	forwardPort := viper.GetInt("FORWARD_PORT")
+	if forwardPort != 0 {
+		transports = append(transports, transport.NewForwardTransport(
+			forwardPort,
+			viper.GetString("FORWARD_SHARED_KEY"),
+			viper.GetString("FORWARD_HOSTNAME")))
+	}
+
+	var config agent.Config
+	if configPath := viper.GetString("AGENT_CONFIG"); configPath != "" {
+		loaded, err := agent.LoadConfig(configPath)
+		if err != nil {
+			logger.Fatal("Failed to load agent config", zap.Error(err))
+		}
+		config = *loaded
+	}
+
+	if len(config.Files.Inputs) > 0 {
+		fileTransport, err := transport.NewFileTransport(
+			config.Files.Inputs,
+			config.Files.CheckpointPath,
+			config.Files.PollInterval)
+		if err != nil {
+			logger.Fatal("Invalid file input configuration", zap.Error(err))
+		}
+		transports = append(transports, fileTransport)
+	}
+
+	parsers, err := parser.New(config.Parsers)
+	if err != nil {
+		logger.Fatal("Invalid parser configuration", zap.Error(err))
+	}
+
+	processingPipeline, err := pipeline.New(config.Pipeline)
+	if err != nil {
+		logger.Fatal("Invalid pipeline configuration", zap.Error(err))
+	}
 
-	processor := agent.NewEventProcessor(writer, httpTransport)
+	processor := agent.NewEventProcessor(writer, topic, transports...)
+	processor.SetParsers(parsers)
+	processor.SetPipeline(processingPipeline)
+	processor.SetMaxPendingWrites(viper.GetInt("MAX_PENDING_WRITES"))
+
+	// The agent's own log entries run through the parsers and pipeline like
+	// any other event.
+	var selfLogs *logger.ForwardCore
+	if viper.GetBool("SELF_LOGS") {
+		service := viper.GetString("SELF_LOGS_SERVICE")
+		if service == "" {
+			service = "pulse-agent"
+		}
+		selfLogs = logger.NewForwardCore(service, logger.ParseLevel(viper.GetString("SELF_LOGS_LEVEL")), processor.Ingest, 0)
+		logger.Tee(selfLogs)
+	}
+
+	httpTransport.Handle("GET /pipeline/stats", http.HandlerFunc(processor.HandlePipelineStats))
+	httpTransport.Handle("POST /pipeline/dry-run", http.HandlerFunc(processor.HandlePipelineDryRun))
+	httpTransport.Handle("GET /metrics", metrics.Handler())
+	httpTransport.Handle("GET "+ui.Prefix, ui.Handler(httpEndpoint))
+
+	checks.Add("kafka", processor.CheckKafka)
+	checks.Add("clickhouse", httpTransport.CheckClickHouse)
+	checks.Add("producer", processor.CheckPendingWrites)
+	httpTransport.Handle("GET /healthz", http.HandlerFunc(checks.HandleLive))
+	httpTransport.Handle("GET /readyz", http.HandlerFunc(checks.HandleReady))
 
 	logger.Info("Agent started",
 		zap.String("broker", broker),
 		zap.String("topic", topic),
 		zap.Int("httpPort", httpPort),
-		zap.String("httpEndpoint", httpEndpoint))
+		zap.String("httpEndpoint", httpEndpoint),
+		zap.Int("otlpHttpPort", otlpPort),
+		zap.Int("grpcPort", grpcPort),
+		zap.String("syslogUdpAddr", syslogConfig.UDPAddr),
+		zap.String("syslogTcpAddr", syslogConfig.TCPAddr),
+		zap.String("syslogTlsAddr", syslogConfig.TLSAddr),
+		zap.Int("lokiPort", lokiPort),
+		zap.Int("esPort", esPort),
+		zap.Int("hecPort", hecPort),
+		zap.Int("forwardPort", forwardPort),
+		zap.Int("fileInputs", len(config.Files.Inputs)),
+		zap.Int("parsers", parsers.Len()),
+		zap.Int("processors", processingPipeline.Len()),
+		zap.Bool("selfLogs", selfLogs != nil))
 
 	if err := processor.Start(ctx); err != nil && err != context.Canceled {
 		logger.Fatal("Event processor error", zap.Error(err))
 	}
+
+	if selfLogs != nil {
+		selfLogs.Close()
+		logger.Info("Stopped forwarding own logs", zap.Uint64("dropped", selfLogs.Dropped()))
+	}
+}
+
+// splitList splits a comma separated configuration value, dropping empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
@@ -1,12 +1,18 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/mohammadhptp/pulse/internal/collector"
+	"github.com/mohammadhptp/pulse/pkg/health"
 	"github.com/mohammadhptp/pulse/pkg/logger"
+	"github.com/mohammadhptp/pulse/pkg/metrics"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
@@ -45,14 +51,77 @@ func main() {
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
 
+	metricsPort := viper.GetInt("METRICS_PORT")
+
 	logger.Info("Collector started",
 		zap.String("broker", viper.GetString("KAFKA_BROKER")),
 		zap.String("topic", viper.GetString("KAFKA_TOPIC")),
-		zap.String("clickhouse", viper.GetString("CLICKHOUSE_ADDR")))
+		zap.String("clickhouse", viper.GetString("CLICKHOUSE_ADDR")),
+		zap.Int("metricsPort", metricsPort))
+
+	// The collector's own log entries go through Kafka like any other event.
+	var selfLogs *logger.ForwardCore
+	if viper.GetBool("SELF_LOGS") {
+		sink, writer := collector.NewLogSink(viper.GetString("KAFKA_BROKER"), viper.GetString("KAFKA_TOPIC"))
+		defer writer.Close()
+
+		service := viper.GetString("SELF_LOGS_SERVICE")
+		if service == "" {
+			service = "pulse-collector"
+		}
+		selfLogs = logger.NewForwardCore(service, logger.ParseLevel(viper.GetString("SELF_LOGS_LEVEL")), sink, 0)
+		logger.Tee(selfLogs)
+	}
+
+	checks := health.New()
+
+	var server *http.Server
+	if metricsPort != 0 {
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", metrics.Handler())
+		mux.HandleFunc("GET /healthz", checks.HandleLive)
+		mux.HandleFunc("GET /readyz", checks.HandleReady)
+
+		server = &http.Server{Addr: fmt.Sprintf(":%d", metricsPort), Handler: mux}
+		go func() {
+			logger.Info("Serving metrics and health checks", zap.String("address", server.Addr))
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error("Metrics server error", zap.Error(err))
+			}
+		}()
+	}
 
-	go collector.Run()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		collector.Run(ctx, checks)
+		close(done)
+	}()
 
 	// Wait for shutdown signal
 	sig := <-signals
 	logger.Info("Shutdown signal received", zap.String("signal", sig.String()))
+
+	// Report not ready while draining, so that no new work is routed here.
+	checks.SetDraining()
+	if delay := viper.GetDuration("SHUTDOWN_DRAIN_DELAY"); delay > 0 {
+		logger.Info("Draining before shutdown", zap.Duration("delay", delay))
+		time.Sleep(delay)
+	}
+
+	cancel()
+	<-done
+
+	if selfLogs != nil {
+		selfLogs.Close()
+		logger.Info("Stopped forwarding own logs", zap.Uint64("dropped", selfLogs.Dropped()))
+	}
+
+	if server != nil {
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelShutdown()
+		server.Shutdown(shutdownCtx)
+	}
 }
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// api calls the agent HTTP API of a profile.
+type api struct {
+	endpoint string
+	apiKey   string
+	http     *http.Client
+}
+
+func newAPI(profile Profile) (*api, error) {
+	u, err := url.Parse(profile.Endpoint)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint %q", profile.Endpoint)
+	}
+	return &api{
+		endpoint: strings.TrimSuffix(profile.Endpoint, "/"),
+		apiKey:   profile.APIKey,
+		http:     &http.Client{},
+	}, nil
+}
+
+// url returns the URL of path below the events endpoint, such as /histogram.
+func (a *api) url(path string, query url.Values) string {
+	u := a.endpoint + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// open sends a GET request for path below the events endpoint and returns the
+// response, or an error for non 2xx responses.
+func (a *api) open(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.url(path, query), nil)
+	if err != nil {
+		return nil, err
+	}
+	a.authorize(req)
+
+	resp, err := a.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(message))
+	}
+	return resp, nil
+}
+
+// get decodes the JSON response of a GET request into out.
+func (a *api) get(ctx context.Context, path string, query url.Values, out interface{}) error {
+	resp, err := a.open(ctx, path, query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	return nil
+}
+
+func (a *api) authorize(req *http.Request) {
+	if a.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+a.apiKey)
+	}
+}
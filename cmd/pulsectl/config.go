@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+const defaultEndpoint = "http://localhost:8080/events"
+
+// errUsage reports invalid command line arguments, after they were described
+// on stderr.
+var errUsage = errors.New("usage")
+
+// Profile is a named agent connection in the config file.
+type Profile struct {
+	// Endpoint is the URL of the agent events endpoint, such as
+	// http://localhost:8080/events. The other APIs are resolved against it.
+	Endpoint string `mapstructure:"endpoint"`
+	// APIKey is sent as a bearer token, for agents behind an authenticating
+	// proxy.
+	APIKey string `mapstructure:"api_key"`
+}
+
+// Config is the pulsectl config file.
+type Config struct {
+	// Profile names the profile used when neither --profile nor
+	// PULSE_PROFILE is set.
+	Profile  string             `mapstructure:"profile"`
+	Profiles map[string]Profile `mapstructure:"profiles"`
+}
+
+// options are the flags shared by every command.
+type options struct {
+	profile  string
+	endpoint string
+	apiKey   string
+	output   string
+	color    string
+}
+
+func (o *options) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.profile, "profile", "", "config profile to use (default $PULSE_PROFILE or the profile of the config file)")
+	fs.StringVar(&o.endpoint, "endpoint", "", "agent events endpoint (default $PULSE_ENDPOINT, the profile endpoint or "+defaultEndpoint+")")
+	fs.StringVar(&o.apiKey, "api-key", "", "API key sent as a bearer token (default $PULSE_API_KEY or the profile key)")
+	fs.StringVar(&o.output, "o", "table", "output format: table, json or ndjson")
+	fs.StringVar(&o.color, "color", "auto", "colorize output: auto, always or never")
+}
+
+// validate checks the output flags.
+func (o *options) validate() error {
+	switch o.output {
+	case "table", "json", "ndjson":
+	default:
+		return fmt.Errorf("unknown output format %q", o.output)
+	}
+	switch o.color {
+	case "auto", "always", "never":
+	default:
+		return fmt.Errorf("unknown color mode %q", o.color)
+	}
+	return nil
+}
+
+// resolve returns the endpoint and API key taken from the flags, the
+// environment and the config file profile, in that order.
+func (o *options) resolve() (Profile, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return Profile{}, err
+	}
+
+	name := firstNonEmpty(o.profile, os.Getenv("PULSE_PROFILE"), config.Profile)
+	var profile Profile
+	if name != "" {
+		p, ok := config.Profiles[name]
+		if !ok {
+			return Profile{}, fmt.Errorf("unknown profile %q", name)
+		}
+		profile = p
+	}
+
+	profile.Endpoint = firstNonEmpty(o.endpoint, os.Getenv("PULSE_ENDPOINT"), profile.Endpoint, defaultEndpoint)
+	profile.APIKey = firstNonEmpty(o.apiKey, os.Getenv("PULSE_API_KEY"), profile.APIKey)
+	return profile, nil
+}
+
+// configPath returns the path of the config file, $PULSECTL_CONFIG or
+// pulse/pulsectl.yaml in the user config directory.
+func configPath() string {
+	if path := os.Getenv("PULSECTL_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "pulse", "pulsectl.yaml")
+}
+
+// loadConfig reads the config file. A missing file is an empty config.
+func loadConfig() (Config, error) {
+	var config Config
+	path := configPath()
+	if path == "" {
+		return config, nil
+	}
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return config, nil
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return config, fmt.Errorf("reading config: %w", err)
+	}
+	if err := v.Unmarshal(&config); err != nil {
+		return config, fmt.Errorf("decoding config: %w", err)
+	}
+	return config, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// stringsFlag collects the values of a repeatable flag.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// parseFlags parses args, allowing flags after positional arguments, and
+// returns the positional arguments.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, errUsage
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
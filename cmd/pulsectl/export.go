@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// exportFormats are the file formats of the export endpoint.
+var exportFormats = []string{"ndjson", "csv", "parquet"}
+
+func runExport(ctx context.Context, args []string) error {
+	var o options
+	var f filters
+	fs := newFlagSet("export", "[flags] [search text]")
+	o.register(fs)
+	f.register(fs)
+	format := fs.String("format", "ndjson", "file format: ndjson, csv or parquet")
+	file := fs.String("file", "", "file to write (default stdout)")
+	limit := fs.Int("limit", 0, "maximum number of events exported (default the server cap)")
+	dryRun := fs.Bool("dry-run", false, "print the rows the export is estimated to read instead of running it")
+
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(exportFormats, *format) {
+		return fmt.Errorf("unknown export format %q", *format)
+	}
+	if *limit < 0 {
+		return fmt.Errorf("invalid limit %d", *limit)
+	}
+	if *format == "parquet" && *file == "" && !*dryRun && isTerminal(os.Stdout) {
+		return fmt.Errorf("refusing to write parquet to a terminal, use --file")
+	}
+	a, err := o.connect()
+	if err != nil {
+		return err
+	}
+	query, err := f.query(args, time.Now())
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		return printEstimate(ctx, a, newPrinter(&o), "/export", query)
+	}
+	query.Set("format", *format)
+	if *limit > 0 {
+		query.Set("limit", strconv.Itoa(*limit))
+	}
+
+	resp, err := a.open(ctx, "/export", query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var out io.Writer = os.Stdout
+	if *file != "" {
+		fh, err := os.Create(*file)
+		if err != nil {
+			return err
+		}
+		defer fh.Close()
+		out = fh
+	}
+
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		// The server aborts the response when the export fails midway.
+		return fmt.Errorf("export incomplete: %w", err)
+	}
+
+	// Trailers are set once the body has been read to the end.
+	rows := resp.Trailer.Get("X-Export-Rows")
+	if rows == "" {
+		return fmt.Errorf("export incomplete: missing row count")
+	}
+	if resp.Trailer.Get("X-Export-Truncated") == "true" {
+		fmt.Fprintf(os.Stderr, "Export truncated at %s events, narrow the filters or time range\n", rows)
+	} else if *file != "" {
+		fmt.Fprintf(os.Stderr, "Exported %s events to %s\n", rows, *file)
+	}
+	return nil
+}
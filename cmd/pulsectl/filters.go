@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// filters are the event filter flags shared by the query commands.
+type filters struct {
+	service   string
+	level     string
+	host      string
+	traceID   string
+	requestID string
+	search    string
+
+	since string
+	from  string
+	until string
+}
+
+func (f *filters) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.service, "service", "", "only events of this service")
+	fs.StringVar(&f.level, "level", "", "only events of this level, or at a threshold such as >=WARN")
+	fs.StringVar(&f.host, "host", "", "only events of this host")
+	fs.StringVar(&f.traceID, "trace-id", "", "only events of this trace")
+	fs.StringVar(&f.requestID, "request-id", "", "only events of this request")
+	fs.StringVar(&f.search, "search", "", "only events whose message contains this text")
+	fs.StringVar(&f.since, "since", "", "only events of the last duration, such as 15m, 2h or 7d")
+	fs.StringVar(&f.from, "from", "", "only events at or after this time: a duration ago, RFC 3339, a date or Unix milliseconds")
+	fs.StringVar(&f.until, "until", "", "only events at or before this time, in the same formats as --from")
+}
+
+// query returns the filters as API query parameters. Positional arguments are
+// joined into the message search.
+func (f *filters) query(args []string, now time.Time) (url.Values, error) {
+	query := url.Values{}
+	set := func(name, value string) {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	set("service", f.service)
+	set("level", f.level)
+	set("host", f.host)
+	set("trace_id", f.traceID)
+	set("request_id", f.requestID)
+	set("search", strings.TrimSpace(f.search+" "+strings.Join(args, " ")))
+
+	start, end, err := f.timeRange(now)
+	if err != nil {
+		return nil, err
+	}
+	if !start.IsZero() {
+		query.Set("start_time", strconv.FormatInt(start.UnixMilli(), 10))
+	}
+	if !end.IsZero() {
+		query.Set("end_time", strconv.FormatInt(end.UnixMilli(), 10))
+	}
+	return query, nil
+}
+
+// timeRange returns the start and end of the time flags, zero when unset.
+func (f *filters) timeRange(now time.Time) (time.Time, time.Time, error) {
+	if f.since != "" && f.from != "" {
+		return time.Time{}, time.Time{}, errors.New("--since and --from are mutually exclusive")
+	}
+
+	var start, end time.Time
+	if f.since != "" {
+		d, err := parseDuration(f.since)
+		if err != nil {
+			return start, end, fmt.Errorf("invalid --since: %w", err)
+		}
+		start = now.Add(-d)
+	}
+	if f.from != "" {
+		t, err := parseTime(f.from, now)
+		if err != nil {
+			return start, end, fmt.Errorf("invalid --from: %w", err)
+		}
+		start = t
+	}
+	if f.until != "" {
+		t, err := parseTime(f.until, now)
+		if err != nil {
+			return start, end, fmt.Errorf("invalid --until: %w", err)
+		}
+		end = t
+	}
+	if !start.IsZero() && !end.IsZero() && !start.Before(end) {
+		return start, end, errors.New("the start of the time range must be before its end")
+	}
+	return start, end, nil
+}
+
+// parseTime reads a time as "now", a duration before now, an RFC 3339
+// timestamp, a local date and optional time, or Unix milliseconds.
+func parseTime(value string, now time.Time) (time.Time, error) {
+	if value == "now" {
+		return now, nil
+	}
+	if d, err := parseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized time %q", value)
+}
+
+// parseDuration extends time.ParseDuration with days (d) and weeks (w), which
+// may be combined with the other units as in 1d12h.
+func parseDuration(value string) (time.Duration, error) {
+	var total time.Duration
+	rest := value
+	for _, unit := range []struct {
+		suffix string
+		size   time.Duration
+	}{{"w", 7 * 24 * time.Hour}, {"d", 24 * time.Hour}} {
+		i := strings.Index(rest, unit.suffix)
+		if i < 0 {
+			continue
+		}
+		n, err := strconv.ParseInt(rest[:i], 10, 64)
+		if err != nil || n < 0 || n > math.MaxInt64/int64(unit.size) {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		// Both terms are at most math.MaxInt64, so an overflowing sum is
+		// negative.
+		if total += time.Duration(n) * unit.size; total < 0 {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		rest = rest[i+1:]
+	}
+	if rest != "" {
+		d, err := time.ParseDuration(rest)
+		if err != nil || d < 0 {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		total += d
+	}
+	if total <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return total, nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"15m", 15 * time.Minute},
+		{"2h30m", 2*time.Hour + 30*time.Minute},
+		{"7d", 7 * 24 * time.Hour},
+		{"1d12h", 36 * time.Hour},
+		{"2w", 14 * 24 * time.Hour},
+		{"1w2d", 9 * 24 * time.Hour},
+		{"1w1d1h1m", 8*24*time.Hour + time.Hour + time.Minute},
+		{"0d5s", 5 * time.Second},
+	}
+	for _, tt := range tests {
+		got, err := parseDuration(tt.value)
+		if err != nil {
+			t.Errorf("parseDuration(%q) failed: %v", tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseDuration(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseDurationErrors(t *testing.T) {
+	for _, value := range []string{
+		"",
+		"0",
+		"0d",
+		"d",
+		"-1d",
+		"1.5d",
+		"12h1d",
+		"2d1w",
+		"1d-1h",
+		"1x",
+		"10",
+		"99999999999999w",
+		"15251w",
+		"106751d1000000h",
+	} {
+		if got, err := parseDuration(value); err == nil {
+			t.Errorf("parseDuration(%q) = %v, want an error", value, got)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"now", now},
+		{"90m", now.Add(-90 * time.Minute)},
+		{"1d12h", now.Add(-36 * time.Hour)},
+		{"1700000000000", time.UnixMilli(1700000000000)},
+		{"2024-03-09T08:30:00Z", time.Date(2024, 3, 9, 8, 30, 0, 0, time.UTC)},
+		{"2024-03-09T08:30:00.250+02:00", time.Date(2024, 3, 9, 6, 30, 0, 250e6, time.UTC)},
+		{"2024-03-09 08:30:15", time.Date(2024, 3, 9, 8, 30, 15, 0, time.Local)},
+		{"2024-03-09T08:30:15", time.Date(2024, 3, 9, 8, 30, 15, 0, time.Local)},
+		{"2024-03-09 08:30", time.Date(2024, 3, 9, 8, 30, 0, 0, time.Local)},
+		{"2024-03-09", time.Date(2024, 3, 9, 0, 0, 0, 0, time.Local)},
+	}
+	for _, tt := range tests {
+		got, err := parseTime(tt.value, now)
+		if err != nil {
+			t.Errorf("parseTime(%q) failed: %v", tt.value, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parseTime(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+
+	for _, value := range []string{"", "yesterday", "2024-13-01", "03/09/2024", "1.5"} {
+		if got, err := parseTime(value, now); err == nil {
+			t.Errorf("parseTime(%q) = %v, want an error", value, got)
+		}
+	}
+}
+
+func TestFiltersTimeRange(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		filters   filters
+		wantStart time.Time
+		wantEnd   time.Time
+		wantErr   string
+	}{
+		{name: "unset"},
+		{
+			name:      "since",
+			filters:   filters{since: "1d12h"},
+			wantStart: now.Add(-36 * time.Hour),
+		},
+		{
+			name:      "from and until",
+			filters:   filters{from: "2h", until: "1h"},
+			wantStart: now.Add(-2 * time.Hour),
+			wantEnd:   now.Add(-time.Hour),
+		},
+		{
+			name:      "since and until",
+			filters:   filters{since: "15m", until: "now"},
+			wantStart: now.Add(-15 * time.Minute),
+			wantEnd:   now,
+		},
+		{
+			name:    "until only",
+			filters: filters{until: "2024-03-09T00:00:00Z"},
+			wantEnd: time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC),
+		},
+		{name: "since and from", filters: filters{since: "1h", from: "2h"}, wantErr: "mutually exclusive"},
+		{name: "invalid since", filters: filters{since: "soon"}, wantErr: "invalid --since"},
+		{name: "invalid from", filters: filters{from: "soon"}, wantErr: "invalid --from"},
+		{name: "invalid until", filters: filters{until: "soon"}, wantErr: "invalid --until"},
+		{name: "reversed", filters: filters{from: "1h", until: "2h"}, wantErr: "before its end"},
+		{name: "empty", filters: filters{from: "1h", until: "1h"}, wantErr: "before its end"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, err := tt.filters.timeRange(now)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("timeRange() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !start.Equal(tt.wantStart) || !end.Equal(tt.wantEnd) {
+				t.Errorf("timeRange() = %v, %v, want %v, %v", start, end, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestFiltersQuery(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	f := filters{service: "api", level: ">=WARN", traceID: "abc", search: "timeout", since: "1h"}
+	got, err := f.query([]string{"upstream", "db"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := url.Values{
+		"service":    {"api"},
+		"level":      {">=WARN"},
+		"trace_id":   {"abc"},
+		"search":     {"timeout upstream db"},
+		"start_time": {"1710068400000"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("query() = %v, want %v", got, want)
+	}
+
+	got, err = (&filters{}).query([]string{"disk", "full"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (url.Values{"search": {"disk full"}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("query() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,76 @@
+// Command pulsectl queries, tails and sends events through the agent HTTP API.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+const usage = `Usage: pulsectl <command> [flags] [arguments]
+
+Commands:
+  query       Search events
+  tail        Follow new events
+  facets      Show the most frequent values of fields
+  histogram   Count events over time
+  send        Send events
+  export      Write matching events to a file
+
+Run 'pulsectl <command> -h' for the flags of a command.
+`
+
+type command struct {
+	name string
+	run  func(ctx context.Context, args []string) error
+}
+
+var commands = []command{
+	{"query", runQuery},
+	{"tail", runTail},
+	{"facets", runFacets},
+	{"histogram", runHistogram},
+	{"send", runSend},
+	{"export", runExport},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	if name == "help" || name == "-h" || name == "--help" {
+		fmt.Print(usage)
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	for _, c := range commands {
+		if c.name != name {
+			continue
+		}
+		err := c.run(ctx, os.Args[2:])
+		switch {
+		case err == nil, errors.Is(err, flag.ErrHelp):
+		case errors.Is(err, errUsage):
+			os.Exit(2)
+		case ctx.Err() != nil:
+			// Interrupted, typically to end a tail.
+		default:
+			fmt.Fprintln(os.Stderr, "pulsectl:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "pulsectl: unknown command %q\n\n%s", name, usage)
+	os.Exit(2)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mohammadhptp/pulse/pkg/models"
+)
+
+const timeLayout = "2006-01-02 15:04:05.000"
+
+// ANSI escape sequences used to colorize table output.
+const (
+	ansiReset  = "\x1b[0m"
+	ansiDim    = "\x1b[2m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiBlue   = "\x1b[34m"
+	ansiPurple = "\x1b[35m"
+	ansiGray   = "\x1b[90m"
+)
+
+var levelColors = map[string]string{
+	models.LevelTrace: ansiGray,
+	models.LevelDebug: ansiBlue,
+	models.LevelInfo:  ansiGreen,
+	models.LevelWarn:  ansiYellow,
+	models.LevelError: ansiRed,
+	models.LevelFatal: ansiPurple,
+}
+
+// levelColor returns the color of a level. Every level is colorized, which
+// keeps the escape sequences from misaligning table columns.
+func levelColor(level string) string {
+	if color, ok := levelColors[level]; ok {
+		return color
+	}
+	return ansiDim
+}
+
+// printer writes command results in the selected output format.
+type printer struct {
+	w      io.Writer
+	format string
+	color  bool
+}
+
+func newPrinter(o *options) *printer {
+	return &printer{w: os.Stdout, format: o.output, color: useColor(o.color)}
+}
+
+// useColor reports whether to colorize output for a color mode. Automatic
+// colors are used on terminals unless NO_COLOR is set.
+func useColor(mode string) bool {
+	switch mode {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return isTerminal(os.Stdout)
+}
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func (p *printer) paint(color, text string) string {
+	if !p.color || color == "" {
+		return text
+	}
+	return color + text + ansiReset
+}
+
+// json writes a whole result as indented JSON.
+func (p *printer) json(v interface{}) error {
+	encoder := json.NewEncoder(p.w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// ndjson writes one JSON document per line.
+func ndjson[T any](p *printer, items []T) error {
+	encoder := json.NewEncoder(p.w)
+	for _, item := range items {
+		if err := encoder.Encode(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// events writes events as table rows or NDJSON. The JSON format is left to
+// callers, which print the whole response.
+func (p *printer) events(events []models.Event) error {
+	if p.format != "table" {
+		return ndjson(p, events)
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	for _, e := range events {
+		level := fmt.Sprintf("%-5s", e.Level)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s",
+			p.paint(ansiDim, formatTime(e.EventTimeMs)),
+			p.paint(levelColor(e.Level), level),
+			e.Service, e.Host, singleLine(e.Message))
+		if extra := eventDetails(e); extra != "" {
+			fmt.Fprint(tw, "  "+p.paint(ansiDim, extra))
+		}
+		fmt.Fprintln(tw)
+	}
+	return tw.Flush()
+}
+
+// eventDetails formats the repeat count, trace and attributes of an event as
+// key=value pairs.
+func eventDetails(e models.Event) string {
+	var parts []string
+	if e.RepeatCount > 1 {
+		parts = append(parts, fmt.Sprintf("repeated=%d", e.RepeatCount))
+	}
+	if e.TraceID != "" {
+		parts = append(parts, "trace_id="+e.TraceID)
+	}
+	names := make([]string, 0, len(e.Attributes))
+	for name := range e.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		parts = append(parts, name+"="+singleLine(e.Attributes[name]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// table writes rows under a header, aligning the columns.
+func (p *printer) table(header []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+func formatTime(ms uint64) string {
+	return time.UnixMilli(int64(ms)).Format(timeLayout)
+}
+
+// singleLine keeps multiline messages on their table row.
+func singleLine(s string) string {
+	return strings.NewReplacer("\r\n", `\n`, "\n", `\n`, "\t", " ").Replace(s)
+}
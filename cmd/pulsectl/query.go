@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/mohammadhptp/pulse/pkg/models"
+)
+
+const (
+	// tailPageSize is the number of events fetched per poll of tail.
+	tailPageSize = 500
+	// tailLookback is how far before the newest printed event tail looks
+	// for events, which arrive in storage out of time order.
+	tailLookback = 30 * time.Second
+)
+
+func newFlagSet(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: pulsectl %s %s\n\nFlags:\n", name, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// connect validates the shared flags and returns the API of the resolved
+// profile.
+func (o *options) connect() (*api, error) {
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+	profile, err := o.resolve()
+	if err != nil {
+		return nil, err
+	}
+	return newAPI(profile)
+}
+
+func runQuery(ctx context.Context, args []string) error {
+	var o options
+	var f filters
+	fs := newFlagSet("query", "[flags] [search text]")
+	o.register(fs)
+	f.register(fs)
+	limit := fs.Int("limit", 50, "number of events per page")
+	page := fs.Int("page", 1, "page of results")
+	sortOrder := fs.String("sort", "desc", "sort order by time: asc or desc")
+	dryRun := fs.Bool("dry-run", false, "print the rows the query is estimated to read instead of running it")
+
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	a, err := o.connect()
+	if err != nil {
+		return err
+	}
+	query, err := f.query(args, time.Now())
+	if err != nil {
+		return err
+	}
+	query.Set("per_page", strconv.Itoa(*limit))
+	query.Set("page", strconv.Itoa(*page))
+	query.Set("sort_order", *sortOrder)
+
+	p := newPrinter(&o)
+	if *dryRun {
+		return printEstimate(ctx, a, p, "", query)
+	}
+
+	var response models.PaginatedResponse
+	if err := a.get(ctx, "", query, &response); err != nil {
+		return err
+	}
+
+	if o.output == "json" {
+		return p.json(response)
+	}
+	if err := p.events(response.Data); err != nil {
+		return err
+	}
+	if o.output == "table" {
+		if response.Total == 0 {
+			fmt.Fprintln(os.Stderr, "No events found")
+		} else {
+			fmt.Fprintf(os.Stderr, "Events %d-%d of %d (page %d of %d)\n",
+				response.From, response.To, response.Total, response.CurrentPage, response.LastPage)
+		}
+	}
+	return nil
+}
+
+// printEstimate prints the parts and rows the agent estimates reading for the
+// query of path, which is run as a dry run.
+func printEstimate(ctx context.Context, a *api, p *printer, path string, query url.Values) error {
+	query.Set("dry_run", "true")
+	var estimate models.QueryEstimate
+	if err := a.get(ctx, path, query, &estimate); err != nil {
+		return err
+	}
+
+	switch p.format {
+	case "json":
+		return p.json(estimate)
+	case "ndjson":
+		return ndjson(p, []models.QueryEstimate{estimate})
+	}
+	if err := p.table([]string{"FROM", "TO", "PARTS", "ROWS", "MARKS", "MAX ROWS"}, [][]string{{
+		formatTime(estimate.StartTime),
+		formatTime(estimate.EndTime),
+		strconv.FormatUint(estimate.Parts, 10),
+		strconv.FormatUint(estimate.Rows, 10),
+		strconv.FormatUint(estimate.Marks, 10),
+		strconv.FormatUint(estimate.MaxRowsToRead, 10),
+	}}); err != nil {
+		return err
+	}
+	if !estimate.WithinLimits {
+		fmt.Fprintln(os.Stderr, "The query would read more rows than allowed, narrow the time range or filters")
+	}
+	return nil
+}
+
+func runTail(ctx context.Context, args []string) error {
+	var o options
+	var f filters
+	fs := newFlagSet("tail", "[flags] [search text]")
+	o.register(fs)
+	f.register(fs)
+	lines := fs.Int("n", 10, "number of recent events printed before following")
+	interval := fs.Duration("interval", 2*time.Second, "time between polls for new events")
+
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if f.until != "" {
+		return fmt.Errorf("tail does not accept --until")
+	}
+	a, err := o.connect()
+	if err != nil {
+		return err
+	}
+	if o.output == "json" {
+		o.output = "ndjson"
+	}
+	p := newPrinter(&o)
+
+	now := time.Now()
+	query, err := f.query(args, now)
+	if err != nil {
+		return err
+	}
+
+	// The most recent events, printed oldest first.
+	initial := cloneQuery(query)
+	initial.Set("per_page", strconv.Itoa(max(*lines, 1)))
+	initial.Set("sort_order", "desc")
+	var response models.PaginatedResponse
+	if err := a.get(ctx, "", initial, &response); err != nil {
+		return err
+	}
+	recent := response.Data
+	slices.Reverse(recent)
+
+	t := &tailer{seen: map[string]uint64{}, cursor: uint64(now.UnixMilli())}
+	if len(recent) > 0 {
+		t.cursor = 0
+	}
+	// With -n 0 the newest event only positions the cursor.
+	recent = t.filter(recent)
+	t.floor = t.cursor
+	if *lines > 0 {
+		if err := p.events(recent); err != nil {
+			return err
+		}
+	}
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		start := t.start()
+		for page := 1; ; page++ {
+			poll := cloneQuery(query)
+			poll.Set("start_time", strconv.FormatUint(start, 10))
+			poll.Set("sort_order", "asc")
+			poll.Set("per_page", strconv.Itoa(tailPageSize))
+			poll.Set("page", strconv.Itoa(page))
+
+			var response models.PaginatedResponse
+			if err := a.get(ctx, "", poll, &response); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				fmt.Fprintln(os.Stderr, "pulsectl:", err)
+				break
+			}
+			if err := p.events(t.filter(response.Data)); err != nil {
+				return err
+			}
+			if len(response.Data) < tailPageSize {
+				break
+			}
+		}
+		t.prune()
+	}
+}
+
+// tailer tracks the events printed by tail. Polls overlap by tailLookback, so
+// events already printed are recognised and skipped.
+type tailer struct {
+	// cursor is the time of the newest event printed.
+	cursor uint64
+	// floor is the time tail started at. Older events are left to query, even
+	// when polls reach back before it.
+	floor uint64
+	// seen maps the key of each event printed within the lookback to its time.
+	seen map[string]uint64
+}
+
+// start returns the start of the next poll.
+func (t *tailer) start() uint64 {
+	lookback := uint64(tailLookback.Milliseconds())
+	if t.cursor < lookback {
+		return 0
+	}
+	return t.cursor - lookback
+}
+
+// filter returns the events not printed yet and marks them as printed.
+func (t *tailer) filter(events []models.Event) []models.Event {
+	var fresh []models.Event
+	for _, e := range events {
+		key := fmt.Sprintf("%d\x00%s\x00%s\x00%s\x00%s", e.EventTimeMs, e.RequestID, e.Service, e.Host, e.Message)
+		if _, ok := t.seen[key]; ok || e.EventTimeMs < t.floor {
+			continue
+		}
+		t.seen[key] = e.EventTimeMs
+		t.cursor = max(t.cursor, e.EventTimeMs)
+		fresh = append(fresh, e)
+	}
+	return fresh
+}
+
+// prune forgets the events older than the next poll.
+func (t *tailer) prune() {
+	start := t.start()
+	for key, ms := range t.seen {
+		if ms < start {
+			delete(t.seen, key)
+		}
+	}
+}
+
+func cloneQuery(query url.Values) url.Values {
+	clone := make(url.Values, len(query))
+	for name, values := range query {
+		clone[name] = slices.Clone(values)
+	}
+	return clone
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/mohammadhptp/pulse/pkg/models"
+)
+
+func messages(events []models.Event) []string {
+	var names []string
+	for _, e := range events {
+		names = append(names, e.Message)
+	}
+	return names
+}
+
+func TestTailerStart(t *testing.T) {
+	tests := []struct {
+		cursor uint64
+		want   uint64
+	}{
+		{0, 0},
+		{29_999, 0},
+		{30_000, 0},
+		{1_700_000_030_000, 1_700_000_000_000},
+	}
+	for _, tt := range tests {
+		tail := &tailer{cursor: tt.cursor}
+		if got := tail.start(); got != tt.want {
+			t.Errorf("start() with cursor %d = %d, want %d", tt.cursor, got, tt.want)
+		}
+	}
+}
+
+func TestTailerFilter(t *testing.T) {
+	tail := &tailer{seen: map[string]uint64{}, floor: 1_000}
+
+	first := tail.filter([]models.Event{
+		{EventTimeMs: 900, Service: "api", Message: "before floor"},
+		{EventTimeMs: 1_000, Service: "api", Message: "a"},
+		{EventTimeMs: 2_000, Service: "api", Message: "b"},
+		{EventTimeMs: 2_000, Service: "worker", Message: "b"},
+	})
+	if want := []string{"a", "b", "b"}; !reflect.DeepEqual(messages(first), want) {
+		t.Errorf("first filter() = %v, want %v", messages(first), want)
+	}
+	if tail.cursor != 2_000 {
+		t.Errorf("cursor = %d, want 2000", tail.cursor)
+	}
+
+	// The next poll overlaps the first one and brings a late event older
+	// than the cursor.
+	second := tail.filter([]models.Event{
+		{EventTimeMs: 1_000, Service: "api", Message: "a"},
+		{EventTimeMs: 1_500, Service: "api", Message: "late"},
+		{EventTimeMs: 2_000, Service: "api", Message: "b"},
+		{EventTimeMs: 2_000, Service: "api", RequestID: "r2", Message: "b"},
+		{EventTimeMs: 3_000, Service: "api", Message: "c"},
+	})
+	if want := []string{"late", "b", "c"}; !reflect.DeepEqual(messages(second), want) {
+		t.Errorf("second filter() = %v, want %v", messages(second), want)
+	}
+	if tail.cursor != 3_000 {
+		t.Errorf("cursor = %d, want 3000", tail.cursor)
+	}
+
+	if again := tail.filter(second); len(again) != 0 {
+		t.Errorf("filter() of printed events = %v, want none", messages(again))
+	}
+}
+
+func TestTailerPrune(t *testing.T) {
+	tail := &tailer{seen: map[string]uint64{}}
+	tail.filter([]models.Event{
+		{EventTimeMs: 10_000, Message: "old"},
+		{EventTimeMs: 40_000, Message: "edge"},
+		{EventTimeMs: 70_000, Message: "new"},
+	})
+
+	tail.prune()
+	if len(tail.seen) != 2 {
+		t.Fatalf("seen has %d events after prune, want 2", len(tail.seen))
+	}
+	for _, ms := range tail.seen {
+		if ms < tail.start() {
+			t.Errorf("prune() kept an event at %d, before the next poll at %d", ms, tail.start())
+		}
+	}
+
+	// Events within the lookback are still recognised after pruning.
+	fresh := tail.filter([]models.Event{
+		{EventTimeMs: 40_000, Message: "edge"},
+		{EventTimeMs: 70_000, Message: "new"},
+	})
+	if len(fresh) != 0 {
+		t.Errorf("filter() after prune = %v, want none", messages(fresh))
+	}
+}
+
+func TestCloneQuery(t *testing.T) {
+	query := url.Values{"service": {"api"}, "level": {"WARN", "ERROR"}}
+	clone := cloneQuery(query)
+	clone.Set("service", "worker")
+	clone["level"][0] = "INFO"
+
+	if want := (url.Values{"service": {"api"}, "level": {"WARN", "ERROR"}}); !reflect.DeepEqual(query, want) {
+		t.Errorf("query changed through its clone: %v", query)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mohammadhptp/pulse/pkg/client"
+	"github.com/mohammadhptp/pulse/pkg/models"
+)
+
+func runSend(ctx context.Context, args []string) error {
+	var o options
+	var attributes stringsFlag
+	fs := newFlagSet("send", "[flags] [message]")
+	o.register(fs)
+	service := fs.String("service", "pulsectl", "service of the events")
+	level := fs.String("level", models.LevelInfo, "level of the events")
+	host := fs.String("host", "", "host of the events (default the machine hostname)")
+	traceID := fs.String("trace-id", "", "trace of the events")
+	fs.Var(&attributes, "attr", "attribute as name=value; repeatable")
+
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := o.validate(); err != nil {
+		return err
+	}
+	profile, err := o.resolve()
+	if err != nil {
+		return err
+	}
+
+	defaults := models.Event{Service: *service, Level: *level, Host: *host, TraceID: *traceID}
+	if defaults.Host == "" {
+		defaults.Host, _ = os.Hostname()
+	}
+	for _, attr := range attributes {
+		name, value, ok := strings.Cut(attr, "=")
+		if !ok || name == "" {
+			return fmt.Errorf("invalid attribute %q, expected name=value", attr)
+		}
+		if defaults.Attributes == nil {
+			defaults.Attributes = map[string]string{}
+		}
+		defaults.Attributes[name] = value
+	}
+
+	// A message on the command line is sent as one event; otherwise events
+	// are read from stdin as JSON or NDJSON, and plain lines as messages.
+	var events []models.Event
+	if len(args) > 0 {
+		events = []models.Event{{Message: strings.Join(args, " ")}}
+	} else {
+		events, err = readEvents(os.Stdin)
+		if err != nil {
+			return err
+		}
+	}
+	if len(events) == 0 {
+		return errors.New("no events to send")
+	}
+	applyDefaults(events, defaults)
+
+	var mu sync.Mutex
+	var failed int
+	var sendErr error
+	headers := map[string]string{}
+	if profile.APIKey != "" {
+		headers["Authorization"] = "Bearer " + profile.APIKey
+	}
+	c, err := client.New(client.Config{
+		Endpoint:   profile.Endpoint,
+		Headers:    headers,
+		BufferSize: len(events),
+		OnError: func(err error, events []models.Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			failed += len(events)
+			sendErr = err
+		},
+	})
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		c.Send(event)
+	}
+	if err := c.Close(ctx); err != nil && sendErr == nil {
+		return err
+	}
+
+	if sendErr != nil {
+		return fmt.Errorf("%d of %d events not sent: %w", failed, len(events), sendErr)
+	}
+	fmt.Fprintf(os.Stderr, "Sent %d events\n", len(events))
+	return nil
+}
+
+// readEvents reads a JSON array of events, JSON or NDJSON events, or plain
+// text lines sent as messages.
+func readEvents(r io.Reader) ([]models.Event, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	var events []models.Event
+	switch data[0] {
+	case '[':
+		if err := json.Unmarshal(data, &events); err != nil {
+			return nil, fmt.Errorf("decoding events: %w", err)
+		}
+	case '{':
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		for {
+			var event models.Event
+			err := decoder.Decode(&event)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("decoding event %d: %w", len(events)+1, err)
+			}
+			events = append(events, event)
+		}
+	default:
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 64*1024), len(data)+1)
+		for scanner.Scan() {
+			if line := strings.TrimRight(scanner.Text(), "\r"); line != "" {
+				events = append(events, models.Event{Message: line})
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return events, nil
+}
+
+// applyDefaults sets the fields missing from events to those of defaults, and
+// a missing time to now.
+func applyDefaults(events []models.Event, defaults models.Event) {
+	now := uint64(time.Now().UnixMilli())
+	for i := range events {
+		e := &events[i]
+		if e.EventTimeMs == 0 {
+			e.EventTimeMs = now
+		}
+		if e.Service == "" {
+			e.Service = defaults.Service
+		}
+		if e.Level == "" && e.SeverityNumber == 0 {
+			e.Level = defaults.Level
+		}
+		if e.Host == "" {
+			e.Host = defaults.Host
+		}
+		if e.TraceID == "" {
+			e.TraceID = defaults.TraceID
+		}
+		for name, value := range defaults.Attributes {
+			if _, ok := e.Attributes[name]; ok {
+				continue
+			}
+			if e.Attributes == nil {
+				e.Attributes = map[string]string{}
+			}
+			e.Attributes[name] = value
+		}
+	}
+}
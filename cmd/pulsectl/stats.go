@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mohammadhptp/pulse/pkg/models"
+)
+
+// histogramBarWidth is the width of the bar of the largest histogram bucket.
+const histogramBarWidth = 40
+
+func runFacets(ctx context.Context, args []string) error {
+	var o options
+	var f filters
+	var fields stringsFlag
+	fs := newFlagSet("facets", "[flags] [search text]")
+	o.register(fs)
+	f.register(fs)
+	fs.Var(&fields, "field", "field to facet: service, level, host or attributes.<name>; repeatable (default service, level and host)")
+	limit := fs.Int("limit", 10, "number of values per field")
+
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	a, err := o.connect()
+	if err != nil {
+		return err
+	}
+	query, err := f.query(args, time.Now())
+	if err != nil {
+		return err
+	}
+	for _, field := range fields {
+		query.Add("field", field)
+	}
+	query.Set("limit", strconv.Itoa(*limit))
+
+	var response struct {
+		Facets map[string][]models.FacetValue `json:"facets"`
+	}
+	if err := a.get(ctx, "/facets", query, &response); err != nil {
+		return err
+	}
+
+	p := newPrinter(&o)
+	switch o.output {
+	case "json":
+		return p.json(response)
+	case "ndjson":
+		type row struct {
+			Field string `json:"field"`
+			models.FacetValue
+		}
+		var rows []row
+		for _, name := range facetOrder(fields, response.Facets) {
+			for _, value := range response.Facets[name] {
+				rows = append(rows, row{Field: name, FacetValue: value})
+			}
+		}
+		return ndjson(p, rows)
+	}
+
+	var rows [][]string
+	for _, name := range facetOrder(fields, response.Facets) {
+		for _, value := range response.Facets[name] {
+			rows = append(rows, []string{name, value.Value, formatCount(value.Count), formatCount(value.EstimatedCount)})
+		}
+	}
+	return p.table([]string{"FIELD", "VALUE", "COUNT", "ESTIMATED"}, rows)
+}
+
+// facetOrder returns the faceted fields in the order requested, or sorted
+// when the server picked the defaults.
+func facetOrder(requested []string, facets map[string][]models.FacetValue) []string {
+	var order []string
+	seen := map[string]bool{}
+	for _, field := range requested {
+		for _, name := range strings.Split(field, ",") {
+			name = strings.TrimSpace(name)
+			if _, ok := facets[name]; ok && !seen[name] {
+				order = append(order, name)
+				seen[name] = true
+			}
+		}
+	}
+	var rest []string
+	for name := range facets {
+		if !seen[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	return append(order, rest...)
+}
+
+func runHistogram(ctx context.Context, args []string) error {
+	var o options
+	var f filters
+	fs := newFlagSet("histogram", "[flags] [search text]")
+	o.register(fs)
+	f.register(fs)
+	interval := fs.String("interval", "", "bucket size such as 1m or 1h (default chosen by the server)")
+
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	a, err := o.connect()
+	if err != nil {
+		return err
+	}
+	query, err := f.query(args, time.Now())
+	if err != nil {
+		return err
+	}
+	if *interval != "" {
+		d, err := parseDuration(*interval)
+		if err != nil {
+			return fmt.Errorf("invalid --interval: %w", err)
+		}
+		query.Set("interval", d.String())
+	}
+
+	var response struct {
+		StartTime  uint64                   `json:"start_time"`
+		EndTime    uint64                   `json:"end_time"`
+		IntervalMs int64                    `json:"interval_ms"`
+		Buckets    []models.HistogramBucket `json:"buckets"`
+	}
+	if err := a.get(ctx, "/histogram", query, &response); err != nil {
+		return err
+	}
+
+	p := newPrinter(&o)
+	switch o.output {
+	case "json":
+		return p.json(response)
+	case "ndjson":
+		return ndjson(p, response.Buckets)
+	}
+
+	var largest uint64
+	for _, bucket := range response.Buckets {
+		largest = max(largest, bucket.EstimatedCount)
+	}
+	rows := make([][]string, 0, len(response.Buckets))
+	for _, bucket := range response.Buckets {
+		width := 0
+		if largest > 0 {
+			width = int((bucket.EstimatedCount*histogramBarWidth + largest - 1) / largest)
+		}
+		rows = append(rows, []string{
+			formatTime(bucket.TimeMs),
+			formatCount(bucket.Count),
+			formatCount(bucket.EstimatedCount),
+			p.paint(ansiBlue, strings.Repeat("█", width)),
+		})
+	}
+	if err := p.table([]string{"TIME", "COUNT", "ESTIMATED", ""}, rows); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Interval %s\n", time.Duration(response.IntervalMs)*time.Millisecond)
+	return nil
+}
+
+func formatCount(n uint64) string {
+	return strconv.FormatUint(n, 10)
+}
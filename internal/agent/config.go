@@ -0,0 +1,44 @@
+package agent
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mohammadhptp/pulse/internal/agent/parser"
+	"github.com/mohammadhptp/pulse/pkg/transport"
+	"github.com/spf13/viper"
+)
+
+// Config is the structured agent configuration read from the file named by
+// AGENT_CONFIG. Settings that fit a single environment variable stay in .env.
+type Config struct {
+	Files   FilesConfig     `mapstructure:"files"`
+	Parsers []parser.Config `mapstructure:"parsers"`
+	// Pipeline lists the processors events run through, each configured by
+	// its type and type specific options.
+	Pipeline []map[string]interface{} `mapstructure:"pipeline"`
+}
+
+// FilesConfig configures the file tailing input.
+type FilesConfig struct {
+	CheckpointPath string                `mapstructure:"checkpoint_path"`
+	PollInterval   time.Duration         `mapstructure:"poll_interval"`
+	Inputs         []transport.FileInput `mapstructure:"inputs"`
+}
+
+// LoadConfig reads the agent configuration file. The format is taken from the
+// file extension, so YAML, JSON and TOML are all accepted.
+func LoadConfig(path string) (*Config, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("reading agent config: %w", err)
+	}
+
+	var config Config
+	if err := v.Unmarshal(&config); err != nil {
+		return nil, fmt.Errorf("decoding agent config: %w", err)
+	}
+
+	return &config, nil
+}
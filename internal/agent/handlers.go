@@ -0,0 +1,69 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/mohammadhptp/pulse/internal/agent/pipeline"
+	"github.com/mohammadhptp/pulse/pkg/logger"
+	"github.com/mohammadhptp/pulse/pkg/models"
+	"go.uber.org/zap"
+)
+
+const dryRunMaxBodyBytes = 1 << 20
+
+// HandlePipelineStats reports the counters of every pipeline processor.
+func (p *EventProcessor) HandlePipelineStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"processors": p.pipeline.Stats(),
+	})
+}
+
+// dryRunResponse shows how an event is transformed on its way to Kafka.
+type dryRunResponse struct {
+	Parser string          `json:"parser,omitempty"`
+	Parsed models.Event    `json:"parsed"`
+	Steps  []pipeline.Step `json:"steps"`
+	Kept   bool            `json:"kept"`
+	Event  *pipeline.Event `json:"event,omitempty"`
+}
+
+// HandlePipelineDryRun runs the event in the request body through the parsers
+// and the pipeline without writing it to Kafka. The source query parameter
+// selects parsers configured for a transport or file input.
+func (p *EventProcessor) HandlePipelineDryRun(w http.ResponseWriter, r *http.Request) {
+	var event models.Event
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, dryRunMaxBodyBytes)).Decode(&event); err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	event.Source = r.URL.Query().Get("source")
+
+	response := dryRunResponse{}
+	response.Parser, _ = p.parsers.Apply(&event)
+	event.NormalizeSeverity()
+	event.NormalizeTrace()
+	response.Parsed = event
+
+	steps, result, kept := p.pipeline.DryRun(event)
+	response.Steps = steps
+	response.Kept = kept
+	if kept {
+		result.NormalizeSeverity()
+		result.NormalizeTrace()
+		if result.Topic == "" {
+			result.Topic = p.topic
+		}
+		response.Event = &result
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Error("Failed to encode response", zap.Error(err))
+	}
+}
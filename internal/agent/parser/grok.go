@@ -0,0 +1,120 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// grokReference matches %{PATTERN}, %{PATTERN:field} and %{PATTERN:field:type}.
+// The type suffix is accepted for compatibility; all fields are strings.
+var grokReference = regexp.MustCompile(`%\{(\w+)(?::([\w.@\[\]-]+))?(?::\w+)?\}`)
+
+const grokMaxDepth = 32
+
+// grokDecoder matches lines against a grok expression, an extended regular
+// expression referencing named patterns from the pattern library.
+type grokDecoder struct {
+	re     *regexp.Regexp
+	fields []string
+}
+
+func newGrokDecoder(pattern string, custom map[string]string) (*grokDecoder, error) {
+	if pattern == "" {
+		return nil, errors.New("pattern is required")
+	}
+
+	library := make(map[string]string, len(grokPatterns)+len(custom))
+	for name, p := range grokPatterns {
+		library[name] = p
+	}
+	for name, p := range custom {
+		library[name] = p
+	}
+
+	c := &grokCompiler{library: library, groups: make(map[string]string)}
+	expanded, err := c.expand(pattern, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	re, err := regexp.Compile(expanded)
+	if err != nil {
+		return nil, fmt.Errorf("compiling grok pattern: %w", err)
+	}
+
+	fields := re.SubexpNames()
+	for i, name := range fields {
+		if field, ok := c.groups[name]; ok {
+			fields[i] = field
+		}
+	}
+	return &grokDecoder{re: re, fields: fields}, nil
+}
+
+// grokCompiler expands pattern references into a regular expression. Named
+// references become capture groups with generated names, since field names
+// may contain characters regexp group names cannot.
+type grokCompiler struct {
+	library map[string]string
+	groups  map[string]string
+}
+
+func (c *grokCompiler) expand(pattern string, depth int) (string, error) {
+	if depth > grokMaxDepth {
+		return "", errors.New("grok patterns are nested too deeply or recursive")
+	}
+
+	var expandErr error
+	expanded := grokReference.ReplaceAllStringFunc(pattern, func(ref string) string {
+		if expandErr != nil {
+			return ""
+		}
+
+		parts := grokReference.FindStringSubmatch(ref)
+		name, field := parts[1], parts[2]
+
+		definition, ok := c.library[name]
+		if !ok {
+			expandErr = fmt.Errorf("unknown grok pattern %q", name)
+			return ""
+		}
+
+		inner, err := c.expand(definition, depth+1)
+		if err != nil {
+			expandErr = err
+			return ""
+		}
+
+		if field == "" {
+			return "(?:" + inner + ")"
+		}
+		group := fmt.Sprintf("grok%d", len(c.groups))
+		c.groups[group] = field
+		return "(?P<" + group + ">" + inner + ")"
+	})
+	if expandErr != nil {
+		return "", expandErr
+	}
+	return expanded, nil
+}
+
+func (d *grokDecoder) decode(line string) (map[string]string, bool) {
+	match := d.re.FindStringSubmatchIndex(line)
+	if match == nil {
+		return nil, false
+	}
+
+	fields := make(map[string]string)
+	for i, name := range d.fields {
+		if name == "" || match[2*i] < 0 {
+			continue
+		}
+		value := line[match[2*i]:match[2*i+1]]
+		// A field captured by several alternatives keeps the one that matched.
+		if value != "" || fields[name] == "" {
+			fields[name] = value
+		}
+	}
+	return fields, true
+}
@@ -0,0 +1,97 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGrokDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		custom  map[string]string
+		line    string
+		fields  map[string]string
+		ok      bool
+	}{
+		{
+			name:    "named fields",
+			pattern: `%{IP:client} %{WORD:method} %{NUMBER:status}`,
+			line:    `10.0.0.1 GET 200`,
+			fields:  map[string]string{"client": "10.0.0.1", "method": "GET", "status": "200"},
+			ok:      true,
+		},
+		{
+			name:    "type suffix and dotted field",
+			pattern: `%{NUMBER:http.status:int} %{GREEDYDATA:message}`,
+			line:    `503 upstream unavailable`,
+			fields:  map[string]string{"http.status": "503", "message": "upstream unavailable"},
+			ok:      true,
+		},
+		{
+			name:    "unnamed reference",
+			pattern: `%{IP} %{WORD:method}`,
+			line:    `10.0.0.1 POST`,
+			fields:  map[string]string{"method": "POST"},
+			ok:      true,
+		},
+		{
+			name:    "custom pattern",
+			pattern: `%{ORDER:order} shipped`,
+			custom:  map[string]string{"ORDER": `ORD-\d+`},
+			line:    `ORD-42 shipped`,
+			fields:  map[string]string{"order": "ORD-42"},
+			ok:      true,
+		},
+		{
+			name:    "apache log",
+			pattern: `%{COMMONAPACHELOG}`,
+			line:    `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326`,
+			fields: map[string]string{
+				"clientip": "127.0.0.1", "ident": "-", "auth": "frank", "timestamp": "10/Oct/2000:13:55:36 -0700",
+				"verb": "GET", "request": "/apache_pb.gif", "httpversion": "1.0", "response": "200", "bytes": "2326",
+			},
+			ok: true,
+		},
+		{
+			name:    "no match",
+			pattern: `%{IP:client} %{NUMBER:status}`,
+			line:    `not an access log`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := newGrokDecoder(tt.pattern, tt.custom)
+			if err != nil {
+				t.Fatalf("newGrokDecoder: %v", err)
+			}
+			fields, ok := d.decode(tt.line)
+			if ok != tt.ok || !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("decode(%q) = %v, %v; want %v, %v", tt.line, fields, ok, tt.fields, tt.ok)
+			}
+		})
+	}
+}
+
+func TestNewGrokDecoderErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		custom  map[string]string
+		err     string
+	}{
+		{"empty", ``, nil, "pattern is required"},
+		{"unknown pattern", `%{NOPE:x}`, nil, `unknown grok pattern "NOPE"`},
+		{"recursive", `%{LOOP}`, map[string]string{"LOOP": `a%{LOOP}`}, "nested too deeply"},
+		{"invalid regexp", `%{WORD:x}(`, nil, "compiling grok pattern"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newGrokDecoder(tt.pattern, tt.custom)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("newGrokDecoder(%q) error = %v, want %q", tt.pattern, err, tt.err)
+			}
+		})
+	}
+}
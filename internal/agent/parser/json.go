@@ -0,0 +1,28 @@
+package parser
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/mohammadhptp/pulse/pkg/models"
+)
+
+// jsonDecoder decodes JSON object lines. Nested objects are flattened into
+// dotted field names.
+type jsonDecoder struct{}
+
+func (jsonDecoder) decode(line string) (map[string]string, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "{") {
+		return nil, false
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(line))
+	decoder.UseNumber()
+
+	var document map[string]interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil, false
+	}
+	return models.FlattenDocument(document), true
+}
@@ -0,0 +1,45 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestJSONDecode(t *testing.T) {
+	tests := []struct {
+		name   string
+		line   string
+		fields map[string]string
+		ok     bool
+	}{
+		{
+			name:   "flat",
+			line:   `{"level":"info","msg":"started","port":8080}`,
+			fields: map[string]string{"level": "info", "msg": "started", "port": "8080"},
+			ok:     true,
+		},
+		{
+			name:   "nested",
+			line:   ` {"service":{"name":"api"},"tags":["a","b"],"ok":true,"none":null}`,
+			fields: map[string]string{"service.name": "api", "tags": `["a","b"]`, "ok": "true"},
+			ok:     true,
+		},
+		{
+			name:   "large number kept exact",
+			line:   `{"id":12345678901234567890}`,
+			fields: map[string]string{"id": "12345678901234567890"},
+			ok:     true,
+		},
+		{name: "plain text", line: `started`},
+		{name: "array", line: `["a"]`},
+		{name: "invalid", line: `{"level":`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, ok := jsonDecoder{}.decode(tt.line)
+			if ok != tt.ok || !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("decode(%q) = %v, %v; want %v, %v", tt.line, fields, ok, tt.fields, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+)
+
+// logfmtDecoder decodes key=value lines as written by logfmt loggers. Values
+// may be double quoted with Go escapes. Bare words are skipped, and lines made
+// of more bare words than pairs are taken for plain text rather than logfmt.
+type logfmtDecoder struct{}
+
+func (logfmtDecoder) decode(line string) (map[string]string, bool) {
+	fields := make(map[string]string)
+	var pairs, words int
+
+	s := strings.TrimSpace(line)
+	for s != "" {
+		end := strings.IndexAny(s, "= ")
+		if end == 0 {
+			return nil, false
+		}
+		if end < 0 {
+			end = len(s)
+		}
+		key := s[:end]
+		s = s[end:]
+
+		if !strings.HasPrefix(s, "=") {
+			words++
+			s = strings.TrimLeft(s, " ")
+			continue
+		}
+		s = s[1:]
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			quoted, err := strconv.QuotedPrefix(s)
+			if err != nil {
+				return nil, false
+			}
+			value, _ = strconv.Unquote(quoted)
+			s = s[len(quoted):]
+			if s != "" && s[0] != ' ' {
+				return nil, false
+			}
+		} else {
+			end := strings.IndexByte(s, ' ')
+			if end < 0 {
+				end = len(s)
+			}
+			value = s[:end]
+			s = s[end:]
+		}
+
+		fields[key] = value
+		pairs++
+		s = strings.TrimLeft(s, " ")
+	}
+
+	if pairs == 0 || pairs <= words {
+		return nil, false
+	}
+	return fields, true
+}
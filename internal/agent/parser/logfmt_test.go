@@ -0,0 +1,61 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLogfmtDecode(t *testing.T) {
+	tests := []struct {
+		name   string
+		line   string
+		fields map[string]string
+		ok     bool
+	}{
+		{
+			name:   "pairs",
+			line:   `level=info msg=started port=8080`,
+			fields: map[string]string{"level": "info", "msg": "started", "port": "8080"},
+			ok:     true,
+		},
+		{
+			name:   "quoted value",
+			line:   `level=warn msg="disk \"data\" almost full" used=91%`,
+			fields: map[string]string{"level": "warn", "msg": `disk "data" almost full`, "used": "91%"},
+			ok:     true,
+		},
+		{
+			name:   "empty value",
+			line:   `user= id=7`,
+			fields: map[string]string{"user": "", "id": "7"},
+			ok:     true,
+		},
+		{
+			name:   "bare word skipped",
+			line:   `level=error msg=failed retrying`,
+			fields: map[string]string{"level": "error", "msg": "failed"},
+			ok:     true,
+		},
+		{
+			name:   "extra spaces",
+			line:   `  a=1    b=2  `,
+			fields: map[string]string{"a": "1", "b": "2"},
+			ok:     true,
+		},
+		{name: "plain text", line: `User logged in`},
+		{name: "mostly bare words", line: `level=info User logged in`},
+		{name: "as many bare words as pairs", line: `status=ok done`},
+		{name: "leading equals", line: `=value`},
+		{name: "unterminated quote", line: `msg="unterminated`},
+		{name: "text after quote", line: `msg="a"b`},
+		{name: "empty", line: ``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, ok := logfmtDecoder{}.decode(tt.line)
+			if ok != tt.ok || !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("decode(%q) = %v, %v; want %v, %v", tt.line, fields, ok, tt.fields, tt.ok)
+			}
+		})
+	}
+}
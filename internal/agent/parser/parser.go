@@ -0,0 +1,232 @@
+// Package parser decodes raw log lines into structured events. Parsers lift
+// well-known fields into the event and keep the remaining fields as attributes.
+package parser
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/mohammadhptp/pulse/pkg/models"
+)
+
+// Parser types accepted in Config.Type.
+const (
+	TypeJSON   = "json"
+	TypeLogfmt = "logfmt"
+	TypeRegex  = "regex"
+	TypeGrok   = "grok"
+)
+
+// Default field names checked, in order, when a Config does not name a field.
+var (
+	DefaultTimeFields    = []string{"time", "timestamp", "ts", "@timestamp"}
+	DefaultLevelFields   = []string{"level", "lvl", "severity", "log.level"}
+	DefaultServiceFields = []string{"service", "service.name", "app"}
+	DefaultHostFields    = []string{"host", "hostname", "host.name"}
+	DefaultMessageFields = []string{"msg", "message", "log"}
+)
+
+// Config configures a parser.
+type Config struct {
+	Name string `mapstructure:"name"`
+	// Type is one of json, logfmt, regex or grok.
+	Type string `mapstructure:"type"`
+	// Pattern is the regular expression with named captures for regex
+	// parsers, or the grok expression for grok parsers.
+	Pattern string `mapstructure:"pattern"`
+	// Patterns defines additional grok patterns by name.
+	Patterns map[string]string `mapstructure:"patterns"`
+
+	// Inputs and Services select the events the parser applies to, by event
+	// source (a transport or file input name) and service. A parser without
+	// selectors applies to every event.
+	Inputs   []string `mapstructure:"inputs"`
+	Services []string `mapstructure:"services"`
+
+	// Fields lifted into the event. Empty names fall back to the defaults.
+	TimeField    string `mapstructure:"time_field"`
+	LevelField   string `mapstructure:"level_field"`
+	ServiceField string `mapstructure:"service_field"`
+	HostField    string `mapstructure:"host_field"`
+	MessageField string `mapstructure:"message_field"`
+
+	// TimeLayouts are Go reference layouts, or the names RFC3339, RFC1123,
+	// unix, unix_ms, unix_us and unix_ns, tried in order when parsing the time
+	// field. Numeric timestamps are detected when no layout is given.
+	TimeLayouts []string `mapstructure:"time_layouts"`
+	// Timezone is the IANA location used for layouts without a zone.
+	Timezone string `mapstructure:"timezone"`
+}
+
+// decoder splits a line into fields, reporting false when the line does not
+// match its format.
+type decoder interface {
+	decode(line string) (map[string]string, bool)
+}
+
+type parser struct {
+	name     string
+	decoder  decoder
+	inputs   []string
+	services []string
+
+	timeFields    []string
+	levelFields   []string
+	serviceFields []string
+	hostFields    []string
+	messageFields []string
+	times         *timeParser
+}
+
+// Set is an ordered list of parsers. The first parser that applies to an event
+// and decodes its message wins.
+type Set struct {
+	parsers []*parser
+}
+
+// New builds a Set from parser configurations.
+func New(configs []Config) (*Set, error) {
+	set := &Set{}
+	for i, config := range configs {
+		if config.Name == "" {
+			config.Name = fmt.Sprintf("%s-%d", config.Type, i)
+		}
+
+		p, err := newParser(config)
+		if err != nil {
+			return nil, fmt.Errorf("parser %q: %w", config.Name, err)
+		}
+		set.parsers = append(set.parsers, p)
+	}
+	return set, nil
+}
+
+func newParser(config Config) (*parser, error) {
+	var dec decoder
+	var err error
+	switch strings.ToLower(config.Type) {
+	case TypeJSON:
+		dec = jsonDecoder{}
+	case TypeLogfmt:
+		dec = logfmtDecoder{}
+	case TypeRegex:
+		dec, err = newRegexDecoder(config.Pattern)
+	case TypeGrok:
+		dec, err = newGrokDecoder(config.Pattern, config.Patterns)
+	default:
+		return nil, fmt.Errorf("unknown type %q", config.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	times, err := newTimeParser(config.TimeLayouts, config.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	return &parser{
+		name:          config.Name,
+		decoder:       dec,
+		inputs:        config.Inputs,
+		services:      config.Services,
+		timeFields:    fieldNames(config.TimeField, DefaultTimeFields),
+		levelFields:   fieldNames(config.LevelField, DefaultLevelFields),
+		serviceFields: fieldNames(config.ServiceField, DefaultServiceFields),
+		hostFields:    fieldNames(config.HostField, DefaultHostFields),
+		messageFields: fieldNames(config.MessageField, DefaultMessageFields),
+		times:         times,
+	}, nil
+}
+
+func fieldNames(name string, defaults []string) []string {
+	if name != "" {
+		return []string{name}
+	}
+	return defaults
+}
+
+// Len returns the number of parsers in the set.
+func (s *Set) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.parsers)
+}
+
+// Apply parses the event message with the first matching parser and returns
+// its name, or false when no parser applied.
+func (s *Set) Apply(event *models.Event) (string, bool) {
+	if s == nil {
+		return "", false
+	}
+
+	for _, p := range s.parsers {
+		if !p.selects(event) {
+			continue
+		}
+
+		fields, ok := p.decoder.decode(event.Message)
+		if !ok {
+			continue
+		}
+
+		p.lift(event, fields)
+		return p.name, true
+	}
+	return "", false
+}
+
+func (p *parser) selects(event *models.Event) bool {
+	if len(p.inputs) == 0 && len(p.services) == 0 {
+		return true
+	}
+	return slices.Contains(p.inputs, event.Source) || slices.Contains(p.services, event.Service)
+}
+
+// lift moves the well-known fields into the event and stores the others as
+// attributes. The original line is kept as the message when the parsed fields
+// do not contain one.
+func (p *parser) lift(event *models.Event, fields map[string]string) {
+	if name, value := takeFirst(fields, p.timeFields); name != "" {
+		if ts, ok := p.times.parse(value); ok {
+			event.EventTimeMs = uint64(ts.UnixMilli())
+		} else {
+			fields[name] = value
+		}
+	}
+	if _, value := takeFirst(fields, p.levelFields); value != "" {
+		event.Level = value
+	}
+	if _, value := takeFirst(fields, p.serviceFields); value != "" {
+		event.Service = value
+	}
+	if _, value := takeFirst(fields, p.hostFields); value != "" {
+		event.Host = value
+	}
+	if _, value := takeFirst(fields, p.messageFields); value != "" {
+		event.Message = value
+	}
+
+	if len(fields) == 0 {
+		return
+	}
+	if event.Attributes == nil {
+		event.Attributes = make(map[string]string, len(fields))
+	}
+	for name, value := range fields {
+		event.Attributes[name] = value
+	}
+}
+
+// takeFirst removes and returns the first of names present in fields.
+func takeFirst(fields map[string]string, names []string) (string, string) {
+	for _, name := range names {
+		if value, ok := fields[name]; ok {
+			delete(fields, name)
+			return name, value
+		}
+	}
+	return "", ""
+}
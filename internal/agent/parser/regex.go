@@ -0,0 +1,41 @@
+package parser
+
+import (
+	"errors"
+	"regexp"
+)
+
+// regexDecoder extracts the named capture groups of a regular expression.
+// Groups that did not participate in the match are omitted.
+type regexDecoder struct {
+	re     *regexp.Regexp
+	fields []string
+}
+
+func newRegexDecoder(pattern string) (*regexDecoder, error) {
+	if pattern == "" {
+		return nil, errors.New("pattern is required")
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &regexDecoder{re: re, fields: re.SubexpNames()}, nil
+}
+
+func (d *regexDecoder) decode(line string) (map[string]string, bool) {
+	match := d.re.FindStringSubmatchIndex(line)
+	if match == nil {
+		return nil, false
+	}
+
+	fields := make(map[string]string)
+	for i, name := range d.fields {
+		if name == "" || match[2*i] < 0 {
+			continue
+		}
+		fields[name] = line[match[2*i]:match[2*i+1]]
+	}
+	return fields, true
+}
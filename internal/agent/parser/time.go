@@ -0,0 +1,160 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// namedLayouts are the layout names accepted in addition to Go reference
+// layouts.
+var namedLayouts = map[string]string{
+	"RFC3339":     time.RFC3339Nano,
+	"RFC3339Nano": time.RFC3339Nano,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"ANSIC":       time.ANSIC,
+	"UnixDate":    time.UnixDate,
+	"Stamp":       time.Stamp,
+	"StampMilli":  time.StampMilli,
+	"DateTime":    time.DateTime,
+}
+
+// defaultLayouts are tried when a parser does not configure layouts.
+var defaultLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"02/Jan/2006:15:04:05 -0700",
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+// Epoch layouts with a fixed unit.
+const (
+	layoutUnix   = "unix"
+	layoutUnixMs = "unix_ms"
+	layoutUnixUs = "unix_us"
+	layoutUnixNs = "unix_ns"
+)
+
+type timeParser struct {
+	layouts  []string
+	location *time.Location
+	// epoch reports that numeric values are detected when no layout matches.
+	epoch bool
+}
+
+func newTimeParser(layouts []string, timezone string) (*timeParser, error) {
+	location := time.UTC
+	if timezone != "" {
+		loc, err := time.LoadLocation(timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %w", timezone, err)
+		}
+		location = loc
+	}
+
+	if len(layouts) == 0 {
+		return &timeParser{layouts: defaultLayouts, location: location, epoch: true}, nil
+	}
+
+	resolved := make([]string, 0, len(layouts))
+	for _, layout := range layouts {
+		if named, ok := namedLayouts[layout]; ok {
+			layout = named
+		}
+		resolved = append(resolved, layout)
+	}
+	return &timeParser{layouts: resolved, location: location}, nil
+}
+
+func (p *timeParser) parse(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, false
+	}
+
+	for _, layout := range p.layouts {
+		switch layout {
+		case layoutUnix, layoutUnixMs, layoutUnixUs, layoutUnixNs:
+			if ts, ok := parseEpoch(value, layout); ok {
+				return ts, true
+			}
+			continue
+		}
+
+		ts, err := time.ParseInLocation(layout, value, p.location)
+		if err != nil {
+			continue
+		}
+		// Layouts without a year, such as syslog stamps, parse into year 0.
+		if ts.Year() == 0 {
+			ts = ts.AddDate(time.Now().In(p.location).Year(), 0, 0)
+		}
+		return ts, true
+	}
+
+	if p.epoch {
+		return parseEpoch(value, "")
+	}
+	return time.Time{}, false
+}
+
+// parseEpoch parses a numeric timestamp in the given unit. Without a unit it
+// is derived from the magnitude, which is unambiguous for current dates.
+func parseEpoch(value, unit string) (time.Time, bool) {
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(number) || math.IsInf(number, 0) || number < 0 {
+		return time.Time{}, false
+	}
+
+	if unit == "" {
+		switch {
+		case number >= 1e17:
+			unit = layoutUnixNs
+		case number >= 1e14:
+			unit = layoutUnixUs
+		case number >= 1e11:
+			unit = layoutUnixMs
+		default:
+			unit = layoutUnix
+		}
+	}
+
+	var scale int64 = 1
+	switch unit {
+	case layoutUnix:
+		scale = 1e9
+	case layoutUnixMs:
+		scale = 1e6
+	case layoutUnixUs:
+		scale = 1e3
+	}
+
+	// Times past 2262 do not fit in nanoseconds and would wrap around.
+	whole, fraction := math.Modf(number)
+	if whole > float64(math.MaxInt64/scale) {
+		return time.Time{}, false
+	}
+
+	// Integers, such as nanoseconds, exceed float64 precision, and so does a
+	// fraction scaled with its integer part, so both are kept apart.
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if n > math.MaxInt64/scale {
+			return time.Time{}, false
+		}
+		return time.Unix(0, n*scale), true
+	}
+	nanos := int64(whole) * scale
+	fractionNanos := int64(math.Round(fraction * float64(scale)))
+	if fractionNanos > math.MaxInt64-nanos {
+		return time.Time{}, false
+	}
+	return time.Unix(0, nanos+fractionNanos), true
+}
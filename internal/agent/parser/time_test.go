@@ -0,0 +1,158 @@
+package parser
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseEpoch(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		unit  string
+		want  time.Time
+		ok    bool
+	}{
+		{"seconds", "1700000000", "", time.Unix(1700000000, 0), true},
+		{"fractional seconds", "1700000000.25", "", time.Unix(1700000000, 250000000), true},
+		{"milliseconds", "1700000000123", "", time.UnixMilli(1700000000123), true},
+		{"microseconds", "1700000000123456", "", time.UnixMicro(1700000000123456), true},
+		{"nanoseconds kept exact", "1700000000123456789", "", time.Unix(0, 1700000000123456789), true},
+		{"epoch", "0", "", time.Unix(0, 0), true},
+		{"fixed unit", "1700000000", layoutUnixMs, time.UnixMilli(1700000000), true},
+		{"fixed nanoseconds", "1700000000", layoutUnixNs, time.Unix(0, 1700000000), true},
+		{"fractional milliseconds", "1700000000123.5", "", time.Unix(0, 1700000000123500000), true},
+		{"last second in nanoseconds", "9223372036", "", time.Unix(9223372036, 0), true},
+		{"past the last nanosecond", "9223372036.9", "", time.Time{}, false},
+		{"seconds past 2262", "99999999999", "", time.Time{}, false},
+		{"milliseconds as seconds", "1700000000123", layoutUnix, time.Time{}, false},
+		{"negative", "-1", "", time.Time{}, false},
+		{"not a number", "yesterday", "", time.Time{}, false},
+		{"NaN", "NaN", "", time.Time{}, false},
+		{"infinity", "Inf", "", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseEpoch(tt.value, tt.unit)
+			if ok != tt.ok || !got.Equal(tt.want) {
+				t.Errorf("parseEpoch(%q, %q) = %v, %v; want %v, %v", tt.value, tt.unit, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestTimeParser(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("time zone database unavailable")
+	}
+	year := time.Now().UTC().Year()
+
+	tests := []struct {
+		name     string
+		layouts  []string
+		timezone string
+		value    string
+		want     time.Time
+		ok       bool
+	}{
+		{
+			name:  "RFC 3339",
+			value: "2024-03-10T12:00:00.5+01:00",
+			want:  time.Date(2024, time.March, 10, 11, 0, 0, 500000000, time.UTC),
+			ok:    true,
+		},
+		{
+			name:  "space separated",
+			value: " 2024-03-10 12:00:00.123 ",
+			want:  time.Date(2024, time.March, 10, 12, 0, 0, 123000000, time.UTC),
+			ok:    true,
+		},
+		{
+			name:     "local time in the configured zone",
+			timezone: "Europe/Berlin",
+			value:    "2024-03-10 12:00:00",
+			want:     time.Date(2024, time.March, 10, 12, 0, 0, 0, berlin),
+			ok:       true,
+		},
+		{
+			name:  "common log format",
+			value: "10/Mar/2024:12:00:00 +0100",
+			want:  time.Date(2024, time.March, 10, 11, 0, 0, 0, time.UTC),
+			ok:    true,
+		},
+		{
+			name:  "epoch detected by default",
+			value: "1700000000123",
+			want:  time.UnixMilli(1700000000123),
+			ok:    true,
+		},
+		{
+			name:    "named layout",
+			layouts: []string{"RFC1123Z"},
+			value:   "Sun, 10 Mar 2024 12:00:00 +0000",
+			want:    time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC),
+			ok:      true,
+		},
+		{
+			name:    "Go layout",
+			layouts: []string{"02.01.2006 15:04"},
+			value:   "10.03.2024 12:30",
+			want:    time.Date(2024, time.March, 10, 12, 30, 0, 0, time.UTC),
+			ok:      true,
+		},
+		{
+			name:    "first matching layout",
+			layouts: []string{"DateTime", "02.01.2006 15:04"},
+			value:   "10.03.2024 12:30",
+			want:    time.Date(2024, time.March, 10, 12, 30, 0, 0, time.UTC),
+			ok:      true,
+		},
+		{
+			name:    "layout without year",
+			layouts: []string{"Stamp"},
+			value:   "Mar 10 12:00:00",
+			want:    time.Date(year, time.March, 10, 12, 0, 0, 0, time.UTC),
+			ok:      true,
+		},
+		{
+			name:    "epoch layout",
+			layouts: []string{"DateTime", "unix_ms"},
+			value:   "1700000000123",
+			want:    time.UnixMilli(1700000000123),
+			ok:      true,
+		},
+		{
+			name:    "epoch not detected with configured layouts",
+			layouts: []string{"DateTime"},
+			value:   "1700000000",
+		},
+		{
+			name:    "no matching layout",
+			layouts: []string{"RFC3339"},
+			value:   "10.03.2024 12:30",
+		},
+		{
+			name:  "empty",
+			value: "  ",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newTimeParser(tt.layouts, tt.timezone)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := p.parse(tt.value)
+			if ok != tt.ok || !got.Equal(tt.want) {
+				t.Errorf("parse(%q) = %v, %v; want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestNewTimeParserInvalidTimezone(t *testing.T) {
+	if _, err := newTimeParser(nil, "Mars/Olympus_Mons"); err == nil {
+		t.Error("newTimeParser() succeeded, want an error")
+	}
+}
@@ -0,0 +1,131 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/mohammadhptp/pulse/pkg/models"
+)
+
+// Condition selects events. All criteria that are set must hold; All, Any and
+// Not combine nested conditions.
+type Condition struct {
+	// Field names the event field or attribute tested by Equals, In,
+	// Contains, Matches and Exists.
+	Field    string   `mapstructure:"field"`
+	Equals   string   `mapstructure:"equals"`
+	In       []string `mapstructure:"in"`
+	Contains string   `mapstructure:"contains"`
+	Matches  string   `mapstructure:"matches"`
+	Exists   *bool    `mapstructure:"exists"`
+
+	// MinLevel matches events at or above a severity level.
+	MinLevel string `mapstructure:"min_level"`
+
+	All []Condition `mapstructure:"all"`
+	Any []Condition `mapstructure:"any"`
+	Not *Condition  `mapstructure:"not"`
+}
+
+type condition struct {
+	Condition
+	matches     *regexp.Regexp
+	minSeverity uint8
+	all         []*condition
+	any         []*condition
+	not         *condition
+}
+
+func (c Condition) compile() (*condition, error) {
+	compiled := &condition{Condition: c}
+
+	usesField := c.Equals != "" || len(c.In) > 0 || c.Contains != "" || c.Matches != "" || c.Exists != nil
+	if usesField && c.Field == "" {
+		return nil, errors.New("condition requires a field")
+	}
+
+	if c.Matches != "" {
+		re, err := regexp.Compile(c.Matches)
+		if err != nil {
+			return nil, fmt.Errorf("invalid condition pattern: %w", err)
+		}
+		compiled.matches = re
+	}
+
+	if c.MinLevel != "" {
+		level, ok := models.ParseLevel(c.MinLevel)
+		if !ok {
+			return nil, fmt.Errorf("unknown level %q", c.MinLevel)
+		}
+		compiled.minSeverity = models.SeverityNumber(level)
+	}
+
+	for _, nested := range c.All {
+		n, err := nested.compile()
+		if err != nil {
+			return nil, err
+		}
+		compiled.all = append(compiled.all, n)
+	}
+	for _, nested := range c.Any {
+		n, err := nested.compile()
+		if err != nil {
+			return nil, err
+		}
+		compiled.any = append(compiled.any, n)
+	}
+	if c.Not != nil {
+		n, err := c.Not.compile()
+		if err != nil {
+			return nil, err
+		}
+		compiled.not = n
+	}
+
+	return compiled, nil
+}
+
+func (c *condition) match(e *Event) bool {
+	if c.Field != "" {
+		value, exists := e.Get(c.Field)
+		if c.Exists != nil && *c.Exists != exists {
+			return false
+		}
+		if c.Equals != "" && !strings.EqualFold(value, c.Equals) {
+			return false
+		}
+		if len(c.In) > 0 && !slices.ContainsFunc(c.In, func(s string) bool { return strings.EqualFold(s, value) }) {
+			return false
+		}
+		if c.Contains != "" && !strings.Contains(value, c.Contains) {
+			return false
+		}
+		if c.matches != nil && !c.matches.MatchString(value) {
+			return false
+		}
+	}
+
+	if c.minSeverity != 0 {
+		level, _ := models.ParseLevel(e.Level)
+		if models.SeverityNumber(level) < c.minSeverity {
+			return false
+		}
+	}
+
+	for _, nested := range c.all {
+		if !nested.match(e) {
+			return false
+		}
+	}
+	if len(c.any) > 0 && !slices.ContainsFunc(c.any, func(n *condition) bool { return n.match(e) }) {
+		return false
+	}
+	if c.not != nil && c.not.match(e) {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,105 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/mohammadhptp/pulse/pkg/models"
+)
+
+func compileCondition(t *testing.T, config map[string]interface{}) (*condition, error) {
+	t.Helper()
+	var c Condition
+	if err := decode(config, &c); err != nil {
+		return nil, err
+	}
+	return c.compile()
+}
+
+func TestConditionErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config map[string]interface{}
+	}{
+		{"criterion without field", map[string]interface{}{"equals": "api"}},
+		{"exists without field", map[string]interface{}{"exists": true}},
+		{"invalid pattern", map[string]interface{}{"field": "message", "matches": "("}},
+		{"unknown level", map[string]interface{}{"min_level": "loud"}},
+		{"unknown key", map[string]interface{}{"field": "service", "equal": "api"}},
+		{"invalid nested all", map[string]interface{}{"all": []interface{}{map[string]interface{}{"in": []interface{}{"a"}}}}},
+		{"invalid nested any", map[string]interface{}{"any": []interface{}{map[string]interface{}{"min_level": "loud"}}}},
+		{"invalid nested not", map[string]interface{}{"not": map[string]interface{}{"field": "message", "matches": "["}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := compileCondition(t, tt.config); err == nil {
+				t.Errorf("condition %v compiled, want an error", tt.config)
+			}
+		})
+	}
+}
+
+func TestConditionMatch(t *testing.T) {
+	event := &Event{Event: models.Event{
+		Service:    "api",
+		Level:      "WARN",
+		Message:    "upstream timed out after 30s",
+		Attributes: map[string]string{"region": "eu-west", "empty": ""},
+	}}
+
+	tests := []struct {
+		name   string
+		config map[string]interface{}
+		want   bool
+	}{
+		{"empty", map[string]interface{}{}, true},
+		{"equals ignoring case", map[string]interface{}{"field": "service", "equals": "API"}, true},
+		{"equals mismatch", map[string]interface{}{"field": "service", "equals": "web"}, false},
+		{"in", map[string]interface{}{"field": "service", "in": []interface{}{"web", "Api"}}, true},
+		{"not in", map[string]interface{}{"field": "service", "in": []interface{}{"web", "worker"}}, false},
+		{"contains", map[string]interface{}{"field": "message", "contains": "timed out"}, true},
+		{"contains is case sensitive", map[string]interface{}{"field": "message", "contains": "Timed"}, false},
+		{"matches", map[string]interface{}{"field": "message", "matches": `after \d+s$`}, true},
+		{"attribute", map[string]interface{}{"field": "region", "equals": "eu-west"}, true},
+		{"prefixed attribute", map[string]interface{}{"field": "attributes.region", "matches": "^eu-"}, true},
+		{"exists", map[string]interface{}{"field": "region", "exists": true}, true},
+		{"empty attribute exists", map[string]interface{}{"field": "empty", "exists": true}, true},
+		{"missing attribute", map[string]interface{}{"field": "zone", "exists": true}, false},
+		{"absent", map[string]interface{}{"field": "zone", "exists": false}, true},
+		{"empty field is absent", map[string]interface{}{"field": "host", "exists": false}, true},
+		{"min level", map[string]interface{}{"min_level": "warning"}, true},
+		{"min level above", map[string]interface{}{"min_level": "error"}, false},
+		{"all", map[string]interface{}{"all": []interface{}{
+			map[string]interface{}{"field": "service", "equals": "api"},
+			map[string]interface{}{"min_level": "info"},
+		}}, true},
+		{"all with mismatch", map[string]interface{}{"all": []interface{}{
+			map[string]interface{}{"field": "service", "equals": "api"},
+			map[string]interface{}{"min_level": "fatal"},
+		}}, false},
+		{"any", map[string]interface{}{"any": []interface{}{
+			map[string]interface{}{"field": "service", "equals": "web"},
+			map[string]interface{}{"field": "region", "equals": "eu-west"},
+		}}, true},
+		{"any without match", map[string]interface{}{"any": []interface{}{
+			map[string]interface{}{"field": "service", "equals": "web"},
+			map[string]interface{}{"min_level": "error"},
+		}}, false},
+		{"not", map[string]interface{}{"not": map[string]interface{}{"field": "service", "equals": "web"}}, true},
+		{"not matching", map[string]interface{}{"not": map[string]interface{}{"min_level": "debug"}}, false},
+		{"criteria combined", map[string]interface{}{
+			"field": "service", "equals": "api", "min_level": "warn",
+			"not": map[string]interface{}{"field": "message", "contains": "retrying"},
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := compileCondition(t, tt.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := c.match(event); got != tt.want {
+				t.Errorf("condition %v matched %v, want %v", tt.config, got, tt.want)
+			}
+		})
+	}
+}
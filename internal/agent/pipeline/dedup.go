@@ -0,0 +1,226 @@
+package pipeline
+
+import (
+	"errors"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/mohammadhptp/pulse/pkg/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultDedupWindow  = 10 * time.Second
+	defaultDedupMaxKeys = 10000
+)
+
+var defaultDedupFields = []string{"service", "host", "level", "message"}
+
+// dedup suppresses identical events seen within a window. The first of them
+// passes through unchanged, and once the window ends a summary of the
+// suppressed repeats, stamped with their number and the time of the first and
+// last one, is released to the rest of the pipeline. Only the summary is held,
+// so events already acknowledged to clients are never lost in the agent. Once
+// max_keys events are tracked, new events pass through unchanged.
+type dedup struct {
+	fields  []string
+	window  time.Duration
+	maxKeys int
+
+	mu         sync.Mutex
+	pending    map[uint64]*dedupEntry
+	suppressed uint64
+	release    func(Event) error
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+type dedupEntry struct {
+	event   Event
+	repeats uint32
+	expires time.Time
+}
+
+func newDedup(options map[string]interface{}) (Processor, error) {
+	var config struct {
+		Fields  []string      `mapstructure:"fields"`
+		Window  time.Duration `mapstructure:"window"`
+		MaxKeys int           `mapstructure:"max_keys"`
+	}
+	if err := decode(options, &config); err != nil {
+		return nil, err
+	}
+	if config.Window < 0 {
+		return nil, errors.New("dedup window must be positive")
+	}
+
+	d := &dedup{
+		fields:  config.Fields,
+		window:  config.Window,
+		maxKeys: config.MaxKeys,
+		pending: make(map[uint64]*dedupEntry),
+	}
+	if len(d.fields) == 0 {
+		d.fields = defaultDedupFields
+	}
+	if d.window == 0 {
+		d.window = defaultDedupWindow
+	}
+	if d.maxKeys <= 0 {
+		d.maxKeys = defaultDedupMaxKeys
+	}
+	return d, nil
+}
+
+func (d *dedup) Process(e *Event) bool {
+	key := d.key(e)
+	ts := eventTime(e)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Without a release function, as when the pipeline was never started or
+	// has stopped, summaries could not be released, so nothing is suppressed.
+	if d.release == nil {
+		return true
+	}
+
+	if entry, ok := d.pending[key]; ok {
+		if entry.repeats == 0 {
+			entry.event.FirstSeenMs = firstSeen(e, ts)
+			entry.event.LastSeenMs = max(e.LastSeenMs, ts)
+		} else {
+			entry.event.FirstSeenMs = min(entry.event.FirstSeenMs, firstSeen(e, ts))
+			entry.event.LastSeenMs = max(entry.event.LastSeenMs, max(e.LastSeenMs, ts))
+		}
+		entry.repeats += max(e.RepeatCount, 1)
+		d.suppressed++
+		return false
+	}
+	if len(d.pending) >= d.maxKeys {
+		return true
+	}
+
+	d.pending[key] = &dedupEntry{event: e.clone(), expires: time.Now().Add(d.window)}
+	return true
+}
+
+// DryRun passes events through, since a single event has no duplicates.
+func (d *dedup) DryRun(e *Event) bool {
+	return true
+}
+
+func (d *dedup) start(release func(Event) error) {
+	d.mu.Lock()
+	d.release = release
+	d.mu.Unlock()
+
+	d.done = make(chan struct{})
+	d.wg.Add(1)
+	go d.run()
+}
+
+// stop releases the summaries of every tracked event and returns the error of
+// those that could not be released.
+func (d *dedup) stop() error {
+	if d.done == nil {
+		return nil
+	}
+	close(d.done)
+	d.wg.Wait()
+	return d.flush(time.Time{})
+}
+
+func (d *dedup) run() {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(min(d.window, time.Second))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.done:
+			return
+		case now := <-ticker.C:
+			if err := d.flush(now); err != nil {
+				logger.Error("Failed to release repeat summaries", zap.Error(err))
+			}
+		}
+	}
+}
+
+// flush releases the summaries of the entries expired at now, or of every
+// entry when now is zero. Once stopped, later events pass through.
+func (d *dedup) flush(now time.Time) error {
+	d.mu.Lock()
+	var summaries []Event
+	for key, entry := range d.pending {
+		if !now.IsZero() && now.Before(entry.expires) {
+			continue
+		}
+		delete(d.pending, key)
+		if entry.repeats > 0 {
+			summaries = append(summaries, entry.summary())
+		}
+	}
+	release := d.release
+	if now.IsZero() {
+		d.release = nil
+	}
+	d.mu.Unlock()
+
+	var errs []error
+	for _, e := range summaries {
+		if err := release(e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// summary returns the event standing for the repeats of the entry. It is
+// timestamped at the first repeat and gets a request ID of its own.
+func (entry *dedupEntry) summary() Event {
+	e := entry.event
+	e.EventTimeMs = e.FirstSeenMs
+	e.RequestID = ""
+	e.RepeatCount = entry.repeats
+	return e
+}
+
+// key hashes the configured fields of an event.
+func (d *dedup) key(e *Event) uint64 {
+	h := fnv.New64a()
+	for _, name := range d.fields {
+		value, _ := e.Get(name)
+		h.Write([]byte(value))
+		h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
+
+// Report returns the number of tracked events and of duplicates suppressed.
+func (d *dedup) Report() interface{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return map[string]uint64{
+		"pending":    uint64(len(d.pending)),
+		"suppressed": d.suppressed,
+	}
+}
+
+func eventTime(e *Event) uint64 {
+	if e.EventTimeMs != 0 {
+		return e.EventTimeMs
+	}
+	return uint64(time.Now().UnixMilli())
+}
+
+func firstSeen(e *Event, ts uint64) uint64 {
+	if e.FirstSeenMs != 0 {
+		return min(e.FirstSeenMs, ts)
+	}
+	return ts
+}
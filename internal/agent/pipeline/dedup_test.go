@@ -0,0 +1,189 @@
+package pipeline
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mohammadhptp/pulse/pkg/models"
+)
+
+func newTestDedup(t *testing.T, options map[string]interface{}) *dedup {
+	t.Helper()
+	processor, err := newDedup(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return processor.(*dedup)
+}
+
+func TestDedupProcess(t *testing.T) {
+	type input struct {
+		message string
+		timeMs  uint64
+	}
+	tests := []struct {
+		name     string
+		maxKeys  int
+		events   []input
+		passed   []string
+		repeats  map[string]uint32
+		firstMs  map[string]uint64
+		lastMs   map[string]uint64
+		released int
+	}{
+		{
+			name:   "distinct events pass",
+			events: []input{{"a", 1}, {"b", 2}},
+			passed: []string{"a", "b"},
+		},
+		{
+			name:     "repeats are summarized",
+			events:   []input{{"a", 1}, {"a", 5}, {"b", 6}, {"a", 3}},
+			passed:   []string{"a", "b"},
+			repeats:  map[string]uint32{"a": 2},
+			firstMs:  map[string]uint64{"a": 3},
+			lastMs:   map[string]uint64{"a": 5},
+			released: 1,
+		},
+		{
+			name:    "beyond max keys",
+			maxKeys: 1,
+			events:  []input{{"a", 1}, {"b", 2}, {"b", 3}},
+			passed:  []string{"a", "b", "b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDedup(t, map[string]interface{}{"window": "1h", "max_keys": tt.maxKeys})
+			var released []Event
+			d.start(func(e Event) error {
+				released = append(released, e)
+				return nil
+			})
+
+			var passed []string
+			for _, in := range tt.events {
+				e := &Event{Event: models.Event{Service: "api", Message: in.message, EventTimeMs: in.timeMs, RequestID: "req-" + in.message}}
+				if d.Process(e) {
+					if e.RepeatCount != 0 {
+						t.Errorf("passed event %q has repeat count %d", in.message, e.RepeatCount)
+					}
+					passed = append(passed, in.message)
+				}
+			}
+			if len(passed) != len(tt.passed) {
+				t.Fatalf("passed %v, want %v", passed, tt.passed)
+			}
+			for i := range passed {
+				if passed[i] != tt.passed[i] {
+					t.Fatalf("passed %v, want %v", passed, tt.passed)
+				}
+			}
+
+			if err := d.stop(); err != nil {
+				t.Fatalf("stop: %v", err)
+			}
+			if len(released) != tt.released {
+				t.Fatalf("released %d summaries, want %d", len(released), tt.released)
+			}
+			for _, e := range released {
+				if e.RepeatCount != tt.repeats[e.Message] || e.FirstSeenMs != tt.firstMs[e.Message] || e.LastSeenMs != tt.lastMs[e.Message] {
+					t.Errorf("summary of %q = %d repeats %d-%d, want %d repeats %d-%d", e.Message,
+						e.RepeatCount, e.FirstSeenMs, e.LastSeenMs, tt.repeats[e.Message], tt.firstMs[e.Message], tt.lastMs[e.Message])
+				}
+				if e.EventTimeMs != e.FirstSeenMs || e.RequestID != "" {
+					t.Errorf("summary of %q has time %d and request ID %q", e.Message, e.EventTimeMs, e.RequestID)
+				}
+			}
+		})
+	}
+}
+
+func TestDedupFlushExpired(t *testing.T) {
+	d := newTestDedup(t, map[string]interface{}{"window": "1m"})
+	var released []Event
+	d.release = func(e Event) error {
+		released = append(released, e)
+		return nil
+	}
+
+	for range 3 {
+		d.Process(&Event{Event: models.Event{Message: "a", EventTimeMs: 1}})
+	}
+	d.Process(&Event{Event: models.Event{Message: "b", EventTimeMs: 1}})
+
+	if err := d.flush(time.Now()); err != nil || len(released) != 0 {
+		t.Fatalf("flush before the window ended released %d summaries, err %v", len(released), err)
+	}
+	if err := d.flush(time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if len(released) != 1 || released[0].Message != "a" || released[0].RepeatCount != 2 {
+		t.Fatalf("released %+v, want one summary of 2 repeats of a", released)
+	}
+	if len(d.pending) != 0 {
+		t.Errorf("%d entries left after the window ended", len(d.pending))
+	}
+
+	// The next occurrence starts a new window and passes through.
+	if !d.Process(&Event{Event: models.Event{Message: "a", EventTimeMs: 2}}) {
+		t.Error("event after the window ended was suppressed")
+	}
+}
+
+func TestDedupStopReturnsReleaseError(t *testing.T) {
+	d := newTestDedup(t, nil)
+	failure := errors.New("kafka unavailable")
+	d.start(func(Event) error { return failure })
+
+	d.Process(&Event{Event: models.Event{Message: "a"}})
+	d.Process(&Event{Event: models.Event{Message: "a"}})
+
+	if err := d.stop(); !errors.Is(err, failure) {
+		t.Fatalf("stop() = %v, want %v", err, failure)
+	}
+	if !d.Process(&Event{Event: models.Event{Message: "a"}}) {
+		t.Error("event after stop was suppressed")
+	}
+}
+
+func TestPipelineStopReleasesSummaries(t *testing.T) {
+	p, err := New([]map[string]interface{}{
+		{"type": "dedup", "window": "1h"},
+		{"type": "add_fields", "fields": map[string]interface{}{"stage": "after"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var written []Event
+	p.Start(func(e Event) error {
+		written = append(written, e)
+		return nil
+	})
+
+	for range 3 {
+		if e, kept := p.Process(models.Event{Service: "api", Message: "retrying"}); kept {
+			written = append(written, e)
+		}
+	}
+	if len(written) != 1 {
+		t.Fatalf("%d events written before stop, want the first occurrence only", len(written))
+	}
+
+	if err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if len(written) != 2 || written[1].RepeatCount != 2 || written[1].Attributes["stage"] != "after" {
+		t.Fatalf("written %+v, want a summary of 2 repeats through the rest of the pipeline", written)
+	}
+
+	p, _ = New([]map[string]interface{}{{"type": "dedup"}})
+	p.Start(func(Event) error { return errors.New("write failed") })
+	p.Process(models.Event{Message: "x"})
+	p.Process(models.Event{Message: "x"})
+	if err := p.Stop(); err == nil {
+		t.Error("Stop() succeeded although the summary could not be written")
+	}
+}
@@ -0,0 +1,90 @@
+package pipeline
+
+import (
+	"net/netip"
+	"regexp"
+	"strings"
+)
+
+// detector finds a kind of sensitive value. Candidates matched by re are
+// confirmed by validate, when set, to keep false positives down.
+type detector struct {
+	re       *regexp.Regexp
+	validate func(string) bool
+}
+
+// detectors are the built-in redaction detectors, by name.
+var detectors = map[string]detector{
+	"email": {
+		re: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`),
+	},
+	"credit_card": {
+		re:       regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		validate: luhn,
+	},
+	"jwt": {
+		re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),
+	},
+	"bearer_token": {
+		re: regexp.MustCompile(`(?i)\bbearer\s+(?P<redact>[A-Za-z0-9\-._~+/]+=*)`),
+	},
+	"aws_access_key": {
+		re: regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[A-Z0-9]{16}\b`),
+	},
+	"api_key": {
+		re: regexp.MustCompile(strings.Join([]string{
+			`\bgh[pousr]_[A-Za-z0-9]{36,}\b`,
+			`\bgithub_pat_[A-Za-z0-9_]{22,}\b`,
+			`\bxox[abposr]-[A-Za-z0-9-]{10,}`,
+			`\b[rs]k_(?:live|test)_[A-Za-z0-9]{16,}\b`,
+			`\bAIza[0-9A-Za-z_-]{35}\b`,
+			`\bglpat-[A-Za-z0-9_-]{20,}\b`,
+			`(?i)aws_secret_access_key["']?\s*[:=]\s*["']?(?P<redact>[A-Za-z0-9/+=]{40})`,
+		}, "|")),
+	},
+	"ipv4": {
+		re:       regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`),
+		validate: isIPv4,
+	},
+	// Candidates are whole tokens of word characters, dots, colons and zone
+	// separators, so that "::" in identifiers such as std::vector is never
+	// matched on its own. A trailing dot ends a sentence, not the address.
+	"ipv6": {
+		re:       regexp.MustCompile(`[0-9A-Za-z_.%:]*:[0-9A-Za-z_%:]*(?:\.[0-9A-Za-z_%:]+)*`),
+		validate: isIPv6,
+	},
+}
+
+// luhn validates a card number candidate, ignoring separators.
+func luhn(candidate string) bool {
+	sum, digits := 0, 0
+	for i := len(candidate) - 1; i >= 0; i-- {
+		c := candidate[i]
+		if c == ' ' || c == '-' {
+			continue
+		}
+
+		d := int(c - '0')
+		if digits%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+	}
+	return digits >= 13 && digits <= 19 && sum%10 == 0
+}
+
+func isIPv4(candidate string) bool {
+	addr, err := netip.ParseAddr(candidate)
+	return err == nil && addr.Is4()
+}
+
+// isIPv6 validates an address candidate. Addresses without any digit, such as
+// a::b, are rejected as they are more likely identifiers.
+func isIPv6(candidate string) bool {
+	addr, err := netip.ParseAddr(candidate)
+	return err == nil && addr.Is6() && strings.ContainsAny(candidate, "0123456789")
+}
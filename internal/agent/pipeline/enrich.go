@@ -0,0 +1,208 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// geoIPLanguage is the language of the country and city names set by GeoIP
+// enrichment.
+const geoIPLanguage = "en"
+
+// enrich adds data the client does not send: the address of the sender, the
+// agent hostname, static labels, rows of lookup tables and the GeoIP location
+// of IP addresses, all as attributes. GeoIP runs last, so that it can locate
+// the sender address and addresses set by lookups.
+type enrich struct {
+	remoteAddr string
+	hostname   string
+	host       string
+	labels     fieldMap
+	lookups    []*lookupTable
+	geoIP      *geoIP
+
+	lookupHits   atomic.Uint64
+	lookupMisses atomic.Uint64
+}
+
+type geoIP struct {
+	reader *maxminddb.Reader
+	fields []string
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// geoRecord is the subset of a GeoIP2 or GeoLite2 City or Country record set
+// on events.
+type geoRecord struct {
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+func newEnrich(options map[string]interface{}) (Processor, error) {
+	var config struct {
+		RemoteAddr string            `mapstructure:"remote_addr"`
+		Hostname   string            `mapstructure:"hostname"`
+		Labels     map[string]string `mapstructure:"labels"`
+		Lookups    []lookupConfig    `mapstructure:"lookups"`
+		GeoIP      *struct {
+			Database string   `mapstructure:"database"`
+			Fields   []string `mapstructure:"fields"`
+		} `mapstructure:"geoip"`
+	}
+	if err := decode(options, &config); err != nil {
+		return nil, err
+	}
+	if config.RemoteAddr == "" && config.Hostname == "" && len(config.Labels) == 0 &&
+		len(config.Lookups) == 0 && config.GeoIP == nil {
+		return nil, errors.New("enrich requires remote_addr, hostname, labels, lookups or geoip")
+	}
+
+	e := &enrich{
+		remoteAddr: config.RemoteAddr,
+		hostname:   config.Hostname,
+		labels:     newFieldMap(config.Labels),
+	}
+
+	if e.hostname != "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("resolving hostname: %w", err)
+		}
+		e.host = host
+	}
+
+	for i, c := range config.Lookups {
+		table, err := newLookupTable(c)
+		if err != nil {
+			return nil, fmt.Errorf("lookup %d: %w", i, err)
+		}
+		e.lookups = append(e.lookups, table)
+	}
+
+	if g := config.GeoIP; g != nil {
+		if g.Database == "" || len(g.Fields) == 0 {
+			return nil, errors.New("geoip requires a database and fields")
+		}
+		reader, err := maxminddb.Open(g.Database)
+		if err != nil {
+			return nil, fmt.Errorf("opening GeoIP database: %w", err)
+		}
+		e.geoIP = &geoIP{reader: reader, fields: g.Fields}
+	}
+
+	return e, nil
+}
+
+func (e *enrich) Process(event *Event) bool {
+	return e.enrich(event, true)
+}
+
+func (e *enrich) DryRun(event *Event) bool {
+	return e.enrich(event, false)
+}
+
+// enrich adds the configured data to an event, counting lookup and GeoIP
+// results when record is set.
+func (e *enrich) enrich(event *Event, record bool) bool {
+	if e.remoteAddr != "" && event.RemoteAddr != "" {
+		event.Set(attributePrefix+e.remoteAddr, event.RemoteAddr)
+	}
+	if e.hostname != "" {
+		event.Set(attributePrefix+e.hostname, e.host)
+	}
+	for _, name := range e.labels.names {
+		event.Set(attributePrefix+name, e.labels.values[name])
+	}
+
+	for _, table := range e.lookups {
+		hit := table.apply(event)
+		switch {
+		case !record:
+		case hit:
+			e.lookupHits.Add(1)
+		default:
+			e.lookupMisses.Add(1)
+		}
+	}
+
+	if e.geoIP != nil {
+		e.geoIP.apply(event, record)
+	}
+	return true
+}
+
+// apply sets the country code, country and city of the IP address in each
+// field as attributes named after the field, such as client.ip.geo.city.
+// Private and unknown addresses are skipped.
+func (g *geoIP) apply(e *Event, record bool) {
+	for _, field := range g.fields {
+		value, ok := e.Get(field)
+		if !ok {
+			continue
+		}
+		addr, err := netip.ParseAddr(value)
+		if err != nil || !addr.IsGlobalUnicast() || addr.IsPrivate() {
+			continue
+		}
+
+		var geo geoRecord
+		if err := g.reader.Lookup(net.IP(addr.AsSlice()), &geo); err != nil || geo.Country.ISOCode == "" {
+			if record {
+				g.misses.Add(1)
+			}
+			continue
+		}
+		if record {
+			g.hits.Add(1)
+		}
+
+		prefix := attributePrefix + strings.TrimPrefix(field, attributePrefix) + ".geo."
+		e.Set(prefix+"country_code", geo.Country.ISOCode)
+		if name := geo.Country.Names[geoIPLanguage]; name != "" {
+			e.Set(prefix+"country", name)
+		}
+		if name := geo.City.Names[geoIPLanguage]; name != "" {
+			e.Set(prefix+"city", name)
+		}
+	}
+}
+
+// Close closes the GeoIP database.
+func (e *enrich) Close() error {
+	if e.geoIP == nil {
+		return nil
+	}
+	return e.geoIP.reader.Close()
+}
+
+// Report returns the number of events that matched and missed lookup tables
+// and the GeoIP database.
+func (e *enrich) Report() interface{} {
+	report := map[string]uint64{}
+	if len(e.lookups) > 0 {
+		report["lookup_hits"] = e.lookupHits.Load()
+		report["lookup_misses"] = e.lookupMisses.Load()
+	}
+	if e.geoIP != nil {
+		report["geoip_hits"] = e.geoIP.hits.Load()
+		report["geoip_misses"] = e.geoIP.misses.Load()
+	}
+	if len(report) == 0 {
+		return nil
+	}
+	return report
+}
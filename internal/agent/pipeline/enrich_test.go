@@ -0,0 +1,116 @@
+package pipeline
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mohammadhptp/pulse/pkg/models"
+)
+
+func TestNewEnrichErrors(t *testing.T) {
+	dir := t.TempDir()
+	table := filepath.Join(dir, "teams.csv")
+	if err := os.WriteFile(table, []byte("service,team\napi,payments\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	yaml := filepath.Join(dir, "teams.yaml")
+	if err := os.WriteFile(yaml, []byte("api: payments\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		options map[string]interface{}
+	}{
+		{"nothing to add", map[string]interface{}{}},
+		{"lookup without field", map[string]interface{}{"lookups": []interface{}{map[string]interface{}{"file": table}}}},
+		{"missing lookup file", map[string]interface{}{"lookups": []interface{}{map[string]interface{}{"file": filepath.Join(dir, "missing.csv"), "field": "service"}}}},
+		{"unknown lookup format", map[string]interface{}{"lookups": []interface{}{map[string]interface{}{"file": yaml, "field": "service"}}}},
+		{"unknown key column", map[string]interface{}{"lookups": []interface{}{map[string]interface{}{"file": table, "field": "service", "key": "owner"}}}},
+		{"geoip without fields", map[string]interface{}{"geoip": map[string]interface{}{"database": filepath.Join(dir, "GeoLite2-City.mmdb")}}},
+		{"missing geoip database", map[string]interface{}{"geoip": map[string]interface{}{"database": filepath.Join(dir, "GeoLite2-City.mmdb"), "fields": []interface{}{"client.ip"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newEnrich(tt.options); err == nil {
+				t.Errorf("newEnrich(%v) succeeded, want an error", tt.options)
+			}
+		})
+	}
+}
+
+func TestEnrichLookups(t *testing.T) {
+	dir := t.TempDir()
+	teams := filepath.Join(dir, "teams.CSV")
+	if err := os.WriteFile(teams, []byte("team,service,owner\npayments,api,alice\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	hosts := filepath.Join(dir, "hosts.json")
+	if err := os.WriteFile(hosts, []byte(`{"web-1": {"rack": "r12", "zone": "a"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	processor, err := newEnrich(map[string]interface{}{
+		"labels": map[string]interface{}{"env": "production"},
+		"lookups": []interface{}{
+			map[string]interface{}{"file": teams, "field": "service", "key": "service", "columns": []interface{}{"team"}},
+			map[string]interface{}{"file": hosts, "field": "host", "prefix": "host."},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := processor.(*enrich)
+
+	event := &Event{Event: models.Event{Service: "api", Host: "web-1"}}
+	if !e.Process(event) {
+		t.Fatal("Process() dropped the event")
+	}
+	want := map[string]string{"env": "production", "team": "payments", "host.rack": "r12", "host.zone": "a"}
+	if !reflect.DeepEqual(event.Attributes, want) {
+		t.Errorf("attributes = %v, want %v", event.Attributes, want)
+	}
+
+	e.Process(&Event{Event: models.Event{Service: "worker"}})
+	e.DryRun(&Event{Event: models.Event{Service: "api"}})
+	wantReport := map[string]uint64{"lookup_hits": 2, "lookup_misses": 2}
+	if got := e.Report(); !reflect.DeepEqual(got, wantReport) {
+		t.Errorf("Report() = %v, want %v", got, wantReport)
+	}
+
+	if err := e.Close(); err != nil {
+		t.Errorf("Close() = %v, want nil without a GeoIP database", err)
+	}
+}
+
+type closingProcessor struct {
+	err    error
+	closed bool
+}
+
+func (c *closingProcessor) Process(*Event) bool { return true }
+
+func (c *closingProcessor) Close() error {
+	c.closed = true
+	return c.err
+}
+
+func TestPipelineStopClosesProcessors(t *testing.T) {
+	ok := &closingProcessor{}
+	failing := &closingProcessor{err: errors.New("busy")}
+	p := &Pipeline{stages: []*stage{
+		{name: "ok", processor: ok},
+		{name: "next", processor: &closingProcessor{}},
+		{name: "failing", processor: failing},
+	}}
+
+	if err := p.Stop(); err == nil {
+		t.Error("Stop() succeeded although a processor failed to close")
+	}
+	if !ok.closed || !failing.closed {
+		t.Errorf("closed = %v, %v, want every processor closed", ok.closed, failing.closed)
+	}
+}
@@ -0,0 +1,63 @@
+package pipeline
+
+import "strings"
+
+// attributePrefix addresses attributes explicitly. Names that are not event
+// fields address attributes as well.
+const attributePrefix = "attributes."
+
+// field returns a pointer to the event field with the given name, or nil when
+// the name addresses an attribute.
+func (e *Event) field(name string) *string {
+	switch name {
+	case "service":
+		return &e.Service
+	case "level":
+		return &e.Level
+	case "message":
+		return &e.Message
+	case "host":
+		return &e.Host
+	case "request_id":
+		return &e.RequestID
+	case "trace_id":
+		return &e.TraceID
+	case "span_id":
+		return &e.SpanID
+	case "topic":
+		return &e.Topic
+	case "remote_addr":
+		return &e.RemoteAddr
+	}
+	return nil
+}
+
+// Get returns the value of an event field or attribute.
+func (e *Event) Get(name string) (string, bool) {
+	if f := e.field(name); f != nil {
+		return *f, *f != ""
+	}
+	value, ok := e.Attributes[strings.TrimPrefix(name, attributePrefix)]
+	return value, ok
+}
+
+// Set sets an event field or attribute.
+func (e *Event) Set(name, value string) {
+	if f := e.field(name); f != nil {
+		*f = value
+		return
+	}
+	if e.Attributes == nil {
+		e.Attributes = make(map[string]string)
+	}
+	e.Attributes[strings.TrimPrefix(name, attributePrefix)] = value
+}
+
+// Delete clears an event field or removes an attribute.
+func (e *Event) Delete(name string) {
+	if f := e.field(name); f != nil {
+		*f = ""
+		return
+	}
+	delete(e.Attributes, strings.TrimPrefix(name, attributePrefix))
+}
@@ -0,0 +1,161 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/mohammadhptp/pulse/pkg/models"
+)
+
+type lookupConfig struct {
+	File    string   `mapstructure:"file"`
+	Field   string   `mapstructure:"field"`
+	Key     string   `mapstructure:"key"`
+	Columns []string `mapstructure:"columns"`
+	Prefix  string   `mapstructure:"prefix"`
+}
+
+// lookupTable maps the value of an event field to attributes, loaded once from
+// a CSV or JSON file.
+type lookupTable struct {
+	field   string
+	columns []string
+	prefix  string
+	rows    map[string]map[string]string
+}
+
+func newLookupTable(config lookupConfig) (*lookupTable, error) {
+	if config.File == "" || config.Field == "" {
+		return nil, errors.New("a lookup requires a file and a field")
+	}
+
+	data, err := os.ReadFile(config.File)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows map[string]map[string]string
+	switch strings.ToLower(filepath.Ext(config.File)) {
+	case ".csv":
+		rows, err = loadCSVTable(data, config.Key)
+	case ".json":
+		rows, err = loadJSONTable(data, config.Key)
+	default:
+		return nil, fmt.Errorf("lookup file %q is neither CSV nor JSON", config.File)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lookup file %q: %w", config.File, err)
+	}
+
+	return &lookupTable{
+		field:   config.Field,
+		columns: config.Columns,
+		prefix:  config.Prefix,
+		rows:    rows,
+	}, nil
+}
+
+// loadCSVTable reads a CSV file with a header row, keyed by the key column or
+// by the first column.
+func loadCSVTable(data []byte, key string) (map[string]map[string]string, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+
+	keyIndex := 0
+	if key != "" {
+		if keyIndex = slices.Index(header, key); keyIndex < 0 {
+			return nil, fmt.Errorf("no %q column", key)
+		}
+	}
+
+	rows := make(map[string]map[string]string)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		row := make(map[string]string, len(header)-1)
+		for i, name := range header {
+			if i != keyIndex {
+				row[name] = record[i]
+			}
+		}
+		rows[record[keyIndex]] = row
+	}
+}
+
+// loadJSONTable reads either an object mapping keys to objects, or an array of
+// objects keyed by their key field. Nested values are flattened into dotted
+// names.
+func loadJSONTable(data []byte, key string) (map[string]map[string]string, error) {
+	rows := make(map[string]map[string]string)
+
+	var byKey map[string]map[string]interface{}
+	if err := json.Unmarshal(data, &byKey); err == nil {
+		for k, document := range byKey {
+			rows[k] = models.FlattenDocument(document)
+		}
+		return rows, nil
+	}
+
+	var documents []map[string]interface{}
+	if err := json.Unmarshal(data, &documents); err != nil {
+		return nil, errors.New("expected an object of objects or an array of objects")
+	}
+	if key == "" {
+		return nil, errors.New("an array of objects requires a key")
+	}
+	for i, document := range documents {
+		row := models.FlattenDocument(document)
+		k, ok := row[key]
+		if !ok {
+			return nil, fmt.Errorf("object %d has no %q field", i, key)
+		}
+		delete(row, key)
+		rows[k] = row
+	}
+	return rows, nil
+}
+
+// apply sets the columns of the row matching the event as attributes and
+// reports whether a row matched.
+func (t *lookupTable) apply(e *Event) bool {
+	value, ok := e.Get(t.field)
+	if !ok {
+		return false
+	}
+	row, ok := t.rows[value]
+	if !ok {
+		return false
+	}
+
+	if len(t.columns) == 0 {
+		for name, v := range row {
+			e.Set(attributePrefix+t.prefix+name, v)
+		}
+		return true
+	}
+	for _, name := range t.columns {
+		if v, ok := row[name]; ok {
+			e.Set(attributePrefix+t.prefix+name, v)
+		}
+	}
+	return true
+}
@@ -0,0 +1,171 @@
+package pipeline
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mohammadhptp/pulse/pkg/models"
+)
+
+func TestLoadCSVTable(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		key  string
+		want map[string]map[string]string
+	}{
+		{
+			name: "first column",
+			data: "service,team,owner\napi, payments, alice\nworker,platform,bob\n",
+			want: map[string]map[string]string{
+				"api":    {"team": "payments", "owner": "alice"},
+				"worker": {"team": "platform", "owner": "bob"},
+			},
+		},
+		{
+			name: "key column",
+			data: "team,service\npayments,api\nplatform,worker\n",
+			key:  "service",
+			want: map[string]map[string]string{
+				"api":    {"team": "payments"},
+				"worker": {"team": "platform"},
+			},
+		},
+		{
+			name: "last row wins",
+			data: "service,team\napi,payments\napi,platform\n",
+			want: map[string]map[string]string{"api": {"team": "platform"}},
+		},
+		{
+			name: "header only",
+			data: "service,team\n",
+			want: map[string]map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadCSVTable([]byte(tt.data), tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadCSVTable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadCSVTableErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		key  string
+	}{
+		{"empty", "", ""},
+		{"missing key column", "service,team\napi,payments\n", "owner"},
+		{"short row", "service,team\napi\n", ""},
+		{"unterminated quote", "service,team\n\"api,payments\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := loadCSVTable([]byte(tt.data), tt.key); err == nil {
+				t.Errorf("loadCSVTable(%q, %q) succeeded, want an error", tt.data, tt.key)
+			}
+		})
+	}
+}
+
+func TestLoadJSONTable(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		key  string
+		want map[string]map[string]string
+	}{
+		{
+			name: "object of objects",
+			data: `{"api": {"team": "payments", "oncall": {"primary": "alice"}}, "worker": {"team": "platform", "tier": 2}}`,
+			want: map[string]map[string]string{
+				"api":    {"team": "payments", "oncall.primary": "alice"},
+				"worker": {"team": "platform", "tier": "2"},
+			},
+		},
+		{
+			name: "array of objects",
+			data: `[{"service": "api", "team": "payments"}, {"service": "worker", "team": "platform", "tags": ["batch"]}]`,
+			key:  "service",
+			want: map[string]map[string]string{
+				"api":    {"team": "payments"},
+				"worker": {"team": "platform", "tags": `["batch"]`},
+			},
+		},
+		{
+			name: "numeric key",
+			data: `[{"code": 404, "reason": "not found"}]`,
+			key:  "code",
+			want: map[string]map[string]string{"404": {"reason": "not found"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadJSONTable([]byte(tt.data), tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadJSONTable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadJSONTableErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		key  string
+	}{
+		{"invalid", `{"api":`, ""},
+		{"object of strings", `{"api": "payments"}`, ""},
+		{"array without key", `[{"service": "api"}]`, ""},
+		{"object missing key", `[{"service": "api"}, {"team": "platform"}]`, "service"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := loadJSONTable([]byte(tt.data), tt.key); err == nil {
+				t.Errorf("loadJSONTable(%q, %q) succeeded, want an error", tt.data, tt.key)
+			}
+		})
+	}
+}
+
+func TestLookupTableApply(t *testing.T) {
+	rows := map[string]map[string]string{
+		"api": {"team": "payments", "owner": "alice"},
+	}
+	tests := []struct {
+		name    string
+		columns []string
+		prefix  string
+		service string
+		hit     bool
+		want    map[string]string
+	}{
+		{"all columns", nil, "", "api", true, map[string]string{"team": "payments", "owner": "alice"}},
+		{"selected columns", []string{"team", "missing"}, "", "api", true, map[string]string{"team": "payments"}},
+		{"prefix", []string{"owner"}, "lookup.", "api", true, map[string]string{"lookup.owner": "alice"}},
+		{"miss", nil, "", "worker", false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := &lookupTable{field: "service", columns: tt.columns, prefix: tt.prefix, rows: rows}
+			e := &Event{Event: models.Event{Service: tt.service}}
+			if got := table.apply(e); got != tt.hit {
+				t.Errorf("apply() = %v, want %v", got, tt.hit)
+			}
+			if !reflect.DeepEqual(e.Attributes, tt.want) {
+				t.Errorf("attributes = %v, want %v", e.Attributes, tt.want)
+			}
+		})
+	}
+}
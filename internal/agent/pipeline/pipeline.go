@@ -0,0 +1,345 @@
+// Package pipeline runs agent events through a chain of declaratively
+// configured processors before they are written to Kafka.
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/mohammadhptp/pulse/pkg/models"
+)
+
+// Event is an event passing through the pipeline.
+type Event struct {
+	models.Event
+	// Topic overrides the Kafka topic the event is written to.
+	Topic string `json:"topic,omitempty"`
+}
+
+// Processor transforms an event in place. Returning false drops the event.
+type Processor interface {
+	Process(event *Event) bool
+}
+
+// Reporter is implemented by processors with counters beyond the ones kept for
+// every processor. The report is included in the pipeline stats.
+type Reporter interface {
+	Report() interface{}
+}
+
+// dryRunner is implemented by processors with side effects, such as counters
+// or buffered state, that a dry run must not trigger.
+type dryRunner interface {
+	DryRun(event *Event) bool
+}
+
+// holder is implemented by processors that hold events back to release them
+// later, such as dedup. Returning false from Process holds the event instead
+// of dropping it; released events continue with the next processor. stop
+// releases every held event and returns the error of those that could not be
+// written.
+type holder interface {
+	start(release func(Event) error)
+	stop() error
+}
+
+// Factory builds a processor from the type specific options of its config.
+type Factory func(options map[string]interface{}) (Processor, error)
+
+var factories = map[string]Factory{
+	"rename":      newRename,
+	"drop_fields": newDropFields,
+	"add_fields":  newAddFields,
+	"defaults":    newDefaults,
+	"route":       newRoute,
+	"drop":        newDrop,
+	"sample":      newSample,
+	"redact":      newRedact,
+	"dedup":       newDedup,
+	"enrich":      newEnrich,
+}
+
+// processorConfig holds the settings shared by all processors. Everything else
+// is passed to the factory of the processor type.
+type processorConfig struct {
+	Type    string                 `mapstructure:"type"`
+	Name    string                 `mapstructure:"name"`
+	When    *Condition             `mapstructure:"when"`
+	Options map[string]interface{} `mapstructure:",remain"`
+}
+
+type stage struct {
+	name      string
+	typ       string
+	when      *condition
+	processor Processor
+	holds     bool
+
+	in      atomic.Uint64
+	out     atomic.Uint64
+	dropped atomic.Uint64
+	held    atomic.Uint64
+}
+
+// Pipeline is an ordered chain of processors.
+type Pipeline struct {
+	stages []*stage
+	output func(Event) error
+}
+
+// New builds a pipeline from processor configurations, each a map with a
+// type, an optional name and when condition, and the options of the type.
+func New(configs []map[string]interface{}) (*Pipeline, error) {
+	p := &Pipeline{}
+	for i, raw := range configs {
+		var config processorConfig
+		if err := decode(raw, &config); err != nil {
+			return nil, fmt.Errorf("processor %d: %w", i, err)
+		}
+
+		factory, ok := factories[config.Type]
+		if !ok {
+			return nil, fmt.Errorf("processor %d: unknown type %q", i, config.Type)
+		}
+		if config.Name == "" {
+			config.Name = fmt.Sprintf("%s-%d", config.Type, i)
+		}
+
+		processor, err := factory(config.Options)
+		if err != nil {
+			p.close()
+			return nil, fmt.Errorf("processor %q: %w", config.Name, err)
+		}
+
+		s := &stage{name: config.Name, typ: config.Type, processor: processor}
+		_, s.holds = processor.(holder)
+		if config.When != nil {
+			if s.when, err = config.When.compile(); err != nil {
+				closeProcessor(processor)
+				p.close()
+				return nil, fmt.Errorf("processor %q: %w", config.Name, err)
+			}
+		}
+		p.stages = append(p.stages, s)
+	}
+	return p, nil
+}
+
+// decode decodes processor options, rejecting unknown keys so that typos in
+// the configuration are reported rather than ignored.
+func decode(input interface{}, output interface{}) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       mapstructure.StringToTimeDurationHookFunc(),
+		ErrorUnused:      true,
+		WeaklyTypedInput: true,
+		Result:           output,
+	})
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(input)
+}
+
+// Len returns the number of processors in the pipeline.
+func (p *Pipeline) Len() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.stages)
+}
+
+// Process runs an event through every processor and reports whether it was
+// kept.
+func (p *Pipeline) Process(event models.Event) (Event, bool) {
+	e := Event{Event: event}
+	if p == nil {
+		return e, true
+	}
+
+	return e, p.run(0, &e)
+}
+
+// run passes an event through the processors starting at index from.
+func (p *Pipeline) run(from int, e *Event) bool {
+	for _, s := range p.stages[from:] {
+		s.in.Add(1)
+		if s.when != nil && !s.when.match(e) {
+			s.out.Add(1)
+			continue
+		}
+		if !s.processor.Process(e) {
+			if s.holds {
+				s.held.Add(1)
+			} else {
+				s.dropped.Add(1)
+			}
+			return false
+		}
+		s.out.Add(1)
+	}
+	return true
+}
+
+// Start sets the output of events released by processors holding them back.
+// Released events pass through the rest of the pipeline before reaching
+// output.
+func (p *Pipeline) Start(output func(Event) error) {
+	if p == nil {
+		return
+	}
+
+	p.output = output
+	for i, s := range p.stages {
+		if h, ok := s.processor.(holder); ok {
+			index := i
+			h.start(func(e Event) error { return p.release(index, e) })
+		}
+	}
+}
+
+// Stop releases every held event, in pipeline order so that events released
+// into a later holder are released by it as well, then closes the processors
+// holding resources such as the GeoIP database. It returns the error of the
+// events that could not be written or the processors that failed to close.
+func (p *Pipeline) Stop() error {
+	if p == nil {
+		return nil
+	}
+
+	var errs []error
+	for _, s := range p.stages {
+		if h, ok := s.processor.(holder); ok {
+			if err := h.stop(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if err := p.close(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// close closes the processors implementing io.Closer.
+func (p *Pipeline) close() error {
+	var errs []error
+	for _, s := range p.stages {
+		if err := closeProcessor(s.processor); err != nil {
+			errs = append(errs, fmt.Errorf("processor %q: closing: %w", s.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func closeProcessor(processor Processor) error {
+	if c, ok := processor.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (p *Pipeline) release(index int, e Event) error {
+	p.stages[index].out.Add(1)
+	if !p.run(index+1, &e) {
+		return nil
+	}
+
+	if err := p.output(e); err != nil {
+		return fmt.Errorf("processor %q: writing released %s event: %w", p.stages[index].name, e.Service, err)
+	}
+	return nil
+}
+
+// Step is the outcome of one processor in a dry run.
+type Step struct {
+	Processor string `json:"processor"`
+	Type      string `json:"type"`
+	Skipped   bool   `json:"skipped,omitempty"`
+	Dropped   bool   `json:"dropped,omitempty"`
+	Event     *Event `json:"event,omitempty"`
+}
+
+// DryRun runs a copy of an event through the pipeline without updating the
+// counters and records the event after every processor. Sampling decisions are random, as
+// they are for real events.
+func (p *Pipeline) DryRun(event models.Event) ([]Step, Event, bool) {
+	e := Event{Event: event}.clone()
+	steps := []Step{}
+	if p == nil {
+		return steps, e, true
+	}
+
+	for _, s := range p.stages {
+		step := Step{Processor: s.name, Type: s.typ}
+		if s.when != nil && !s.when.match(&e) {
+			step.Skipped = true
+			steps = append(steps, step)
+			continue
+		}
+
+		process := s.processor.Process
+		if d, ok := s.processor.(dryRunner); ok {
+			process = d.DryRun
+		}
+		if !process(&e) {
+			step.Dropped = true
+			steps = append(steps, step)
+			return steps, e, false
+		}
+
+		snapshot := e.clone()
+		step.Event = &snapshot
+		steps = append(steps, step)
+	}
+	return steps, e, true
+}
+
+// Stats are the counters of a processor.
+type Stats struct {
+	Processor string `json:"processor"`
+	Type      string `json:"type"`
+	In        uint64 `json:"in"`
+	Out       uint64 `json:"out"`
+	Dropped   uint64 `json:"dropped"`
+	Held      uint64 `json:"held,omitempty"`
+
+	Report interface{} `json:"report,omitempty"`
+}
+
+// Stats returns the counters of every processor, in pipeline order.
+func (p *Pipeline) Stats() []Stats {
+	stats := []Stats{}
+	if p == nil {
+		return stats
+	}
+
+	for _, s := range p.stages {
+		stat := Stats{
+			Processor: s.name,
+			Type:      s.typ,
+			In:        s.in.Load(),
+			Out:       s.out.Load(),
+			Dropped:   s.dropped.Load(),
+			Held:      s.held.Load(),
+		}
+		if reporter, ok := s.processor.(Reporter); ok {
+			stat.Report = reporter.Report()
+		}
+		stats = append(stats, stat)
+	}
+	return stats
+}
+
+func (e Event) clone() Event {
+	if e.Attributes != nil {
+		attributes := make(map[string]string, len(e.Attributes))
+		for name, value := range e.Attributes {
+			attributes[name] = value
+		}
+		e.Attributes = attributes
+	}
+	return e
+}
@@ -0,0 +1,184 @@
+package pipeline
+
+import (
+	"errors"
+	"sort"
+)
+
+// fieldMap holds name pairs in a stable order, so that processors touching
+// several fields behave the same on every event.
+type fieldMap struct {
+	names  []string
+	values map[string]string
+}
+
+func newFieldMap(fields map[string]string) fieldMap {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fieldMap{names: names, values: fields}
+}
+
+// rename moves fields to new names, overwriting the target.
+type rename struct {
+	fields fieldMap
+}
+
+func newRename(options map[string]interface{}) (Processor, error) {
+	var config struct {
+		Fields map[string]string `mapstructure:"fields"`
+	}
+	if err := decode(options, &config); err != nil {
+		return nil, err
+	}
+	if len(config.Fields) == 0 {
+		return nil, errors.New("rename requires fields")
+	}
+	return &rename{fields: newFieldMap(config.Fields)}, nil
+}
+
+func (r *rename) Process(e *Event) bool {
+	for _, from := range r.fields.names {
+		if value, ok := e.Get(from); ok {
+			e.Delete(from)
+			e.Set(r.fields.values[from], value)
+		}
+	}
+	return true
+}
+
+// dropFields removes fields and attributes.
+type dropFields struct {
+	fields []string
+}
+
+func newDropFields(options map[string]interface{}) (Processor, error) {
+	var config struct {
+		Fields []string `mapstructure:"fields"`
+	}
+	if err := decode(options, &config); err != nil {
+		return nil, err
+	}
+	if len(config.Fields) == 0 {
+		return nil, errors.New("drop_fields requires fields")
+	}
+	return &dropFields{fields: config.Fields}, nil
+}
+
+func (d *dropFields) Process(e *Event) bool {
+	for _, name := range d.fields {
+		e.Delete(name)
+	}
+	return true
+}
+
+// addFields sets fields to static values. With onlyMissing set, existing
+// values are kept, which implements the defaults processor.
+type addFields struct {
+	fields      fieldMap
+	onlyMissing bool
+}
+
+func newAddFields(options map[string]interface{}) (Processor, error) {
+	return newFieldSetter(options, false)
+}
+
+func newDefaults(options map[string]interface{}) (Processor, error) {
+	return newFieldSetter(options, true)
+}
+
+func newFieldSetter(options map[string]interface{}, onlyMissing bool) (Processor, error) {
+	var config struct {
+		Fields map[string]string `mapstructure:"fields"`
+	}
+	if err := decode(options, &config); err != nil {
+		return nil, err
+	}
+	if len(config.Fields) == 0 {
+		return nil, errors.New("fields are required")
+	}
+	return &addFields{fields: newFieldMap(config.Fields), onlyMissing: onlyMissing}, nil
+}
+
+func (a *addFields) Process(e *Event) bool {
+	for _, name := range a.fields.names {
+		if a.onlyMissing {
+			if value, _ := e.Get(name); value != "" {
+				continue
+			}
+		}
+		e.Set(name, a.fields.values[name])
+	}
+	return true
+}
+
+// route sends events to the topic of the first matching route.
+type route struct {
+	routes []compiledRoute
+}
+
+type compiledRoute struct {
+	when  *condition
+	topic string
+}
+
+func newRoute(options map[string]interface{}) (Processor, error) {
+	var config struct {
+		Routes []struct {
+			When  Condition `mapstructure:"when"`
+			Topic string    `mapstructure:"topic"`
+		} `mapstructure:"routes"`
+		Topic string `mapstructure:"topic"`
+	}
+	if err := decode(options, &config); err != nil {
+		return nil, err
+	}
+
+	r := &route{}
+	for _, c := range config.Routes {
+		if c.Topic == "" {
+			return nil, errors.New("every route requires a topic")
+		}
+		when, err := c.When.compile()
+		if err != nil {
+			return nil, err
+		}
+		r.routes = append(r.routes, compiledRoute{when: when, topic: c.Topic})
+	}
+
+	// A bare topic routes every event reaching the processor, which combined
+	// with the processor condition covers the single route case.
+	if config.Topic != "" {
+		r.routes = append(r.routes, compiledRoute{when: &condition{}, topic: config.Topic})
+	}
+	if len(r.routes) == 0 {
+		return nil, errors.New("route requires routes or a topic")
+	}
+	return r, nil
+}
+
+func (r *route) Process(e *Event) bool {
+	for _, route := range r.routes {
+		if route.when.match(e) {
+			e.Topic = route.topic
+			break
+		}
+	}
+	return true
+}
+
+// drop drops every event reaching it, so it is used with a condition.
+type drop struct{}
+
+func newDrop(options map[string]interface{}) (Processor, error) {
+	if err := decode(options, &struct{}{}); err != nil {
+		return nil, err
+	}
+	return drop{}, nil
+}
+
+func (drop) Process(e *Event) bool {
+	return false
+}
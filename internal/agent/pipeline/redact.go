@@ -0,0 +1,302 @@
+package pipeline
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const defaultRedactReplacement = "[REDACTED]"
+
+// Redaction actions.
+const (
+	actionMask      = "mask"
+	actionHash      = "hash"
+	actionDropField = "drop_field"
+	actionDropEvent = "drop_event"
+)
+
+// redactGroup names the capture group redacted when a pattern defines it, so
+// that context such as "Bearer " or "password=" is kept. Matches in which the
+// group does not participate are redacted whole.
+const redactGroup = "redact"
+
+type redactRuleConfig struct {
+	Name        string `mapstructure:"name"`
+	Detector    string `mapstructure:"detector"`
+	Pattern     string `mapstructure:"pattern"`
+	Action      string `mapstructure:"action"`
+	Replacement string `mapstructure:"replacement"`
+}
+
+type redactRule struct {
+	name        string
+	re          *regexp.Regexp
+	group       int
+	validate    func(string) bool
+	action      string
+	replacement string
+}
+
+// redact finds sensitive values in fields with built-in detectors and custom
+// patterns, and masks or hashes them, drops the field or drops the event.
+type redact struct {
+	fields []string
+	rules  []*redactRule
+	salt   []byte
+
+	mu     sync.Mutex
+	counts map[redactionKey]uint64
+}
+
+type redactionKey struct {
+	rule    string
+	service string
+}
+
+func newRedact(options map[string]interface{}) (Processor, error) {
+	var config struct {
+		Fields      []string           `mapstructure:"fields"`
+		Detectors   []string           `mapstructure:"detectors"`
+		Patterns    []string           `mapstructure:"patterns"`
+		Rules       []redactRuleConfig `mapstructure:"rules"`
+		Action      string             `mapstructure:"action"`
+		Replacement string             `mapstructure:"replacement"`
+		Salt        string             `mapstructure:"salt"`
+	}
+	if err := decode(options, &config); err != nil {
+		return nil, err
+	}
+
+	r := &redact{
+		fields: config.Fields,
+		salt:   []byte(config.Salt),
+		counts: make(map[redactionKey]uint64),
+	}
+	if len(r.fields) == 0 {
+		r.fields = []string{"message"}
+	}
+
+	// Detectors and patterns are shorthands for rules using the default
+	// action.
+	rules := config.Rules
+	for _, detector := range config.Detectors {
+		rules = append(rules, redactRuleConfig{Detector: detector})
+	}
+	for _, pattern := range config.Patterns {
+		rules = append(rules, redactRuleConfig{Pattern: pattern})
+	}
+	if len(rules) == 0 {
+		return nil, errors.New("redact requires rules, detectors or patterns")
+	}
+
+	for i, c := range rules {
+		if c.Action == "" {
+			c.Action = config.Action
+		}
+		if c.Replacement == "" {
+			c.Replacement = config.Replacement
+		}
+
+		rule, err := newRedactRule(c, i)
+		if err != nil {
+			return nil, err
+		}
+		if rule.action == actionHash && len(r.salt) == 0 {
+			return nil, fmt.Errorf("rule %q: the hash action requires a salt", rule.name)
+		}
+		r.rules = append(r.rules, rule)
+	}
+
+	return r, nil
+}
+
+func newRedactRule(c redactRuleConfig, index int) (*redactRule, error) {
+	rule := &redactRule{
+		name:        c.Name,
+		action:      c.Action,
+		replacement: c.Replacement,
+	}
+	if rule.action == "" {
+		rule.action = actionMask
+	}
+	if rule.replacement == "" {
+		rule.replacement = defaultRedactReplacement
+	}
+
+	switch rule.action {
+	case actionMask, actionHash, actionDropField, actionDropEvent:
+	default:
+		return nil, fmt.Errorf("unknown redaction action %q", rule.action)
+	}
+
+	switch {
+	case c.Detector != "" && c.Pattern != "":
+		return nil, errors.New("a redaction rule takes either a detector or a pattern")
+	case c.Detector != "":
+		d, ok := detectors[c.Detector]
+		if !ok {
+			return nil, fmt.Errorf("unknown detector %q", c.Detector)
+		}
+		rule.re, rule.validate = d.re, d.validate
+		if rule.name == "" {
+			rule.name = c.Detector
+		}
+	case c.Pattern != "":
+		re, err := regexp.Compile(c.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", c.Pattern, err)
+		}
+		rule.re = re
+		if rule.name == "" {
+			rule.name = fmt.Sprintf("pattern-%d", index)
+		}
+	default:
+		return nil, errors.New("a redaction rule requires a detector or a pattern")
+	}
+
+	rule.group = rule.re.SubexpIndex(redactGroup)
+	return rule, nil
+}
+
+func (r *redact) Process(e *Event) bool {
+	return r.redact(e, true)
+}
+
+func (r *redact) DryRun(e *Event) bool {
+	return r.redact(e, false)
+}
+
+func (r *redact) redact(e *Event, record bool) bool {
+	for _, name := range r.expandFields(e) {
+		value, ok := e.Get(name)
+		if !ok || value == "" {
+			continue
+		}
+
+		for _, rule := range r.rules {
+			redacted, n := rule.apply(value, r.salt)
+			if n == 0 {
+				continue
+			}
+			if record {
+				r.count(rule.name, e.Service, n)
+			}
+
+			if rule.action == actionDropEvent {
+				return false
+			}
+			if rule.action == actionDropField {
+				e.Delete(name)
+				break
+			}
+			value = redacted
+			e.Set(name, value)
+		}
+	}
+	return true
+}
+
+// expandFields resolves the configured fields against an event, where "*" and
+// "attributes.*" stand for every attribute.
+func (r *redact) expandFields(e *Event) []string {
+	fields := make([]string, 0, len(r.fields))
+	for _, name := range r.fields {
+		if name != "*" && name != attributePrefix+"*" {
+			fields = append(fields, name)
+			continue
+		}
+
+		names := make([]string, 0, len(e.Attributes))
+		for attribute := range e.Attributes {
+			names = append(names, attributePrefix+attribute)
+		}
+		sort.Strings(names)
+		fields = append(fields, names...)
+	}
+	return fields
+}
+
+// apply replaces the matches of a rule in value and returns the number of
+// matches.
+func (rule *redactRule) apply(value string, salt []byte) (string, int) {
+	matches := rule.re.FindAllStringSubmatchIndex(value, -1)
+	if len(matches) == 0 {
+		return value, 0
+	}
+
+	var b strings.Builder
+	last, n := 0, 0
+	for _, match := range matches {
+		start, end := match[0], match[1]
+		// Alternatives without the redact group redact the whole match.
+		if rule.group > 0 && match[2*rule.group] >= 0 {
+			start, end = match[2*rule.group], match[2*rule.group+1]
+		}
+
+		secret := value[start:end]
+		if rule.validate != nil && !rule.validate(secret) {
+			continue
+		}
+
+		b.WriteString(value[last:start])
+		if rule.action == actionHash {
+			b.WriteString(hashValue(secret, salt))
+		} else {
+			b.WriteString(rule.replacement)
+		}
+		last = end
+		n++
+	}
+	if n == 0 {
+		return value, 0
+	}
+
+	b.WriteString(value[last:])
+	return b.String(), n
+}
+
+// hashValue replaces a value with a keyed hash, so equal values stay
+// correlatable without being recoverable.
+func hashValue(value string, salt []byte) string {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte(value))
+	return "sha256:" + hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+func (r *redact) count(rule, service string, n int) {
+	r.mu.Lock()
+	r.counts[redactionKey{rule: rule, service: service}] += uint64(n)
+	r.mu.Unlock()
+}
+
+// RedactionCount is the number of values a rule redacted in a service.
+type RedactionCount struct {
+	Rule    string `json:"rule"`
+	Service string `json:"service"`
+	Count   uint64 `json:"count"`
+}
+
+// Report returns the redaction counts per rule and service.
+func (r *redact) Report() interface{} {
+	r.mu.Lock()
+	counts := make([]RedactionCount, 0, len(r.counts))
+	for key, count := range r.counts {
+		counts = append(counts, RedactionCount{Rule: key.rule, Service: key.service, Count: count})
+	}
+	r.mu.Unlock()
+
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Rule != counts[j].Rule {
+			return counts[i].Rule < counts[j].Rule
+		}
+		return counts[i].Service < counts[j].Service
+	})
+	return counts
+}
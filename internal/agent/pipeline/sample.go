@@ -0,0 +1,230 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mohammadhptp/pulse/pkg/models"
+)
+
+const (
+	defaultSampleWindow  = 30 * time.Second
+	defaultSampleMaxKeys = 10000
+
+	keepLevelNone = "none"
+)
+
+// templatePlaceholders replace the variable parts of a message, so that lines
+// logged by the same statement share a template.
+var templatePlaceholders = []struct {
+	re          *regexp.Regexp
+	placeholder string
+}{
+	{regexp.MustCompile(`"[^"]*"|'[^']*'`), "<str>"},
+	{regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), "<email>"},
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`), "<uuid>"},
+	{regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}(?::\d+)?\b`), "<ip>"},
+	{regexp.MustCompile(`(?i)\b(?:0x)?[0-9a-f]*\d[0-9a-f]*\b`), "<num>"},
+}
+
+// sample keeps a fraction of events and stamps the kept ones with the sample
+// rate, so that counts can be extrapolated at query time. Events at or above
+// the keep level are always kept. Otherwise the rate is the one of the first
+// matching fixed rate, the dynamic rate of the message template, or the
+// default rate.
+type sample struct {
+	rate      int
+	rates     []sampleRate
+	keepLevel uint8
+	dynamic   *dynamicSampler
+}
+
+type sampleRate struct {
+	service string
+	level   string
+	rate    int
+}
+
+func newSample(options map[string]interface{}) (Processor, error) {
+	var config struct {
+		Rate  int `mapstructure:"rate"`
+		Rates []struct {
+			Service string `mapstructure:"service"`
+			Level   string `mapstructure:"level"`
+			Rate    int    `mapstructure:"rate"`
+		} `mapstructure:"rates"`
+		KeepMinLevel string `mapstructure:"keep_min_level"`
+		Dynamic      *struct {
+			Target  int           `mapstructure:"target"`
+			Window  time.Duration `mapstructure:"window"`
+			MaxKeys int           `mapstructure:"max_keys"`
+		} `mapstructure:"dynamic"`
+	}
+	if err := decode(options, &config); err != nil {
+		return nil, err
+	}
+	if config.Rate == 0 && len(config.Rates) == 0 && config.Dynamic == nil {
+		return nil, errors.New("sample requires a rate, rates or dynamic sampling")
+	}
+	if config.Rate < 0 {
+		return nil, errors.New("sample rate must be at least 1")
+	}
+
+	s := &sample{rate: max(config.Rate, 1)}
+
+	switch strings.ToLower(config.KeepMinLevel) {
+	case keepLevelNone:
+	case "":
+		s.keepLevel = models.SeverityNumber(models.LevelWarn)
+	default:
+		level, ok := models.ParseLevel(config.KeepMinLevel)
+		if !ok {
+			return nil, fmt.Errorf("unknown level %q", config.KeepMinLevel)
+		}
+		s.keepLevel = models.SeverityNumber(level)
+	}
+
+	for _, r := range config.Rates {
+		if r.Rate < 1 {
+			return nil, errors.New("every sample rate must be at least 1")
+		}
+		rate := sampleRate{service: r.Service, rate: r.Rate}
+		if r.Level != "" {
+			level, ok := models.ParseLevel(r.Level)
+			if !ok {
+				return nil, fmt.Errorf("unknown level %q", r.Level)
+			}
+			rate.level = level
+		}
+		s.rates = append(s.rates, rate)
+	}
+
+	if d := config.Dynamic; d != nil {
+		if d.Target < 1 {
+			return nil, errors.New("dynamic sampling requires a target of at least 1")
+		}
+		s.dynamic = &dynamicSampler{
+			target:  uint64(d.Target),
+			window:  d.Window,
+			maxKeys: d.MaxKeys,
+			current: make(map[uint64]uint64),
+		}
+		if s.dynamic.window <= 0 {
+			s.dynamic.window = defaultSampleWindow
+		}
+		if s.dynamic.maxKeys <= 0 {
+			s.dynamic.maxKeys = defaultSampleMaxKeys
+		}
+	}
+
+	return s, nil
+}
+
+func (s *sample) Process(e *Event) bool {
+	return s.keep(e, s.sampleRate(e, true))
+}
+
+func (s *sample) DryRun(e *Event) bool {
+	return s.keep(e, s.sampleRate(e, false))
+}
+
+func (s *sample) keep(e *Event, rate int) bool {
+	if rate > 1 && rand.IntN(rate) != 0 {
+		return false
+	}
+	e.SampleRate = max(e.SampleRate, 1) * uint32(rate)
+	return true
+}
+
+// sampleRate returns the rate for an event. Dynamic sampling only counts the
+// event when record is set.
+func (s *sample) sampleRate(e *Event, record bool) int {
+	level, _ := models.ParseLevel(e.Level)
+	if s.keepLevel != 0 && models.SeverityNumber(level) >= s.keepLevel {
+		return 1
+	}
+
+	for _, r := range s.rates {
+		if (r.service == "" || r.service == e.Service) && (r.level == "" || r.level == level) {
+			return r.rate
+		}
+	}
+
+	if s.dynamic != nil {
+		return s.dynamic.rate(templateKey(e.Service, level, e.Message), time.Now(), record)
+	}
+	return s.rate
+}
+
+// Report returns the number of message templates tracked by dynamic sampling.
+func (s *sample) Report() interface{} {
+	if s.dynamic == nil {
+		return nil
+	}
+	return map[string]int{"keys": s.dynamic.keys()}
+}
+
+// dynamicSampler keeps about target events per message template and window.
+// The rate of a template is derived from its count in the previous window, or
+// in the current one when that is higher, so that new bursts are sampled
+// without waiting for the window to end.
+type dynamicSampler struct {
+	target  uint64
+	window  time.Duration
+	maxKeys int
+
+	mu       sync.Mutex
+	started  time.Time
+	current  map[uint64]uint64
+	previous map[uint64]uint64
+}
+
+func (d *dynamicSampler) rate(key uint64, now time.Time, record bool) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if now.Sub(d.started) >= d.window {
+		d.previous = d.current
+		d.current = make(map[uint64]uint64, len(d.previous))
+		d.started = now
+	}
+
+	count, tracked := d.current[key]
+	if record && (tracked || len(d.current) < d.maxKeys) {
+		count++
+		d.current[key] = count
+	}
+
+	count = max(count, d.previous[key])
+	if count <= d.target {
+		return 1
+	}
+	return int((count + d.target - 1) / d.target)
+}
+
+func (d *dynamicSampler) keys() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.current)
+}
+
+// templateKey hashes the service, level and message template of an event.
+func templateKey(service, level, message string) uint64 {
+	for _, p := range templatePlaceholders {
+		message = p.re.ReplaceAllLiteralString(message, p.placeholder)
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(service))
+	h.Write([]byte{0})
+	h.Write([]byte(level))
+	h.Write([]byte{0})
+	h.Write([]byte(message))
+	return h.Sum64()
+}
@@ -0,0 +1,174 @@
+package pipeline
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mohammadhptp/pulse/pkg/models"
+)
+
+func TestNewSampleErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		options map[string]interface{}
+	}{
+		{"no rate", map[string]interface{}{}},
+		{"negative rate", map[string]interface{}{"rate": -1}},
+		{"zero fixed rate", map[string]interface{}{"rates": []interface{}{map[string]interface{}{"service": "api", "rate": 0}}}},
+		{"unknown rate level", map[string]interface{}{"rates": []interface{}{map[string]interface{}{"level": "loud", "rate": 2}}}},
+		{"unknown keep level", map[string]interface{}{"rate": 2, "keep_min_level": "loud"}},
+		{"dynamic without target", map[string]interface{}{"dynamic": map[string]interface{}{"window": "10s"}}},
+		{"unknown option", map[string]interface{}{"rate": 2, "ratio": 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newSample(tt.options); err == nil {
+				t.Errorf("newSample(%v) succeeded, want an error", tt.options)
+			}
+		})
+	}
+}
+
+func TestSampleRate(t *testing.T) {
+	options := map[string]interface{}{
+		"rate": 10,
+		"rates": []interface{}{
+			map[string]interface{}{"service": "api", "level": "debug", "rate": 100},
+			map[string]interface{}{"service": "api", "rate": 5},
+		},
+	}
+	processor, err := newSample(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := processor.(*sample)
+
+	tests := []struct {
+		name    string
+		service string
+		level   string
+		want    int
+	}{
+		{"service and level", "api", "debug", 100},
+		{"level alias", "api", "dbg", 100},
+		{"service only", "api", "INFO", 5},
+		{"default", "worker", "INFO", 10},
+		{"kept warnings", "api", "WARN", 1},
+		{"kept errors", "worker", "ERROR", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Event{Event: models.Event{Service: tt.service, Level: tt.level}}
+			if got := s.sampleRate(e, false); got != tt.want {
+				t.Errorf("sampleRate() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSampleKeepLevelNone(t *testing.T) {
+	processor, err := newSample(map[string]interface{}{"rate": 4, "keep_min_level": "none"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &Event{Event: models.Event{Level: "FATAL"}}
+	if got := processor.(*sample).sampleRate(e, false); got != 4 {
+		t.Errorf("sampleRate() = %d, want 4", got)
+	}
+}
+
+func TestSampleKeepStampsRate(t *testing.T) {
+	s := &sample{}
+	tests := []struct {
+		name  string
+		prior uint32
+		rate  int
+		want  uint32
+	}{
+		{"unsampled", 0, 1, 1},
+		{"sampled upstream", 4, 1, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Event{Event: models.Event{SampleRate: tt.prior}}
+			if !s.keep(e, tt.rate) {
+				t.Fatal("event with rate 1 was dropped")
+			}
+			if e.SampleRate != tt.want {
+				t.Errorf("SampleRate = %d, want %d", e.SampleRate, tt.want)
+			}
+		})
+	}
+}
+
+func TestSampleKeepsAboutOneInRate(t *testing.T) {
+	s := &sample{}
+	const n, rate = 20000, 4
+	var kept int
+	for range n {
+		e := &Event{}
+		if s.keep(e, rate) {
+			kept++
+			if e.SampleRate != rate {
+				t.Fatalf("SampleRate = %d, want %d", e.SampleRate, rate)
+			}
+		}
+	}
+	if want := n / rate; kept < want*8/10 || kept > want*12/10 {
+		t.Errorf("kept %d of %d events, want about %d", kept, n, want)
+	}
+}
+
+func TestDynamicSamplerRate(t *testing.T) {
+	start := time.Unix(0, 0)
+	d := &dynamicSampler{target: 2, window: time.Minute, maxKeys: 1, current: make(map[uint64]uint64)}
+
+	steps := []struct {
+		name   string
+		key    uint64
+		at     time.Duration
+		record bool
+		want   int
+	}{
+		{"first", 1, 0, true, 1},
+		{"at target", 1, time.Second, true, 1},
+		{"above target", 1, 2 * time.Second, true, 2},
+		{"dry run does not count", 1, 3 * time.Second, false, 2},
+		{"counted", 1, 4 * time.Second, true, 2},
+		{"key beyond max keys untracked", 2, 5 * time.Second, true, 1},
+		{"previous window carries over", 1, time.Minute, false, 2},
+		{"new window counts", 1, time.Minute + time.Second, true, 2},
+		{"window without the key", 1, 3 * time.Minute, false, 1},
+	}
+	for _, step := range steps {
+		if got := d.rate(step.key, start.Add(step.at), step.record); got != step.want {
+			t.Errorf("%s: rate() = %d, want %d", step.name, got, step.want)
+		}
+	}
+}
+
+func TestTemplateKey(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		same bool
+	}{
+		{"numbers", "retry 3 of 5", "retry 4 of 5", true},
+		{"quoted strings", `user "alice" logged in`, `user "bob" logged in`, true},
+		{"emails", "mail to a@example.com failed", "mail to b@example.org failed", true},
+		{"addresses", "connect 10.0.0.1:5432 refused", "connect 10.0.0.2:6432 refused", true},
+		{"uuids", "job 123e4567-e89b-12d3-a456-426614174000 done", "job 9b2c0f5e-1d2a-4c3b-8e7f-000000000001 done", true},
+		{"different text", "cache hit", "cache miss", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			same := templateKey("api", "INFO", tt.a) == templateKey("api", "INFO", tt.b)
+			if same != tt.same {
+				t.Errorf("same template = %v, want %v", same, tt.same)
+			}
+		})
+	}
+	if templateKey("api", "INFO", "x") == templateKey("worker", "INFO", "x") {
+		t.Error("services share a template key")
+	}
+}
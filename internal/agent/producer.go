@@ -3,77 +3,210 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/mohammadhptp/pulse/internal/agent/parser"
+	"github.com/mohammadhptp/pulse/internal/agent/pipeline"
 	"github.com/mohammadhptp/pulse/pkg/logger"
+	"github.com/mohammadhptp/pulse/pkg/metrics"
 	"github.com/mohammadhptp/pulse/pkg/models"
 	"github.com/mohammadhptp/pulse/pkg/transport"
 	"github.com/segmentio/kafka-go"
 	"go.uber.org/zap"
 )
 
+// DefaultMaxPendingWrites is the number of Kafka writes in progress at which
+// the agent reports not ready, unless set otherwise.
+const DefaultMaxPendingWrites = 1000
+
 type EventProcessor struct {
-	writer    *kafka.Writer
-	transport transport.EventProducer
-	processed int
-	errors    int
+	writer     *kafka.Writer
+	topic      string
+	transports []transport.EventProducer
+	parsers    *parser.Set
+	pipeline   *pipeline.Pipeline
+	maxPending int64
+	pending    atomic.Int64
+	processed  atomic.Int64
+	dropped    atomic.Int64
+	errors     atomic.Int64
 }
 
-func NewEventProcessor(writer *kafka.Writer, t transport.EventProducer) *EventProcessor {
+// NewEventProcessor creates a processor writing events received by the
+// transports to topic, unless the pipeline routes them elsewhere. The writer
+// must not set a topic itself.
+func NewEventProcessor(writer *kafka.Writer, topic string, transports ...transport.EventProducer) *EventProcessor {
 	processor := &EventProcessor{
-		writer:    writer,
-		transport: t,
-		processed: 0,
-		errors:    0,
+		writer:     writer,
+		topic:      topic,
+		transports: transports,
 	}
 
-	t.SetEventHandler(processor.handleEvent)
+	for _, t := range transports {
+		t.SetEventHandler(processor.handleEvent)
+	}
 
 	return processor
 }
 
+// SetParsers sets the parsers applied to event messages before they are
+// written to Kafka.
+func (p *EventProcessor) SetParsers(parsers *parser.Set) {
+	p.parsers = parsers
+}
+
+// SetPipeline sets the processors events run through after parsing.
+func (p *EventProcessor) SetPipeline(pipeline *pipeline.Pipeline) {
+	p.pipeline = pipeline
+}
+
+// SetMaxPendingWrites sets the number of Kafka writes in progress at which
+// CheckPendingWrites fails.
+func (p *EventProcessor) SetMaxPendingWrites(writes int) {
+	p.maxPending = int64(writes)
+}
+
 func (p *EventProcessor) Start(ctx context.Context) error {
-	logger.Info("Starting event processor")
+	logger.Info("Starting event processor", zap.Int("transports", len(p.transports)))
 
-	if err := p.transport.Start(ctx); err != nil {
-		return err
+	for _, t := range p.transports {
+		if err := t.Start(ctx); err != nil {
+			p.closeTransports()
+			return err
+		}
 	}
 
+	p.pipeline.Start(p.write)
+
 	<-ctx.Done()
 
+	err := p.closeTransports()
+	// Release events held by the pipeline once no more events arrive.
+	if stopErr := p.pipeline.Stop(); stopErr != nil {
+		logger.Error("Failed to release held events", zap.Error(stopErr))
+		if err == nil {
+			err = stopErr
+		}
+	}
+
 	logger.Info("Completed event processing",
-		zap.Int("processed", p.processed),
-		zap.Int("errors", p.errors))
+		zap.Int64("processed", p.processed.Load()),
+		zap.Int64("dropped", p.dropped.Load()),
+		zap.Int64("errors", p.errors.Load()))
+
+	return err
+}
 
-	return p.transport.Close()
+// CheckKafka reports whether the Kafka brokers of the writer are reachable.
+func (p *EventProcessor) CheckKafka(ctx context.Context) error {
+	client := &kafka.Client{Addr: p.writer.Addr}
+	_, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{p.topic}})
+	return err
+}
+
+// CheckPendingWrites reports whether the Kafka writes in progress are below
+// the limit. Writes are synchronous, so transports wait for Kafka and pending
+// writes pile up while it is slow or down.
+func (p *EventProcessor) CheckPendingWrites(ctx context.Context) error {
+	limit := p.maxPending
+	if limit <= 0 {
+		limit = DefaultMaxPendingWrites
+	}
+	if pending := p.pending.Load(); pending >= limit {
+		return fmt.Errorf("%d Kafka writes pending, limit %d", pending, limit)
+	}
+	return nil
+}
+
+func (p *EventProcessor) closeTransports() error {
+	var firstErr error
+	for _, t := range p.transports {
+		if err := t.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Ingest processes an event received outside the transports, such as the
+// agent's own log entries.
+func (p *EventProcessor) Ingest(event models.Event) error {
+	return p.handleEvent(event)
 }
 
 func (p *EventProcessor) handleEvent(event models.Event) error {
+	p.parsers.Apply(&event)
+	event.NormalizeSeverity()
+	event.NormalizeTrace()
+
+	processed, keep := p.pipeline.Process(event)
+	if !keep {
+		// Events held back by the pipeline, such as by dedup, count as
+		// dropped here and as processed once released.
+		p.dropped.Add(1)
+		metrics.AgentEvents.WithLabelValues(metrics.ResultDropped).Inc()
+		return nil
+	}
+
+	return p.write(processed)
+}
+
+// write ships an event that passed the pipeline to Kafka.
+func (p *EventProcessor) write(processed pipeline.Event) error {
+	event := processed.Event
+	event.NormalizeSeverity()
+	event.NormalizeTrace()
+	if event.RequestID == "" {
+		event.RequestID = uuid.New().String()
+	}
+
 	msg, err := json.Marshal(event)
 	if err != nil {
 		logger.Error("Failed to marshal event", zap.Error(err))
-		p.errors++
+		p.fail()
 		return err
 	}
 
+	topic := processed.Topic
+	if topic == "" {
+		topic = p.topic
+	}
+
 	ctx := context.Background()
-	if err := p.writer.WriteMessages(ctx, kafka.Message{Value: msg}); err != nil {
+	start := time.Now()
+	p.pending.Add(1)
+	err = p.writer.WriteMessages(ctx, kafka.Message{Topic: topic, Value: msg})
+	p.pending.Add(-1)
+	metrics.KafkaWriteDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
 		logger.Error("Failed to write to Kafka",
 			zap.Error(err),
-			zap.String("service", event.Service))
-		p.errors++
+			zap.String("service", event.Service),
+			zap.String("topic", topic))
+		metrics.KafkaWriteErrors.Inc()
+		p.fail()
 		return err
 	}
 
-	p.processed++
-	if p.processed%1000 == 0 {
+	metrics.AgentEvents.WithLabelValues(metrics.ResultProcessed).Inc()
+	if processed := p.processed.Add(1); processed%1000 == 0 {
 		logger.Info("Processing events",
-			zap.Int("processed", p.processed),
-			zap.Int("errors", p.errors))
+			zap.Int64("processed", processed),
+			zap.Int64("dropped", p.dropped.Load()),
+			zap.Int64("errors", p.errors.Load()))
 	}
 
 	return nil
 }
 
+func (p *EventProcessor) fail() {
+	p.errors.Add(1)
+	metrics.AgentEvents.WithLabelValues(metrics.ResultFailed).Inc()
+}
+
 func ProduceLogs(ctx context.Context, writer *kafka.Writer, input interface{}) error {
 	logger.Warn("ProduceLogs is deprecated, please use EventProcessor instead")
 
@@ -0,0 +1,31 @@
+package agent
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCheckPendingWrites(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   int
+		pending int64
+		wantErr bool
+	}{
+		{"idle", 10, 0, false},
+		{"below limit", 10, 9, false},
+		{"at limit", 10, 10, true},
+		{"default limit", 0, DefaultMaxPendingWrites - 1, false},
+		{"at default limit", 0, DefaultMaxPendingWrites, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewEventProcessor(nil, "events")
+			p.SetMaxPendingWrites(tt.limit)
+			p.pending.Store(tt.pending)
+			if err := p.CheckPendingWrites(context.Background()); (err != nil) != tt.wantErr {
+				t.Errorf("CheckPendingWrites() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -3,18 +3,38 @@ package collector
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mohammadhptp/pulse/internal/storage"
+	"github.com/mohammadhptp/pulse/pkg/health"
 	"github.com/mohammadhptp/pulse/pkg/logger"
+	"github.com/mohammadhptp/pulse/pkg/metrics"
 	"github.com/mohammadhptp/pulse/pkg/models"
 	"github.com/segmentio/kafka-go"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
 
-func Run() {
+const (
+	consumerGroup = "pulse-consumers"
+
+	// consumerStallTimeout is how long the consumer may go without consuming
+	// a message while the group lags behind the topic before it is no longer
+	// ready.
+	consumerStallTimeout = time.Minute
+)
+
+var errNotConsuming = errors.New("no message consumed yet")
+
+// Run consumes events from Kafka into ClickHouse until ctx is cancelled, then
+// waits for pending inserts. The Kafka, consumer and ClickHouse checks are
+// registered on checks.
+func Run(ctx context.Context, checks *health.Health) {
 	broker := viper.GetString("KAFKA_BROKER")
 	topic := viper.GetString("KAFKA_TOPIC")
 
@@ -28,24 +48,63 @@ func Run() {
 
 	r := kafka.NewReader(kafka.ReaderConfig{
 		Brokers:  []string{broker},
-		GroupID:  "pulse-consumers",
+		GroupID:  consumerGroup,
 		Topic:    topic,
 		MinBytes: 10e3,
 		MaxBytes: 10e6,
 	})
 	defer r.Close()
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
 	conn, err := storage.Connect(ctx)
 	if err != nil {
 		logger.Fatal("ClickHouse connection error", zap.Error(err))
 	}
+	defer conn.Close()
+
+	// The consumer is ready while the group has consumed every message of the
+	// topic, or keeps consuming them. lastConsumed is the time of the last
+	// message fetched and committed, in Unix nanoseconds.
+	var lastConsumed atomic.Int64
+	client := &kafka.Client{Addr: kafka.TCP(broker)}
+	checks.Add("kafka", func(ctx context.Context) error {
+		_, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{topic}})
+		return err
+	})
+	checks.Add("consumer", func(ctx context.Context) error {
+		lag, err := groupLag(ctx, client, topic)
+		if err != nil {
+			return err
+		}
+		var last time.Time
+		if ns := lastConsumed.Load(); ns != 0 {
+			last = time.Unix(0, ns)
+		}
+		return consumerReady(lag, last, time.Now())
+	})
+	checks.Add("clickhouse", conn.Ping)
+
+	// Inserts fail against the table of an older deployment until its schema
+	// is migrated, which waits for ClickHouse to be reachable.
+	for {
+		err := storage.Migrate(ctx, conn)
+		if err == nil {
+			break
+		}
+		logger.Error("Failed to migrate ClickHouse schema", zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+
+	// Pending inserts complete after ctx is cancelled.
+	insertCtx := context.WithoutCancel(ctx)
 
 	// Use mutex to synchronize access to the connection
 	var mu sync.Mutex
-	var processed, errors int
+	var wg sync.WaitGroup
+	var processed, failed atomic.Int64
 
 	logger.Info("Starting to consume messages",
 		zap.String("broker", broker),
@@ -53,41 +112,132 @@ func Run() {
 
 	for {
 		m, err := r.ReadMessage(ctx)
+		if ctx.Err() != nil {
+			break
+		}
 		if err != nil {
 			logger.Error("Failed to read message from Kafka", zap.Error(err))
 			time.Sleep(time.Second)
 			continue
 		}
+		lastConsumed.Store(time.Now().UnixNano())
+		metrics.ConsumerLag.WithLabelValues(strconv.Itoa(m.Partition)).Set(float64(m.HighWaterMark - m.Offset - 1))
 
 		var event models.Event
 		if err := json.Unmarshal(m.Value, &event); err != nil {
 			logger.Warn("Failed to unmarshal message",
 				zap.Error(err),
 				zap.String("payload", string(m.Value)))
-			errors++
+			failed.Add(1)
+			metrics.ConsumerMessages.WithLabelValues(metrics.ResultInvalid).Inc()
 			continue
 		}
+		event.NormalizeSeverity()
+		event.NormalizeTrace()
 
 		// Use a goroutine with mutex to handle concurrent writes safely
+		wg.Add(1)
 		go func(e models.Event) {
+			defer wg.Done()
 			mu.Lock()
 			defer mu.Unlock()
 
+			// Failures to insert the collector's own log entries must not
+			// be forwarded as new ones.
+			ctx := logger.WithEventService(insertCtx, e.Service)
 			if err := storage.InsertEvent(ctx, conn, e); err != nil {
 				logger.Error("Failed to insert event to ClickHouse",
 					zap.Error(err),
 					zap.String("service", e.Service),
 					zap.Uint64("timestamp", e.EventTimeMs))
-				errors++
+				failed.Add(1)
+				metrics.ConsumerMessages.WithLabelValues(metrics.ResultFailed).Inc()
 				return
 			}
 
-			processed++
-			if processed%1000 == 0 {
+			metrics.ConsumerMessages.WithLabelValues(metrics.ResultProcessed).Inc()
+			if n := processed.Add(1); n%1000 == 0 {
 				logger.Info("Processing events",
-					zap.Int("processed", processed),
-					zap.Int("errors", errors))
+					zap.Int64("processed", n),
+					zap.Int64("errors", failed.Load()))
 			}
 		}(event)
 	}
+
+	logger.Info("Waiting for pending inserts")
+	wg.Wait()
+	logger.Info("Completed event consumption",
+		zap.Int64("processed", processed.Load()),
+		zap.Int64("errors", failed.Load()))
+}
+
+// groupLag returns the number of messages of topic not yet committed by the
+// consumer group.
+func groupLag(ctx context.Context, client *kafka.Client, topic string) (int64, error) {
+	metadata, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return 0, err
+	}
+	if len(metadata.Topics) != 1 {
+		return 0, fmt.Errorf("topic %s not found", topic)
+	}
+	if err := metadata.Topics[0].Error; err != nil {
+		return 0, err
+	}
+
+	var partitions []int
+	var requests []kafka.OffsetRequest
+	for _, p := range metadata.Topics[0].Partitions {
+		partitions = append(partitions, p.ID)
+		requests = append(requests, kafka.FirstOffsetOf(p.ID), kafka.LastOffsetOf(p.ID))
+	}
+
+	offsets, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: map[string][]kafka.OffsetRequest{topic: requests}})
+	if err != nil {
+		return 0, err
+	}
+	committed, err := client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{GroupID: consumerGroup, Topics: map[string][]int{topic: partitions}})
+	if err != nil {
+		return 0, err
+	}
+	if committed.Error != nil {
+		return 0, committed.Error
+	}
+
+	commits := make(map[int]int64)
+	for _, p := range committed.Topics[topic] {
+		if p.Error != nil {
+			return 0, p.Error
+		}
+		commits[p.Partition] = p.CommittedOffset
+	}
+
+	var lag int64
+	for _, p := range offsets.Topics[topic] {
+		if p.Error != nil {
+			return 0, p.Error
+		}
+		// Partitions without a commit are consumed from their first offset.
+		commit, ok := commits[p.Partition]
+		if !ok || commit < p.FirstOffset {
+			commit = p.FirstOffset
+		}
+		lag += max(p.LastOffset-commit, 0)
+	}
+	return lag, nil
+}
+
+// consumerReady reports whether a consumer lagging lag messages behind, which
+// last consumed a message at last, is ready at now. A consumer that caught up
+// is ready however long ago it consumed, since the topic is idle.
+func consumerReady(lag int64, last, now time.Time) error {
+	switch {
+	case lag == 0:
+		return nil
+	case last.IsZero():
+		return fmt.Errorf("%w, %d messages behind", errNotConsuming, lag)
+	case now.Sub(last) > consumerStallTimeout:
+		return fmt.Errorf("%d messages behind, last consumed %s ago", lag, now.Sub(last).Round(time.Second))
+	}
+	return nil
 }
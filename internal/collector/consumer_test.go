@@ -0,0 +1,43 @@
+package collector
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConsumerReady(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tests := []struct {
+		name string
+		lag  int64
+		last time.Time
+		err  string
+	}{
+		{"caught up before consuming", 0, time.Time{}, ""},
+		{"caught up long ago", 0, now.Add(-time.Hour), ""},
+		{"behind before consuming", 5, time.Time{}, "no message consumed yet, 5 messages behind"},
+		{"behind and consuming", 100, now.Add(-time.Second), ""},
+		{"behind at the stall timeout", 100, now.Add(-consumerStallTimeout), ""},
+		{"stalled", 100, now.Add(-2 * time.Minute), "100 messages behind, last consumed 2m0s ago"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := consumerReady(tt.lag, tt.last, now)
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("consumerReady() = %v, want ready", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("consumerReady() = %v, want %q", err, tt.err)
+			}
+		})
+	}
+
+	if err := consumerReady(1, time.Time{}, now); !errors.Is(err, errNotConsuming) {
+		t.Errorf("consumerReady() = %v, want errNotConsuming", err)
+	}
+}
@@ -0,0 +1,34 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mohammadhptp/pulse/pkg/logger"
+	"github.com/mohammadhptp/pulse/pkg/models"
+	"github.com/segmentio/kafka-go"
+)
+
+// NewLogSink returns a sink writing the collector's own log entries to the
+// Kafka topic it consumes, from which they are stored like any other event.
+// The writer must be closed after the forwarding core.
+func NewLogSink(broker, topic string) (logger.Sink, *kafka.Writer) {
+	writer := kafka.NewWriter(kafka.WriterConfig{
+		Brokers:      []string{broker},
+		Topic:        topic,
+		Balancer:     &kafka.LeastBytes{},
+		BatchTimeout: 10 * time.Millisecond,
+	})
+
+	sink := func(event models.Event) error {
+		event.RequestID = uuid.New().String()
+		msg, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		return writer.WriteMessages(context.Background(), kafka.Message{Value: msg})
+	}
+	return sink, writer
+}
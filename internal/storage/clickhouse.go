@@ -7,12 +7,25 @@ import (
 	"time"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
 	"github.com/mohammadhptp/pulse/pkg/logger"
+	"github.com/mohammadhptp/pulse/pkg/metrics"
 	"github.com/mohammadhptp/pulse/pkg/models"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
 
+// eventColumns lists the logs table columns read and written for an event, in
+// the order used by scanEvent and InsertEvent.
+const eventColumns = "EventTimeMs, Service, Level, SeverityNumber, Message, Host, RequestID, TraceID, SpanID, TraceFlags, SampleRate, RepeatCount, FirstSeenMs, LastSeenMs, Attributes"
+
+// estimatedCount extrapolates the number of matching rows to the events
+// logged before sampling and deduplication.
+const estimatedCount = "sum(SampleRate * RepeatCount)"
+
+// maxTraceEvents caps the number of events returned for a single trace.
+const maxTraceEvents = 10000
+
 // Connect establishes a connection to ClickHouse
 func Connect(ctx context.Context) (clickhouse.Conn, error) {
 	addr := viper.GetString("CLICKHOUSE_ADDR")
@@ -40,27 +53,42 @@ func Connect(ctx context.Context) (clickhouse.Conn, error) {
 
 // InsertEvent inserts a single event into ClickHouse
 func InsertEvent(ctx context.Context, conn clickhouse.Conn, e models.Event) error {
-	query := "INSERT INTO gologcentral.logs (EventTimeMs, Service, Level, Message, Host, RequestID)"
+	query := "INSERT INTO gologcentral.logs (" + eventColumns + ")"
 
 	batch, err := conn.PrepareBatch(ctx, query)
 	if err != nil {
-		logger.Error("Failed to prepare batch", zap.Error(err))
+		logger.ErrorContext(ctx, "Failed to prepare batch", zap.Error(err))
+		metrics.ClickHouseInsertFailures.Inc()
 		return err
 	}
 
-	if err := batch.Append(e.EventTimeMs, e.Service, e.Level, e.Message, e.Host, e.RequestID); err != nil {
-		logger.Error("Failed to append to batch",
+	sampleRate := e.SampleRate
+	if sampleRate == 0 {
+		sampleRate = 1
+	}
+	repeatCount := e.RepeatCount
+	if repeatCount == 0 {
+		repeatCount = 1
+	}
+
+	if err := batch.Append(e.EventTimeMs, e.Service, e.Level, e.SeverityNumber, e.Message, e.Host, e.RequestID, e.TraceID, e.SpanID, e.TraceFlags, sampleRate, repeatCount, e.FirstSeenMs, e.LastSeenMs, e.Attributes); err != nil {
+		logger.ErrorContext(ctx, "Failed to append to batch",
 			zap.Error(err),
 			zap.String("service", e.Service),
 			zap.Uint64("timestamp", e.EventTimeMs))
+		metrics.ClickHouseInsertFailures.Inc()
 		return err
 	}
 
 	start := time.Now()
-	if err := batch.Send(); err != nil {
-		logger.Error("Failed to send batch", zap.Error(err))
+	err = batch.Send()
+	metrics.ClickHouseInsertDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to send batch", zap.Error(err))
+		metrics.ClickHouseInsertFailures.Inc()
 		return err
 	}
+	metrics.ClickHouseInsertedRows.Inc()
 
 	logger.Debug("Event inserted successfully",
 		zap.Duration("took", time.Since(start)),
@@ -72,42 +100,17 @@ func InsertEvent(ctx context.Context, conn clickhouse.Conn, e models.Event) erro
 
 // QueryEvents retrieves events from ClickHouse with filtering and sorting options
 func QueryEvents(ctx context.Context, conn clickhouse.Conn, options models.QueryOptions) (*models.PaginatedResponse, error) {
-	var conditions []string
-	var params []interface{}
-
-	if options.Service != "" {
-		conditions = append(conditions, "Service = ?")
-		params = append(params, options.Service)
-	}
-
-	if options.Level != "" {
-		conditions = append(conditions, "Level = ?")
-		params = append(params, options.Level)
-	}
-
-	if options.Host != "" {
-		conditions = append(conditions, "Host = ?")
-		params = append(params, options.Host)
-	}
-
-	if options.StartTime > 0 {
-		conditions = append(conditions, "EventTimeMs >= ?")
-		params = append(params, options.StartTime)
-	}
+	defer observeQuery("events", time.Now())
 
-	if options.EndTime > 0 {
-		conditions = append(conditions, "EventTimeMs <= ?")
-		params = append(params, options.EndTime)
-	}
-
-	if options.RequestID != "" {
-		conditions = append(conditions, "RequestID = ?")
-		params = append(params, options.RequestID)
+	options, err := ApplyLimits(options, time.Now())
+	if err != nil {
+		return nil, err
 	}
+	ctx = limitContext(ctx)
 
-	if options.SearchQuery != "" {
-		conditions = append(conditions, "Message LIKE ?")
-		params = append(params, "%"+options.SearchQuery+"%")
+	conditions, params, err := filterConditions(options)
+	if err != nil {
+		return nil, err
 	}
 
 	if options.PerPage <= 0 {
@@ -119,18 +122,19 @@ func QueryEvents(ctx context.Context, conn clickhouse.Conn, options models.Query
 
 	offset := (options.Page - 1) * options.PerPage
 
-	countQuery := "SELECT count(*) FROM gologcentral.logs"
+	countQuery := "SELECT count(*), " + estimatedCount + " FROM gologcentral.logs"
 	if len(conditions) > 0 {
 		countQuery += " WHERE " + strings.Join(conditions, " AND ")
 	}
 
-	var total int64
-	if err := conn.QueryRow(ctx, countQuery, params...).Scan(&total); err != nil {
+	var total uint64
+	var estimated uint64
+	if err := conn.QueryRow(ctx, countQuery, params...).Scan(&total, &estimated); err != nil {
 		logger.Error("Failed to get total count", zap.Error(err))
-		return nil, err
+		return nil, limitExceeded(ctx, err)
 	}
 
-	lastPage := int((total + int64(options.PerPage) - 1) / int64(options.PerPage))
+	lastPage := int((total + uint64(options.PerPage) - 1) / uint64(options.PerPage))
 	from := offset + 1
 	to := offset + options.PerPage
 	if to > int(total) {
@@ -142,7 +146,7 @@ func QueryEvents(ctx context.Context, conn clickhouse.Conn, options models.Query
 		sortOrder = "DESC"
 	}
 
-	query := "SELECT EventTimeMs, Service, Level, Message, Host, RequestID FROM gologcentral.logs"
+	query := "SELECT " + eventColumns + " FROM gologcentral.logs"
 	if len(conditions) > 0 {
 		query += " WHERE " + strings.Join(conditions, " AND ")
 	}
@@ -159,14 +163,13 @@ func QueryEvents(ctx context.Context, conn clickhouse.Conn, options models.Query
 	rows, err := conn.Query(ctx, query, params...)
 	if err != nil {
 		logger.Error("Failed to query events", zap.Error(err))
-		return nil, err
+		return nil, limitExceeded(ctx, err)
 	}
 	defer rows.Close()
 
 	var events []models.Event
 	for rows.Next() {
-		var event models.Event
-		err := rows.Scan(&event.EventTimeMs, &event.Service, &event.Level, &event.Message, &event.Host, &event.RequestID)
+		event, err := scanEvent(rows)
 		if err != nil {
 			logger.Error("Failed to scan row", zap.Error(err))
 			return nil, err
@@ -176,17 +179,18 @@ func QueryEvents(ctx context.Context, conn clickhouse.Conn, options models.Query
 
 	if err := rows.Err(); err != nil {
 		logger.Error("Error during row iteration", zap.Error(err))
-		return nil, err
+		return nil, limitExceeded(ctx, err)
 	}
 
 	response := &models.PaginatedResponse{
-		Total:       total,
-		PerPage:     options.PerPage,
-		CurrentPage: options.Page,
-		LastPage:    lastPage,
-		From:        from,
-		To:          to,
-		Data:        events,
+		Total:          int64(total),
+		EstimatedTotal: int64(estimated),
+		PerPage:        options.PerPage,
+		CurrentPage:    options.Page,
+		LastPage:       lastPage,
+		From:           from,
+		To:             to,
+		Data:           events,
 	}
 
 	logger.Debug("Query completed successfully",
@@ -195,3 +199,427 @@ func QueryEvents(ctx context.Context, conn clickhouse.Conn, options models.Query
 
 	return response, nil
 }
+
+// StreamEvents calls fn with each event matching the filters of options, in
+// the time order of options.SortOrder, up to limit events. Rows are read as
+// ClickHouse sends them, so the result set is never held in memory. Streaming
+// stops at the first error of fn or when ctx is done.
+func StreamEvents(ctx context.Context, conn clickhouse.Conn, options models.QueryOptions, limit int, fn func(models.Event) error) (int, error) {
+	defer observeQuery("stream", time.Now())
+
+	options, err := ApplyLimits(options, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	ctx = limitContext(ctx)
+
+	conditions, params, err := filterConditions(options)
+	if err != nil {
+		return 0, err
+	}
+
+	sortOrder := "ASC"
+	if strings.ToUpper(options.SortOrder) == "DESC" {
+		sortOrder = "DESC"
+	}
+
+	query := "SELECT " + eventColumns + " FROM gologcentral.logs"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY EventTimeMs %s LIMIT %d", sortOrder, limit)
+
+	start := time.Now()
+
+	rows, err := conn.Query(ctx, query, params...)
+	if err != nil {
+		logger.Error("Failed to stream events", zap.Error(err))
+		return 0, limitExceeded(ctx, err)
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			logger.Error("Failed to scan row", zap.Error(err))
+			return count, err
+		}
+		if err := fn(event); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	if err := rows.Err(); err != nil {
+		return count, limitExceeded(ctx, err)
+	}
+
+	logger.Debug("Event stream completed successfully",
+		zap.Duration("took", time.Since(start)),
+		zap.Int("count", count))
+
+	return count, nil
+}
+
+// EstimateEvents reports the parts, rows and marks ClickHouse estimates it
+// reads from the primary key to find the events matching options, with
+// EXPLAIN ESTIMATE, without running the query.
+func EstimateEvents(ctx context.Context, conn clickhouse.Conn, options models.QueryOptions) (*models.QueryEstimate, error) {
+	defer observeQuery("estimate", time.Now())
+
+	options, err := ApplyLimits(options, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	conditions, params, err := filterConditions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	query := "EXPLAIN ESTIMATE SELECT " + eventColumns + " FROM gologcentral.logs"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	start := time.Now()
+
+	rows, err := conn.Query(ctx, query, params...)
+	if err != nil {
+		logger.Error("Failed to estimate query", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	_, maxRows := executionLimits(ctx)
+	estimate := &models.QueryEstimate{
+		StartTime:     options.StartTime,
+		EndTime:       options.EndTime,
+		MaxRowsToRead: maxRows,
+	}
+	for rows.Next() {
+		var database, table string
+		var parts, count, marks uint64
+		if err := rows.Scan(&database, &table, &parts, &count, &marks); err != nil {
+			logger.Error("Failed to scan row", zap.Error(err))
+			return nil, err
+		}
+		estimate.Parts += parts
+		estimate.Rows += count
+		estimate.Marks += marks
+	}
+
+	if err := rows.Err(); err != nil {
+		logger.Error("Error during row iteration", zap.Error(err))
+		return nil, err
+	}
+	estimate.WithinLimits = estimate.Rows <= maxRows
+
+	logger.Debug("Query estimate completed successfully",
+		zap.Duration("took", time.Since(start)),
+		zap.Uint64("rows", estimate.Rows))
+
+	return estimate, nil
+}
+
+// KillQuery stops the query with queryID on the ClickHouse server. Cancelling
+// the context of a query only drops its connection, which the server may not
+// notice until the query sends its next block of results.
+func KillQuery(ctx context.Context, conn clickhouse.Conn, queryID string) error {
+	if err := conn.Exec(ctx, "KILL QUERY WHERE query_id = ? ASYNC", queryID); err != nil {
+		logger.Error("Failed to kill query", zap.Error(err), zap.String("query_id", queryID))
+		return err
+	}
+
+	logger.Debug("Query killed", zap.String("query_id", queryID))
+	return nil
+}
+
+// QueryTrace retrieves the events of the trace in options across services,
+// ordered by time, within the time range of options.
+func QueryTrace(ctx context.Context, conn clickhouse.Conn, options models.QueryOptions) ([]models.Event, error) {
+	defer observeQuery("trace", time.Now())
+
+	options, err := ApplyLimits(traceRange(options, time.Now()), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	ctx = limitContext(ctx)
+
+	conditions, params, err := filterConditions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	query := "SELECT " + eventColumns + " FROM gologcentral.logs WHERE " + strings.Join(conditions, " AND ") +
+		fmt.Sprintf(" ORDER BY EventTimeMs ASC LIMIT %d", maxTraceEvents)
+
+	start := time.Now()
+
+	rows, err := conn.Query(ctx, query, params...)
+	if err != nil {
+		logger.Error("Failed to query trace", zap.Error(err), zap.String("trace_id", options.TraceID))
+		return nil, limitExceeded(ctx, err)
+	}
+	defer rows.Close()
+
+	events := []models.Event{}
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			logger.Error("Failed to scan row", zap.Error(err))
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		logger.Error("Error during row iteration", zap.Error(err))
+		return nil, limitExceeded(ctx, err)
+	}
+
+	logger.Debug("Trace query completed successfully",
+		zap.Duration("took", time.Since(start)),
+		zap.String("trace_id", options.TraceID),
+		zap.Int("count", len(events)))
+
+	return events, nil
+}
+
+// QueryHistogram counts the events matching the filters of options in time
+// buckets of interval, both as stored and extrapolated from sample rates.
+// Empty buckets are omitted.
+func QueryHistogram(ctx context.Context, conn clickhouse.Conn, options models.QueryOptions, interval time.Duration) ([]models.HistogramBucket, error) {
+	defer observeQuery("histogram", time.Now())
+
+	options, err := ApplyLimits(options, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	ctx = limitContext(ctx)
+
+	conditions, params, err := filterConditions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	intervalMs := interval.Milliseconds()
+	if intervalMs <= 0 {
+		return nil, fmt.Errorf("invalid histogram interval %s", interval)
+	}
+
+	query := fmt.Sprintf("SELECT intDiv(EventTimeMs, %d) * %d AS Bucket, count(*), %s FROM gologcentral.logs",
+		intervalMs, intervalMs, estimatedCount)
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " GROUP BY Bucket ORDER BY Bucket ASC"
+
+	start := time.Now()
+
+	rows, err := conn.Query(ctx, query, params...)
+	if err != nil {
+		logger.Error("Failed to query histogram", zap.Error(err))
+		return nil, limitExceeded(ctx, err)
+	}
+	defer rows.Close()
+
+	buckets := []models.HistogramBucket{}
+	for rows.Next() {
+		var bucket models.HistogramBucket
+		if err := rows.Scan(&bucket.TimeMs, &bucket.Count, &bucket.EstimatedCount); err != nil {
+			logger.Error("Failed to scan row", zap.Error(err))
+			return nil, err
+		}
+		buckets = append(buckets, bucket)
+	}
+
+	if err := rows.Err(); err != nil {
+		logger.Error("Error during row iteration", zap.Error(err))
+		return nil, limitExceeded(ctx, err)
+	}
+
+	logger.Debug("Histogram query completed successfully",
+		zap.Duration("took", time.Since(start)),
+		zap.Int("buckets", len(buckets)))
+
+	return buckets, nil
+}
+
+// facetColumns are the event columns that can be faceted, besides attributes.
+var facetColumns = map[string]string{
+	"service": "Service",
+	"level":   "Level",
+	"host":    "Host",
+}
+
+// ValidFacetField reports whether QueryFacets can facet field.
+func ValidFacetField(field string) bool {
+	if _, ok := facetColumns[field]; ok {
+		return true
+	}
+	key, ok := strings.CutPrefix(field, "attributes.")
+	return ok && key != ""
+}
+
+// QueryFacets returns the most frequent values of field among the events
+// matching the filters of options, with their stored and estimated counts.
+// Field is service, level, host or an attribute named attributes.<key>; events
+// without the attribute are not counted.
+func QueryFacets(ctx context.Context, conn clickhouse.Conn, options models.QueryOptions, field string, limit int) ([]models.FacetValue, error) {
+	defer observeQuery("facets", time.Now())
+
+	options, err := ApplyLimits(options, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	ctx = limitContext(ctx)
+
+	conditions, params, err := filterConditions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ValidFacetField(field) {
+		return nil, fmt.Errorf("unknown facet field %q", field)
+	}
+
+	column, ok := facetColumns[field]
+	var columnParams []interface{}
+	if !ok {
+		key := strings.TrimPrefix(field, "attributes.")
+		column = "Attributes[?]"
+		columnParams = append(columnParams, key)
+		conditions = append(conditions, "mapContains(Attributes, ?)")
+		params = append(params, key)
+	}
+
+	query := fmt.Sprintf("SELECT %s AS Value, count(*) AS Count, %s FROM gologcentral.logs", column, estimatedCount)
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf(" GROUP BY Value ORDER BY Count DESC, Value ASC LIMIT %d", limit)
+
+	start := time.Now()
+
+	rows, err := conn.Query(ctx, query, append(columnParams, params...)...)
+	if err != nil {
+		logger.Error("Failed to query facets", zap.Error(err), zap.String("field", field))
+		return nil, limitExceeded(ctx, err)
+	}
+	defer rows.Close()
+
+	values := []models.FacetValue{}
+	for rows.Next() {
+		var value models.FacetValue
+		if err := rows.Scan(&value.Value, &value.Count, &value.EstimatedCount); err != nil {
+			logger.Error("Failed to scan row", zap.Error(err))
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	if err := rows.Err(); err != nil {
+		logger.Error("Error during row iteration", zap.Error(err))
+		return nil, limitExceeded(ctx, err)
+	}
+
+	logger.Debug("Facet query completed successfully",
+		zap.Duration("took", time.Since(start)),
+		zap.String("field", field),
+		zap.Int("values", len(values)))
+
+	return values, nil
+}
+
+// filterConditions builds the WHERE conditions and their parameters for the
+// filters of options.
+func filterConditions(options models.QueryOptions) ([]string, []interface{}, error) {
+	var conditions []string
+	var params []interface{}
+
+	if options.Service != "" {
+		conditions = append(conditions, "Service = ?")
+		params = append(params, options.Service)
+	}
+
+	if options.Level != "" {
+		condition, param, err := levelCondition(options.Level, options.LevelOp)
+		if err != nil {
+			return nil, nil, err
+		}
+		conditions = append(conditions, condition)
+		params = append(params, param)
+	}
+
+	if options.Host != "" {
+		conditions = append(conditions, "Host = ?")
+		params = append(params, options.Host)
+	}
+
+	if options.StartTime > 0 {
+		conditions = append(conditions, "EventTimeMs >= ?")
+		params = append(params, options.StartTime)
+	}
+
+	if options.EndTime > 0 {
+		conditions = append(conditions, "EventTimeMs <= ?")
+		params = append(params, options.EndTime)
+	}
+
+	if options.RequestID != "" {
+		conditions = append(conditions, "RequestID = ?")
+		params = append(params, options.RequestID)
+	}
+
+	if options.TraceID != "" {
+		conditions = append(conditions, "TraceID = ?")
+		params = append(params, strings.ToLower(options.TraceID))
+	}
+
+	if options.SearchQuery != "" {
+		conditions = append(conditions, "Message LIKE ?")
+		params = append(params, "%"+options.SearchQuery+"%")
+	}
+
+	return conditions, params, nil
+}
+
+// observeQuery records the latency of a query started at start.
+func observeQuery(query string, start time.Time) {
+	metrics.QueryDuration.WithLabelValues(query).Observe(time.Since(start).Seconds())
+}
+
+func scanEvent(rows driver.Rows) (models.Event, error) {
+	var event models.Event
+	err := rows.Scan(&event.EventTimeMs, &event.Service, &event.Level, &event.SeverityNumber,
+		&event.Message, &event.Host, &event.RequestID, &event.TraceID, &event.SpanID, &event.TraceFlags, &event.SampleRate,
+		&event.RepeatCount, &event.FirstSeenMs, &event.LastSeenMs, &event.Attributes)
+	return event, err
+}
+
+// levelCondition builds the filter for a level, either as an exact match or as
+// a severity threshold when op is one of >=, >, <= or <.
+func levelCondition(level, op string) (string, interface{}, error) {
+	canonical, ok := models.ParseLevel(level)
+	if !ok {
+		return "", nil, fmt.Errorf("unknown level %q", level)
+	}
+
+	lowest, highest := models.SeverityRange(canonical)
+	switch op {
+	case "", "=":
+		return "Level = ?", canonical, nil
+	case ">=":
+		return "SeverityNumber >= ?", lowest, nil
+	case ">":
+		return "SeverityNumber > ?", highest, nil
+	case "<=":
+		return "SeverityNumber <= ?", highest, nil
+	case "<":
+		return "SeverityNumber < ?", lowest, nil
+	default:
+		return "", nil, fmt.Errorf("unsupported level operator %q", op)
+	}
+}
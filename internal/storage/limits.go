@@ -0,0 +1,222 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/mohammadhptp/pulse/pkg/models"
+)
+
+// Default query limits.
+const (
+	DefaultQueryRange           = time.Hour
+	DefaultMaxQueryRange        = 31 * 24 * time.Hour
+	DefaultMaxExecutionTime     = 30 * time.Second
+	DefaultMaxRowsToRead        = 1000000000
+	DefaultLongMaxExecutionTime = 10 * time.Minute
+	DefaultLongMaxRowsToRead    = 10000000000
+	DefaultMaxPerPage           = 1000
+)
+
+// ClickHouse error codes of queries stopped by the execution limits.
+const (
+	codeTooManyRows        = 158
+	codeTimeoutExceeded    = 159
+	codeTooManyRowsOrBytes = 396
+)
+
+// Limits are the guardrails applied to event queries, so that a single
+// unbounded search cannot saturate ClickHouse.
+type Limits struct {
+	// DefaultRange is the time range, ending now, of queries without a start
+	// or end time.
+	DefaultRange time.Duration
+	// MaxRange is the longest time range a query may span.
+	MaxRange time.Duration
+	// MaxExecutionTime and MaxRowsToRead bound the execution of queries in
+	// ClickHouse. Exports and query jobs, which are expected to run longer,
+	// are bounded by LongMaxExecutionTime and LongMaxRowsToRead instead.
+	MaxExecutionTime     time.Duration
+	MaxRowsToRead        uint64
+	LongMaxExecutionTime time.Duration
+	LongMaxRowsToRead    uint64
+	// MaxPerPage is the largest page size of paginated queries.
+	MaxPerPage int
+}
+
+var limits = DefaultLimits()
+
+// DefaultLimits returns the limits used when none are configured.
+func DefaultLimits() Limits {
+	return Limits{
+		DefaultRange:         DefaultQueryRange,
+		MaxRange:             DefaultMaxQueryRange,
+		MaxExecutionTime:     DefaultMaxExecutionTime,
+		MaxRowsToRead:        DefaultMaxRowsToRead,
+		LongMaxExecutionTime: DefaultLongMaxExecutionTime,
+		LongMaxRowsToRead:    DefaultLongMaxRowsToRead,
+		MaxPerPage:           DefaultMaxPerPage,
+	}
+}
+
+// SetLimits sets the limits of event queries, with zero fields keeping their
+// default. It must be called before queries are run.
+func SetLimits(l Limits) {
+	defaults := DefaultLimits()
+	if l.DefaultRange <= 0 {
+		l.DefaultRange = defaults.DefaultRange
+	}
+	if l.MaxRange <= 0 {
+		l.MaxRange = defaults.MaxRange
+	}
+	if l.MaxExecutionTime <= 0 {
+		l.MaxExecutionTime = defaults.MaxExecutionTime
+	}
+	if l.MaxRowsToRead == 0 {
+		l.MaxRowsToRead = defaults.MaxRowsToRead
+	}
+	if l.LongMaxExecutionTime <= 0 {
+		l.LongMaxExecutionTime = defaults.LongMaxExecutionTime
+	}
+	if l.LongMaxRowsToRead == 0 {
+		l.LongMaxRowsToRead = defaults.LongMaxRowsToRead
+	}
+	if l.MaxPerPage <= 0 {
+		l.MaxPerPage = defaults.MaxPerPage
+	}
+	limits = l
+}
+
+// LimitError reports a query rejected by the limits, or stopped by ClickHouse
+// for exceeding them. Its message tells the client how to fix the query.
+type LimitError struct {
+	message string
+}
+
+func (e *LimitError) Error() string {
+	return e.message
+}
+
+func limitErrorf(format string, args ...interface{}) error {
+	return &LimitError{message: fmt.Sprintf(format, args...)}
+}
+
+// ApplyLimits resolves the time range of options and checks it and the page
+// size against the limits. Queries without a start or end time cover the
+// default range ending now, those with only a start time end now, and those
+// with only an end time cover the default range ending then.
+func ApplyLimits(options models.QueryOptions, now time.Time) (models.QueryOptions, error) {
+	nowMs := uint64(now.UnixMilli())
+	rangeMs := uint64(limits.DefaultRange.Milliseconds())
+
+	switch {
+	case options.StartTime == 0 && options.EndTime == 0:
+		options.EndTime = nowMs
+		options.StartTime = nowMs - rangeMs
+	case options.EndTime == 0:
+		options.EndTime = max(nowMs, options.StartTime)
+	case options.StartTime == 0:
+		options.StartTime = options.EndTime - min(rangeMs, options.EndTime)
+	}
+
+	if options.StartTime > options.EndTime {
+		return options, limitErrorf("start_time must not be after end_time")
+	}
+	maxMs := uint64(limits.MaxRange.Milliseconds())
+	if spanMs := options.EndTime - options.StartTime; spanMs > maxMs {
+		return options, limitErrorf("time range of %s exceeds the maximum of %s", formatRange(spanMs), formatRange(maxMs))
+	}
+	if err := CheckPageSize(options.PerPage); err != nil {
+		return options, err
+	}
+
+	return options, nil
+}
+
+// traceRange defaults the start time of a trace lookup to the maximum range
+// before its end time, rather than the default range: a trace ID is selective
+// enough to be looked up over the longest range allowed, and a trace older
+// than the default range would otherwise not be found.
+func traceRange(options models.QueryOptions, now time.Time) models.QueryOptions {
+	if options.StartTime != 0 {
+		return options
+	}
+	end := options.EndTime
+	if end == 0 {
+		end = uint64(now.UnixMilli())
+	}
+	options.StartTime = end - min(uint64(limits.MaxRange.Milliseconds()), end)
+	return options
+}
+
+// CheckPageSize checks the page size of a paginated query, or of a page of a
+// cached result, against the limits.
+func CheckPageSize(perPage int) error {
+	if perPage > limits.MaxPerPage {
+		return limitErrorf("per_page must be at most %d", limits.MaxPerPage)
+	}
+	return nil
+}
+
+type longRunningKey struct{}
+
+// LongRunning marks ctx as running an export or query job, whose queries are
+// bounded by the long-running execution limits.
+func LongRunning(ctx context.Context) context.Context {
+	return context.WithValue(ctx, longRunningKey{}, true)
+}
+
+// executionLimits returns the execution time and rows read allowed to the
+// queries of ctx.
+func executionLimits(ctx context.Context) (time.Duration, uint64) {
+	if long, _ := ctx.Value(longRunningKey{}).(bool); long {
+		return limits.LongMaxExecutionTime, limits.LongMaxRowsToRead
+	}
+	return limits.MaxExecutionTime, limits.MaxRowsToRead
+}
+
+// limitContext sets the execution limits of ctx as ClickHouse settings of the
+// queries run with it.
+func limitContext(ctx context.Context) context.Context {
+	maxTime, maxRows := executionLimits(ctx)
+	return clickhouse.Context(ctx, clickhouse.WithSettings(clickhouse.Settings{
+		"max_execution_time": max(int(maxTime.Seconds()), 1),
+		"max_rows_to_read":   maxRows,
+	}))
+}
+
+// limitExceeded turns the errors of queries stopped by ClickHouse for
+// exceeding the execution limits of ctx into a LimitError.
+func limitExceeded(ctx context.Context, err error) error {
+	var exception *clickhouse.Exception
+	if !errors.As(err, &exception) {
+		return err
+	}
+
+	maxTime, maxRows := executionLimits(ctx)
+	switch exception.Code {
+	case codeTimeoutExceeded:
+		return limitErrorf("query exceeded the maximum execution time of %s, narrow the time range or filters", maxTime)
+	case codeTooManyRows, codeTooManyRowsOrBytes:
+		return limitErrorf("query would read more than %d rows, narrow the time range or filters", maxRows)
+	}
+	return err
+}
+
+// formatRange formats a time range of ms milliseconds, in days from a day on.
+// The range is kept in milliseconds, as requested ranges may not fit in a
+// time.Duration.
+func formatRange(ms uint64) string {
+	const dayMs = uint64(24 * time.Hour / time.Millisecond)
+	switch {
+	case ms < dayMs:
+		return (time.Duration(ms) * time.Millisecond).Round(time.Second).String()
+	case ms%dayMs == 0:
+		return fmt.Sprintf("%dd", ms/dayMs)
+	default:
+		return fmt.Sprintf("%.1fd", float64(ms)/float64(dayMs))
+	}
+}
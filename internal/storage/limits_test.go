@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/mohammadhptp/pulse/pkg/models"
+)
+
+func TestApplyLimits(t *testing.T) {
+	now := time.UnixMilli(1700000000000)
+	nowMs := uint64(now.UnixMilli())
+	hourMs := uint64(time.Hour.Milliseconds())
+	dayMs := 24 * hourMs
+
+	tests := []struct {
+		name       string
+		options    models.QueryOptions
+		start, end uint64
+		err        string
+	}{
+		{
+			name:  "start and end unset",
+			start: nowMs - hourMs,
+			end:   nowMs,
+		},
+		{
+			name:    "start only",
+			options: models.QueryOptions{StartTime: nowMs - dayMs},
+			start:   nowMs - dayMs,
+			end:     nowMs,
+		},
+		{
+			name:    "start only in the future",
+			options: models.QueryOptions{StartTime: nowMs + hourMs},
+			start:   nowMs + hourMs,
+			end:     nowMs + hourMs,
+		},
+		{
+			name:    "end only",
+			options: models.QueryOptions{EndTime: nowMs - dayMs},
+			start:   nowMs - dayMs - hourMs,
+			end:     nowMs - dayMs,
+		},
+		{
+			name:    "end only within the default range of the epoch",
+			options: models.QueryOptions{EndTime: 1000},
+			start:   0,
+			end:     1000,
+		},
+		{
+			name:    "start after end",
+			options: models.QueryOptions{StartTime: nowMs, EndTime: nowMs - 1},
+			err:     "start_time must not be after end_time",
+		},
+		{
+			name:    "maximum range",
+			options: models.QueryOptions{StartTime: nowMs - 31*dayMs, EndTime: nowMs},
+			start:   nowMs - 31*dayMs,
+			end:     nowMs,
+		},
+		{
+			name:    "range over the maximum",
+			options: models.QueryOptions{StartTime: nowMs - 31*dayMs - 1, EndTime: nowMs},
+			err:     "time range of 31.0d exceeds the maximum of 31d",
+		},
+		{
+			name:    "range overflowing a duration",
+			options: models.QueryOptions{StartTime: 1, EndTime: math.MaxInt64},
+			err:     "time range of 106751991167.3d exceeds the maximum of 31d",
+		},
+		{
+			name:    "page size over the maximum",
+			options: models.QueryOptions{PerPage: DefaultMaxPerPage + 1},
+			err:     "per_page must be at most 1000",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options, err := ApplyLimits(tt.options, now)
+			if tt.err != "" {
+				var limitErr *LimitError
+				if !errors.As(err, &limitErr) || err.Error() != tt.err {
+					t.Fatalf("ApplyLimits() error = %v, want limit error %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ApplyLimits() error = %v", err)
+			}
+			if options.StartTime != tt.start || options.EndTime != tt.end {
+				t.Errorf("ApplyLimits() range = %d-%d, want %d-%d", options.StartTime, options.EndTime, tt.start, tt.end)
+			}
+		})
+	}
+}
+
+func TestFormatRange(t *testing.T) {
+	tests := []struct {
+		ms   uint64
+		want string
+	}{
+		{1500, "2s"},
+		{uint64(90 * time.Minute / time.Millisecond), "1h30m0s"},
+		{uint64(48 * time.Hour / time.Millisecond), "2d"},
+		{uint64(36 * time.Hour / time.Millisecond), "1.5d"},
+		{math.MaxUint64, "213503982334.6d"},
+	}
+	for _, tt := range tests {
+		if got := formatRange(tt.ms); got != tt.want {
+			t.Errorf("formatRange(%d) = %s, want %s", tt.ms, got, tt.want)
+		}
+	}
+}
+
+func TestTraceRange(t *testing.T) {
+	now := time.UnixMilli(1700000000000)
+	nowMs := uint64(now.UnixMilli())
+	maxMs := uint64(DefaultMaxQueryRange.Milliseconds())
+
+	tests := []struct {
+		name       string
+		options    models.QueryOptions
+		start, end uint64
+	}{
+		{"no range", models.QueryOptions{}, nowMs - maxMs, nowMs},
+		{"end only", models.QueryOptions{EndTime: nowMs - 1000}, nowMs - 1000 - maxMs, nowMs - 1000},
+		{"end within the maximum range of the epoch", models.QueryOptions{EndTime: 1000}, 0, 1000},
+		{"start only", models.QueryOptions{StartTime: nowMs - 1000}, nowMs - 1000, nowMs},
+		{"start and end", models.QueryOptions{StartTime: 1000, EndTime: 2000}, 1000, 2000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options, err := ApplyLimits(traceRange(tt.options, now), now)
+			if err != nil {
+				t.Fatalf("ApplyLimits() error = %v", err)
+			}
+			if options.StartTime != tt.start || options.EndTime != tt.end {
+				t.Errorf("trace range = %d-%d, want %d-%d", options.StartTime, options.EndTime, tt.start, tt.end)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/mohammadhptp/pulse/pkg/logger"
+	"github.com/mohammadhptp/pulse/pkg/models"
+	"go.uber.org/zap"
+)
+
+// levelType is the Level column type of tables created before TRACE and
+// FATAL were added, upgraded by adding them. Level is part of the sorting key,
+// whose type can only change by adding enum values, so the values of the
+// older levels are kept rather than converted to those of a new table.
+const levelType = "Enum8('DEBUG' = 1, 'INFO' = 2, 'WARN' = 3, 'ERROR' = 4, 'TRACE' = 5, 'FATAL' = 6)"
+
+// migrations bring the logs table of a deployment created by an earlier
+// version of scripts/init-clickhouse.sql up to date. Each of them is
+// idempotent. Indexes added to an existing table only cover the parts written
+// after the migration.
+var migrations = []string{
+	"ALTER TABLE gologcentral.logs ADD COLUMN IF NOT EXISTS SeverityNumber UInt8 DEFAULT " + severityDefault() + " AFTER Level",
+	"ALTER TABLE gologcentral.logs ADD COLUMN IF NOT EXISTS TraceID String AFTER RequestID",
+	"ALTER TABLE gologcentral.logs ADD COLUMN IF NOT EXISTS SpanID String AFTER TraceID",
+	"ALTER TABLE gologcentral.logs ADD COLUMN IF NOT EXISTS TraceFlags UInt8 AFTER SpanID",
+	"ALTER TABLE gologcentral.logs ADD INDEX IF NOT EXISTS idx_trace_id TraceID TYPE bloom_filter(0.01) GRANULARITY 4",
+	"ALTER TABLE gologcentral.logs ADD INDEX IF NOT EXISTS idx_span_id SpanID TYPE bloom_filter(0.01) GRANULARITY 4",
+	"ALTER TABLE gologcentral.logs ADD COLUMN IF NOT EXISTS Attributes Map(String, String) AFTER TraceFlags",
+	"ALTER TABLE gologcentral.logs ADD COLUMN IF NOT EXISTS SampleRate UInt32 DEFAULT 1 AFTER TraceFlags",
+	"ALTER TABLE gologcentral.logs ADD COLUMN IF NOT EXISTS RepeatCount UInt32 DEFAULT 1 AFTER SampleRate",
+	"ALTER TABLE gologcentral.logs ADD COLUMN IF NOT EXISTS FirstSeenMs UInt64 AFTER RepeatCount",
+	"ALTER TABLE gologcentral.logs ADD COLUMN IF NOT EXISTS LastSeenMs UInt64 AFTER FirstSeenMs",
+}
+
+// Migrate upgrades the schema of the logs table, which must exist, to the
+// columns and indexes written and queried by this version.
+func Migrate(ctx context.Context, conn clickhouse.Conn) error {
+	var current string
+	if err := conn.QueryRow(ctx,
+		"SELECT type FROM system.columns WHERE database = 'gologcentral' AND table = 'logs' AND name = 'Level'",
+	).Scan(&current); err != nil {
+		return fmt.Errorf("reading the Level column type: %w", err)
+	}
+
+	// Levels are compared by name, so the default of SeverityNumber needs
+	// every level in the enum first.
+	if !strings.Contains(current, "'"+models.LevelTrace+"'") {
+		if err := conn.Exec(ctx, "ALTER TABLE gologcentral.logs MODIFY COLUMN Level "+levelType); err != nil {
+			return fmt.Errorf("adding levels: %w", err)
+		}
+		logger.Info("Added TRACE and FATAL levels to the logs table")
+	}
+
+	for _, migration := range migrations {
+		if err := conn.Exec(ctx, migration); err != nil {
+			return fmt.Errorf("%s: %w", migration, err)
+		}
+	}
+
+	logger.Info("ClickHouse schema is up to date", zap.Int("migrations", len(migrations)))
+	return nil
+}
+
+// severityDefault computes the severity number of the level of rows stored
+// before the SeverityNumber column was added.
+func severityDefault() string {
+	var cases []string
+	for _, level := range models.Levels {
+		cases = append(cases, fmt.Sprintf("Level = '%s', %d", level, models.SeverityNumber(level)))
+	}
+	return "multiIf(" + strings.Join(cases, ", ") + ", 0)"
+}
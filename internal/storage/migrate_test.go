@@ -0,0 +1,21 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSeverityDefault(t *testing.T) {
+	want := "multiIf(Level = 'TRACE', 1, Level = 'DEBUG', 5, Level = 'INFO', 9, Level = 'WARN', 13, Level = 'ERROR', 17, Level = 'FATAL', 21, 0)"
+	if got := severityDefault(); got != want {
+		t.Errorf("severityDefault() = %s, want %s", got, want)
+	}
+}
+
+func TestMigrationsAreIdempotent(t *testing.T) {
+	for _, migration := range migrations {
+		if !strings.Contains(migration, " IF NOT EXISTS ") {
+			t.Errorf("migration is not idempotent: %s", migration)
+		}
+	}
+}
@@ -0,0 +1,396 @@
+// Package client sends events to the agent HTTP transport. Events are queued in
+// a bounded buffer and sent in compressed batches from a background goroutine,
+// with retries on throttling and server errors.
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mohammadhptp/pulse/pkg/models"
+)
+
+// Defaults applied to zero Config fields.
+const (
+	DefaultBatchSize     = 500
+	DefaultFlushInterval = time.Second
+	DefaultBufferSize    = 10000
+	DefaultMaxRetries    = 5
+	DefaultMinBackoff    = 100 * time.Millisecond
+	DefaultMaxBackoff    = 10 * time.Second
+	DefaultTimeout       = 10 * time.Second
+)
+
+// ErrClosed is returned when sending to or flushing a closed client.
+var ErrClosed = errors.New("client closed")
+
+// Config configures a Client.
+type Config struct {
+	// Endpoint is the URL of the agent events endpoint, such as
+	// http://localhost:8080/events.
+	Endpoint string
+	// Headers are added to every request, for example for authentication.
+	Headers map[string]string
+
+	// BatchSize is the maximum number of events per request.
+	BatchSize int
+	// FlushInterval is the longest an event waits for its batch to fill up.
+	FlushInterval time.Duration
+	// BufferSize is the number of events queued before Send drops them.
+	BufferSize int
+	// DisableCompression sends requests without gzip.
+	DisableCompression bool
+
+	// MaxRetries is the number of times a batch is retried after a
+	// throttling or server error, with exponential backoff between
+	// MinBackoff and MaxBackoff and full jitter. A negative value disables
+	// retries.
+	MaxRetries int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// HTTPClient sends the requests. A client with Timeout is used when nil.
+	HTTPClient *http.Client
+	Timeout    time.Duration
+
+	// OnOverflow is called with every event dropped because the buffer is
+	// full. It must not block.
+	OnOverflow func(event models.Event)
+	// OnError is called with the events of a batch that could not be sent.
+	OnError func(err error, events []models.Event)
+}
+
+// Client batches events and sends them to the agent. It is safe for concurrent
+// use.
+type Client struct {
+	config Config
+
+	queue   chan models.Event
+	flushes chan chan error
+	done    chan struct{}
+	stopped chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// New creates a client and starts its background sender.
+func New(config Config) (*Client, error) {
+	if config.Endpoint == "" {
+		return nil, errors.New("client endpoint is required")
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultBatchSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = DefaultFlushInterval
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = DefaultBufferSize
+	}
+	if config.MaxRetries == 0 {
+		config.MaxRetries = DefaultMaxRetries
+	}
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = DefaultMinBackoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = DefaultMaxBackoff
+	}
+	if config.HTTPClient == nil {
+		timeout := config.Timeout
+		if timeout <= 0 {
+			timeout = DefaultTimeout
+		}
+		config.HTTPClient = &http.Client{Timeout: timeout}
+	}
+
+	c := &Client{
+		config:  config,
+		queue:   make(chan models.Event, config.BufferSize),
+		flushes: make(chan chan error),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go c.run()
+	return c, nil
+}
+
+// Send queues an event without blocking. It returns false, after calling
+// OnOverflow, when the buffer is full or the client is closed.
+func (c *Client) Send(event models.Event) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if !c.closed {
+		select {
+		case c.queue <- event:
+			return true
+		default:
+		}
+	}
+
+	if c.config.OnOverflow != nil {
+		c.config.OnOverflow(event)
+	}
+	return false
+}
+
+// Flush sends the queued events and waits until they were sent or ctx is done.
+// It returns the error of the last failed batch.
+func (c *Client) Flush(ctx context.Context) error {
+	result := make(chan error, 1)
+	select {
+	case c.flushes <- result:
+	case <-c.stopped:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting events, sends the queued ones and stops the sender.
+// Sending gives up once ctx is done.
+func (c *Client) Close(ctx context.Context) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	c.closed = true
+	c.mu.Unlock()
+
+	err := c.Flush(ctx)
+	close(c.done)
+	<-c.stopped
+	return err
+}
+
+func (c *Client) run() {
+	defer close(c.stopped)
+
+	ticker := time.NewTicker(c.config.FlushInterval)
+	defer ticker.Stop()
+
+	// The context stops retries once the client is closed.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-c.done
+		cancel()
+	}()
+
+	batch := make([]models.Event, 0, c.config.BatchSize)
+	var lastErr error
+	send := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if failed, err := c.send(ctx, batch); err != nil {
+			lastErr = err
+			if c.config.OnError != nil {
+				c.config.OnError(err, failed)
+			}
+		}
+		batch = make([]models.Event, 0, c.config.BatchSize)
+	}
+
+	for {
+		select {
+		case event := <-c.queue:
+			batch = append(batch, event)
+			if len(batch) >= c.config.BatchSize {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		case result := <-c.flushes:
+			for drained := false; !drained; {
+				select {
+				case event := <-c.queue:
+					batch = append(batch, event)
+					if len(batch) >= c.config.BatchSize {
+						send()
+					}
+				default:
+					drained = true
+				}
+			}
+			send()
+			result <- lastErr
+			lastErr = nil
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// send posts a batch, retrying throttling, server and network errors. Only
+// the events rejected from a partially accepted batch are resent. It returns
+// the events that could not be sent.
+func (c *Client) send(ctx context.Context, events []models.Event) ([]models.Event, error) {
+	body, err := c.encode(events)
+	if err != nil {
+		return events, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		retryAfter, rejected, err := c.post(ctx, body)
+		if err == nil && len(rejected) == 0 {
+			return nil, nil
+		}
+		if err == nil {
+			events = pick(events, rejected)
+			if body, err = c.encode(events); err != nil {
+				return events, err
+			}
+			err = &StatusError{Code: http.StatusMultiStatus, Message: fmt.Sprintf("%d events rejected", len(events))}
+		}
+
+		var status *StatusError
+		retryable := !errors.As(err, &status) || status.Retryable()
+		if !retryable || c.config.MaxRetries < 0 || attempt >= c.config.MaxRetries || ctx.Err() != nil {
+			return events, err
+		}
+
+		wait := c.backoff(attempt)
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return events, err
+		}
+	}
+}
+
+// pick returns the events at indexes, ignoring those out of range.
+func pick(events []models.Event, indexes []int) []models.Event {
+	picked := make([]models.Event, 0, len(indexes))
+	for _, i := range indexes {
+		if i >= 0 && i < len(events) {
+			picked = append(picked, events[i])
+		}
+	}
+	return picked
+}
+
+// backoff returns a random wait between zero and the exponential backoff of
+// an attempt.
+func (c *Client) backoff(attempt int) time.Duration {
+	limit := c.config.MinBackoff << attempt
+	if limit <= 0 || limit > c.config.MaxBackoff {
+		limit = c.config.MaxBackoff
+	}
+	return rand.N(limit) + 1
+}
+
+// encode writes the events as a JSON array, compressed unless disabled.
+func (c *Client) encode(events []models.Event) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+
+	var gz *gzip.Writer
+	if !c.config.DisableCompression {
+		gz = gzip.NewWriter(&buf)
+		w = gz
+	}
+	if err := json.NewEncoder(w).Encode(events); err != nil {
+		return nil, err
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// post sends an encoded batch and returns the delay requested by a Retry-After
+// header, and the indexes of the events rejected from a partially accepted
+// batch.
+func (c *Client) post(ctx context.Context, body []byte) (time.Duration, []int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if !c.config.DisableCompression {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for name, value := range c.config.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := c.config.HTTPClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	var retryAfter time.Duration
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		retryAfter = time.Duration(seconds) * time.Second
+	}
+
+	if resp.StatusCode == http.StatusMultiStatus {
+		var partial struct {
+			Errors []struct {
+				Index int `json:"index"`
+			} `json:"errors"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&partial); err != nil {
+			return retryAfter, nil, fmt.Errorf("decoding partial success: %w", err)
+		}
+		rejected := make([]int, 0, len(partial.Errors))
+		for _, e := range partial.Errors {
+			rejected = append(rejected, e.Index)
+		}
+		return retryAfter, rejected, nil
+	}
+	if resp.StatusCode < 300 {
+		io.Copy(io.Discard, resp.Body)
+		return 0, nil, nil
+	}
+
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return retryAfter, nil, &StatusError{Code: resp.StatusCode, Message: string(bytes.TrimSpace(message))}
+}
+
+// StatusError is returned for requests the agent answered with an error
+// status.
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("agent returned %d: %s", e.Code, e.Message)
+}
+
+// Retryable reports whether the request may succeed when retried, that is for
+// throttling, server errors and events rejected from a partially accepted
+// batch.
+func (e *StatusError) Retryable() bool {
+	return e.Code == http.StatusTooManyRequests || e.Code == http.StatusMultiStatus || e.Code >= 500
+}
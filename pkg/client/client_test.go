@@ -0,0 +1,111 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mohammadhptp/pulse/pkg/models"
+)
+
+func TestSendResendsRejectedEvents(t *testing.T) {
+	tests := []struct {
+		name string
+		// rejects maps the attempt to the messages the agent rejects.
+		rejects    []map[string]bool
+		maxRetries int
+		attempts   [][]string
+		failed     []string
+	}{
+		{
+			name:     "accepted",
+			rejects:  []map[string]bool{{}},
+			attempts: [][]string{{"a", "b", "c"}},
+		},
+		{
+			name:     "partial then accepted",
+			rejects:  []map[string]bool{{"b": true}, {}},
+			attempts: [][]string{{"a", "b", "c"}, {"b"}},
+		},
+		{
+			name:       "rejected until retries run out",
+			rejects:    []map[string]bool{{"a": true, "c": true}, {"c": true}, {"c": true}},
+			maxRetries: 2,
+			attempts:   [][]string{{"a", "b", "c"}, {"a", "c"}, {"c"}},
+			failed:     []string{"c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var attempts [][]string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var events []models.Event
+				if err := json.NewDecoder(r.Body).Decode(&events); err != nil {
+					t.Error(err)
+				}
+
+				mu.Lock()
+				rejects := tt.rejects[len(attempts)]
+				var messages []string
+				for _, e := range events {
+					messages = append(messages, e.Message)
+				}
+				attempts = append(attempts, messages)
+				mu.Unlock()
+
+				type batchError struct {
+					Index int    `json:"index"`
+					Error string `json:"error"`
+				}
+				var errs []batchError
+				for i, e := range events {
+					if rejects[e.Message] {
+						errs = append(errs, batchError{Index: i, Error: "kafka unavailable"})
+					}
+				}
+				if len(errs) == 0 {
+					w.WriteHeader(http.StatusAccepted)
+					return
+				}
+				w.WriteHeader(http.StatusMultiStatus)
+				json.NewEncoder(w).Encode(map[string]interface{}{"status": "partial", "errors": errs})
+			}))
+			defer server.Close()
+
+			c, err := New(Config{
+				Endpoint:           server.URL,
+				DisableCompression: true,
+				MaxRetries:         tt.maxRetries,
+				MinBackoff:         time.Millisecond,
+				MaxBackoff:         time.Millisecond,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close(context.Background())
+
+			batch := []models.Event{{Message: "a"}, {Message: "b"}, {Message: "c"}}
+			failed, err := c.send(context.Background(), batch)
+			if (err != nil) != (tt.failed != nil) {
+				t.Fatalf("send() error = %v, want failure %v", err, tt.failed != nil)
+			}
+
+			var failedMessages []string
+			for _, e := range failed {
+				failedMessages = append(failedMessages, e.Message)
+			}
+			if !reflect.DeepEqual(failedMessages, tt.failed) {
+				t.Errorf("failed events = %v, want %v", failedMessages, tt.failed)
+			}
+			if !reflect.DeepEqual(attempts, tt.attempts) {
+				t.Errorf("attempts = %v, want %v", attempts, tt.attempts)
+			}
+		})
+	}
+}
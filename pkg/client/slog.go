@@ -0,0 +1,162 @@
+package client
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/mohammadhptp/pulse/pkg/models"
+)
+
+// Attributes lifted into event fields by the log adapters instead of being
+// sent as attributes.
+const (
+	attrTraceID   = "trace_id"
+	attrSpanID    = "span_id"
+	attrRequestID = "request_id"
+	attrHost      = "host"
+)
+
+// SlogHandler is a slog.Handler sending records to a Client as events of a
+// service. Attributes are sent as event attributes, with group names joined by
+// dots, except trace_id, span_id, request_id and host outside of groups,
+// which set the event fields of the same name.
+type SlogHandler struct {
+	client  *Client
+	service string
+	host    string
+	level   slog.Leveler
+
+	attrs []slog.Attr
+	// prefix is the dotted path of the groups opened by WithGroup.
+	prefix string
+}
+
+// SlogOptions configures a SlogHandler.
+type SlogOptions struct {
+	// Level is the minimum level sent, info by default.
+	Level slog.Leveler
+}
+
+// NewSlogHandler creates a handler sending records of service to c.
+func NewSlogHandler(c *Client, service string, opts *SlogOptions) *SlogHandler {
+	var level slog.Leveler = slog.LevelInfo
+	if opts != nil && opts.Level != nil {
+		level = opts.Level
+	}
+	host, _ := os.Hostname()
+	return &SlogHandler{client: c, service: service, host: host, level: level}
+}
+
+func (h *SlogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *SlogHandler) Handle(_ context.Context, record slog.Record) error {
+	event := models.Event{
+		EventTimeMs: uint64(record.Time.UnixMilli()),
+		Service:     h.service,
+		Level:       SlogLevel(record.Level),
+		Message:     record.Message,
+		Host:        h.host,
+		Attributes:  map[string]string{},
+	}
+	if record.Time.IsZero() {
+		event.EventTimeMs = uint64(time.Now().UnixMilli())
+	}
+
+	for _, attr := range h.attrs {
+		setSlogAttr(&event, "", attr)
+	}
+	record.Attrs(func(attr slog.Attr) bool {
+		setSlogAttr(&event, h.prefix, attr)
+		return true
+	})
+	if len(event.Attributes) == 0 {
+		event.Attributes = nil
+	}
+
+	h.client.Send(event)
+	return nil
+}
+
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	clone := *h
+	clone.attrs = make([]slog.Attr, 0, len(h.attrs)+len(attrs))
+	clone.attrs = append(clone.attrs, h.attrs...)
+	for _, attr := range attrs {
+		// Attributes are stored with their full group path, so that records
+		// do not need to know the groups opened before them.
+		if h.prefix != "" {
+			attr = slog.Attr{Key: h.prefix + attr.Key, Value: attr.Value}
+		}
+		clone.attrs = append(clone.attrs, attr)
+	}
+	return &clone
+}
+
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.prefix = h.prefix + name + "."
+	return &clone
+}
+
+// setSlogAttr sets an attribute on an event, flattening groups into dotted
+// names.
+func setSlogAttr(e *models.Event, prefix string, attr slog.Attr) {
+	value := attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+
+	if value.Kind() == slog.KindGroup {
+		group := prefix
+		// Inline groups, with an empty key, add their attributes directly.
+		if attr.Key != "" {
+			group += attr.Key + "."
+		}
+		for _, a := range value.Group() {
+			setSlogAttr(e, group, a)
+		}
+		return
+	}
+
+	name := prefix + attr.Key
+	text := value.String()
+	switch name {
+	case attrTraceID:
+		e.TraceID = text
+	case attrSpanID:
+		e.SpanID = text
+	case attrRequestID:
+		e.RequestID = text
+	case attrHost:
+		e.Host = text
+	default:
+		if value.Kind() == slog.KindTime {
+			text = value.Time().Format(time.RFC3339Nano)
+		}
+		e.Attributes[name] = text
+	}
+}
+
+// SlogLevel maps a slog level onto the event levels.
+func SlogLevel(level slog.Level) string {
+	switch {
+	case level < slog.LevelInfo:
+		return models.LevelDebug
+	case level < slog.LevelWarn:
+		return models.LevelInfo
+	case level < slog.LevelError:
+		return models.LevelWarn
+	default:
+		return models.LevelError
+	}
+}
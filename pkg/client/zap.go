@@ -0,0 +1,82 @@
+package client
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/mohammadhptp/pulse/pkg/logger"
+	"go.uber.org/zap/zapcore"
+)
+
+// zapSyncTimeout bounds the flush of a ZapCore Sync.
+const zapSyncTimeout = 5 * time.Second
+
+// ZapCore is a zapcore.Core sending entries to a Client as events of a
+// service. Fields become event attributes, like the self-logs forwarded by
+// the agent, except trace_id, span_id, request_id and host, which set the
+// event fields of the same name.
+type ZapCore struct {
+	zapcore.LevelEnabler
+	client  *Client
+	service string
+	host    string
+	fields  []zapcore.Field
+}
+
+// NewZapCore creates a core sending entries of service at or above level to c.
+// Combine it with an existing core through zapcore.NewTee.
+func NewZapCore(c *Client, service string, level zapcore.LevelEnabler) *ZapCore {
+	host, _ := os.Hostname()
+	return &ZapCore{LevelEnabler: level, client: c, service: service, host: host}
+}
+
+func (c *ZapCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.fields = append(c.fields[:len(c.fields):len(c.fields)], fields...)
+	return &clone
+}
+
+func (c *ZapCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return ce.AddCore(entry, c)
+	}
+	return ce
+}
+
+func (c *ZapCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	event := logger.EntryEvent(c.service, c.host, entry, append(c.fields[:len(c.fields):len(c.fields)], fields...))
+	for name, value := range event.Attributes {
+		switch name {
+		case attrTraceID:
+			event.TraceID = value
+		case attrSpanID:
+			event.SpanID = value
+		case attrRequestID:
+			event.RequestID = value
+		case attrHost:
+			event.Host = value
+		default:
+			continue
+		}
+		delete(event.Attributes, name)
+	}
+	if len(event.Attributes) == 0 {
+		event.Attributes = nil
+	}
+
+	c.client.Send(event)
+
+	// The process may exit right after entries above the error level.
+	if entry.Level > zapcore.ErrorLevel {
+		return c.Sync()
+	}
+	return nil
+}
+
+// Sync sends the queued events, waiting for a bounded time.
+func (c *ZapCore) Sync() error {
+	ctx, cancel := context.WithTimeout(context.Background(), zapSyncTimeout)
+	defer cancel()
+	return c.client.Flush(ctx)
+}
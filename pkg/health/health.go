@@ -0,0 +1,126 @@
+// Package health serves the liveness and readiness endpoints of the agent and
+// the collector.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// checkTimeout bounds every dependency check of a readiness request.
+const checkTimeout = 2 * time.Second
+
+// Check reports whether a dependency is usable.
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Health tracks the dependency checks of a process and whether it is draining
+// for shutdown.
+type Health struct {
+	mu       sync.RWMutex
+	checks   []namedCheck
+	draining atomic.Bool
+}
+
+// New creates a Health without checks.
+func New() *Health {
+	return &Health{}
+}
+
+// Add registers a dependency check run on every readiness request.
+func (h *Health) Add(name string, check Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks = append(h.checks, namedCheck{name: name, check: check})
+}
+
+// SetDraining marks the process as shutting down, after which it is no longer
+// ready.
+func (h *Health) SetDraining() {
+	h.draining.Store(true)
+}
+
+// CheckStatus is the outcome of one dependency check.
+type CheckStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Status is the readiness of a process with the detail of each dependency.
+type Status struct {
+	Status   string                 `json:"status"`
+	Draining bool                   `json:"draining,omitempty"`
+	Checks   map[string]CheckStatus `json:"checks"`
+}
+
+// Ready runs every check concurrently and reports whether the process is
+// ready.
+func (h *Health) Ready(ctx context.Context) (Status, bool) {
+	h.mu.RLock()
+	checks := h.checks
+	h.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	results := make([]error, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.check(ctx)
+		}()
+	}
+	wg.Wait()
+
+	status := Status{
+		Status:   "ready",
+		Draining: h.draining.Load(),
+		Checks:   make(map[string]CheckStatus, len(checks)),
+	}
+	ready := !status.Draining
+	for i, c := range checks {
+		if err := results[i]; err != nil {
+			status.Checks[c.name] = CheckStatus{Status: "error", Error: err.Error()}
+			ready = false
+			continue
+		}
+		status.Checks[c.name] = CheckStatus{Status: "ok"}
+	}
+	if !ready {
+		status.Status = "not_ready"
+	}
+	return status, ready
+}
+
+// HandleLive reports that the process is alive. It does not check
+// dependencies.
+func (h *Health) HandleLive(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// HandleReady reports the readiness of the process, with 503 Service
+// Unavailable when a dependency fails or the process is draining.
+func (h *Health) HandleReady(w http.ResponseWriter, r *http.Request) {
+	status, ready := h.Ready(r.Context())
+	code := http.StatusOK
+	if !ready {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, status)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,291 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mohammadhptp/pulse/pkg/models"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// SelfSource is the source of events forwarded by a ForwardCore.
+const SelfSource = "self"
+
+// eventServiceKey is the key of the field naming the service of the event
+// handled while an entry was logged. Encoders skip the field.
+const eventServiceKey = "pulse.event_service"
+
+type eventServiceContextKey struct{}
+
+const (
+	defaultForwardBuffer = 1024
+	forwardSyncTimeout   = 2 * time.Second
+)
+
+// Sink receives log entries forwarded as events.
+type Sink func(event models.Event) error
+
+// ForwardCore is a zapcore.Core forwarding log entries as events to a sink,
+// such as the agent pipeline or Kafka. Entries are queued and handed to the
+// sink from a background goroutine; they are dropped when the queue is full.
+//
+// Entries logged about events of the forwarding service itself, recognised by
+// a "service" field naming it or by being logged with a context marked by
+// WithEventService, are not forwarded. Failures to handle a forwarded event
+// would otherwise feed new events back into the sink forever.
+type ForwardCore struct {
+	zapcore.LevelEnabler
+	fields    []zapcore.Field
+	forwarder *forwarder
+}
+
+type forwarder struct {
+	service string
+	host    string
+	sink    Sink
+
+	queue     chan forwardItem
+	done      chan struct{}
+	closeOnce sync.Once
+
+	dropped atomic.Uint64
+	failed  atomic.Uint64
+}
+
+// forwardItem is either an event or, when flushed is set, a marker signalled
+// once the events queued before it were handed to the sink.
+type forwardItem struct {
+	event   models.Event
+	flushed chan struct{}
+}
+
+// NewForwardCore creates a core forwarding entries at or above level as events
+// of service, holding at most buffer entries in its queue.
+func NewForwardCore(service string, level zapcore.LevelEnabler, sink Sink, buffer int) *ForwardCore {
+	if buffer <= 0 {
+		buffer = defaultForwardBuffer
+	}
+	host, _ := os.Hostname()
+
+	f := &forwarder{
+		service: service,
+		host:    host,
+		sink:    sink,
+		queue:   make(chan forwardItem, buffer),
+		done:    make(chan struct{}),
+	}
+	go f.run()
+
+	return &ForwardCore{LevelEnabler: level, forwarder: f}
+}
+
+func (c *ForwardCore) With(fields []zapcore.Field) zapcore.Core {
+	return &ForwardCore{
+		LevelEnabler: c.LevelEnabler,
+		fields:       append(c.fields[:len(c.fields):len(c.fields)], fields...),
+		forwarder:    c.forwarder,
+	}
+}
+
+func (c *ForwardCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return ce.AddCore(entry, c)
+	}
+	return ce
+}
+
+func (c *ForwardCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	f := c.forwarder
+	if f.about(c.fields) || f.about(fields) {
+		return nil
+	}
+
+	event := EntryEvent(f.service, f.host, entry, append(c.fields[:len(c.fields):len(c.fields)], fields...))
+	event.Source = SelfSource
+	select {
+	case f.queue <- forwardItem{event: event}:
+	default:
+		f.dropped.Add(1)
+	}
+
+	// The process may exit right after entries above the error level.
+	if entry.Level > zapcore.ErrorLevel {
+		return c.Sync()
+	}
+	return nil
+}
+
+// Sync waits, for a bounded time, until the queued entries were handed to the
+// sink.
+func (c *ForwardCore) Sync() error {
+	flushed := make(chan struct{})
+	timeout := time.NewTimer(forwardSyncTimeout)
+	defer timeout.Stop()
+
+	select {
+	case c.forwarder.queue <- forwardItem{flushed: flushed}:
+	case <-c.forwarder.done:
+		return nil
+	case <-timeout.C:
+		return nil
+	}
+
+	select {
+	case <-flushed:
+	case <-c.forwarder.done:
+	case <-timeout.C:
+	}
+	return nil
+}
+
+// Close flushes the queued entries and stops forwarding. Entries logged after
+// Close are dropped.
+func (c *ForwardCore) Close() {
+	c.Sync()
+	c.forwarder.closeOnce.Do(func() { close(c.forwarder.done) })
+}
+
+// Dropped returns the number of entries dropped because the queue was full or
+// the sink failed.
+func (c *ForwardCore) Dropped() uint64 {
+	return c.forwarder.dropped.Load() + c.forwarder.failed.Load()
+}
+
+func (f *forwarder) run() {
+	for {
+		select {
+		case <-f.done:
+			return
+		case item := <-f.queue:
+			if item.flushed != nil {
+				close(item.flushed)
+				continue
+			}
+			// Sink errors are not logged, as they would be forwarded too.
+			if err := f.sink(item.event); err != nil {
+				f.failed.Add(1)
+			}
+		}
+	}
+}
+
+// about reports whether fields describe an event of the forwarding service.
+func (f *forwarder) about(fields []zapcore.Field) bool {
+	for _, field := range fields {
+		named := field.Key == "service" && field.Type == zapcore.StringType ||
+			field.Key == eventServiceKey && field.Type == zapcore.SkipType
+		if named && field.String == f.service {
+			return true
+		}
+	}
+	return false
+}
+
+// WithEventService marks ctx as handling an event of service, so that entries
+// logged with it, such as by ErrorContext, about the events of a forwarding
+// service are not forwarded.
+func WithEventService(ctx context.Context, service string) context.Context {
+	return context.WithValue(ctx, eventServiceContextKey{}, service)
+}
+
+// contextFields returns the fields of entries logged while handling ctx.
+func contextFields(ctx context.Context) []zapcore.Field {
+	service, ok := ctx.Value(eventServiceContextKey{}).(string)
+	if !ok {
+		return nil
+	}
+	return []zapcore.Field{{Key: eventServiceKey, Type: zapcore.SkipType, String: service}}
+}
+
+// EntryEvent converts a log entry into an event of service logged on host.
+// Fields, the logger name, the caller and the stack trace become attributes.
+func EntryEvent(service, host string, entry zapcore.Entry, fields []zapcore.Field) models.Event {
+	encoder := zapcore.NewMapObjectEncoder()
+	for _, field := range fields {
+		field.AddTo(encoder)
+	}
+
+	attributes := make(map[string]string, len(encoder.Fields)+3)
+	for name, value := range encoder.Fields {
+		attributes[name] = attributeValue(value)
+	}
+	if entry.LoggerName != "" {
+		attributes["logger"] = entry.LoggerName
+	}
+	if entry.Caller.Defined {
+		attributes["caller"] = entry.Caller.TrimmedPath()
+	}
+	if entry.Stack != "" {
+		attributes["stacktrace"] = entry.Stack
+	}
+
+	return models.Event{
+		EventTimeMs: uint64(entry.Time.UnixMilli()),
+		Service:     service,
+		Level:       EventLevel(entry.Level),
+		Message:     entry.Message,
+		Host:        host,
+		Attributes:  attributes,
+	}
+}
+
+// EventLevel maps a zap level onto the event levels.
+func EventLevel(level zapcore.Level) string {
+	switch {
+	case level < zapcore.InfoLevel:
+		return models.LevelDebug
+	case level == zapcore.InfoLevel:
+		return models.LevelInfo
+	case level == zapcore.WarnLevel:
+		return models.LevelWarn
+	case level == zapcore.ErrorLevel:
+		return models.LevelError
+	default:
+		return models.LevelFatal
+	}
+}
+
+func attributeValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, uintptr,
+		float32, float64, complex64, complex128, time.Duration, fmt.Stringer:
+		return fmt.Sprint(v)
+	default:
+		// Objects, arrays and reflected values are encoded as JSON.
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(encoded)
+	}
+}
+
+// Tee sends every entry written through the logger to core as well. It must be
+// called before the logger is used concurrently.
+func Tee(core zapcore.Core) {
+	ensureLogger()
+	Logger = Logger.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(c, core)
+	}))
+	zap.ReplaceGlobals(Logger)
+}
+
+// ParseLevel returns the zap level named by level, defaulting to info.
+func ParseLevel(level string) zapcore.Level {
+	var l zapcore.Level
+	if err := l.UnmarshalText([]byte(strings.ToLower(level))); err != nil {
+		return zapcore.InfoLevel
+	}
+	return l
+}
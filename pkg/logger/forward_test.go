@@ -0,0 +1,108 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mohammadhptp/pulse/pkg/models"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// TestForwardCoreSelfLogLoop reproduces a collector storing its own log
+// entries while the store is down: every failed insert logs an error, which
+// is forwarded back into the topic as an event to insert.
+func TestForwardCoreSelfLogLoop(t *testing.T) {
+	const service = "pulse-collector"
+	failure := errors.New("connection refused")
+
+	tests := []struct {
+		name string
+		// insert logs the failure to store an event like storage.InsertEvent.
+		insert func(ctx context.Context, e models.Event)
+		loops  bool
+	}{
+		{
+			name: "logged without the event",
+			insert: func(ctx context.Context, e models.Event) {
+				Error("Failed to send batch", zap.Error(failure))
+			},
+			loops: true,
+		},
+		{
+			name: "logged with the event context",
+			insert: func(ctx context.Context, e models.Event) {
+				ErrorContext(WithEventService(ctx, e.Service), "Failed to send batch", zap.Error(failure))
+			},
+		},
+		{
+			name: "logged with the event service",
+			insert: func(ctx context.Context, e models.Event) {
+				Error("Failed to insert event", zap.Error(failure), zap.String("service", e.Service))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			topic := make(chan models.Event, 100)
+			sink := func(e models.Event) error {
+				select {
+				case topic <- e:
+					return nil
+				default:
+					return errors.New("topic full")
+				}
+			}
+			core := NewForwardCore(service, zapcore.DebugLevel, sink, 0)
+			defer core.Close()
+
+			previous := Logger
+			Logger = zap.New(core)
+			defer func() { Logger = previous }()
+
+			Error("Failed to connect to ClickHouse", zap.Error(failure))
+
+			// Consume the topic like the collector, until no event arrives.
+			consumed := 0
+			for consumed < 10 {
+				select {
+				case e := <-topic:
+					consumed++
+					tt.insert(context.Background(), e)
+					core.Sync()
+					continue
+				case <-time.After(50 * time.Millisecond):
+				}
+				break
+			}
+
+			if loops := consumed >= 10; loops != tt.loops {
+				t.Errorf("consumed %d events, loops = %v, want %v", consumed, loops, tt.loops)
+			}
+			if !tt.loops && consumed != 1 {
+				t.Errorf("consumed %d events, want only the original entry", consumed)
+			}
+		})
+	}
+}
+
+func TestEventServiceFieldNotEncoded(t *testing.T) {
+	fields := contextFields(WithEventService(context.Background(), "api"))
+	if len(fields) != 1 {
+		t.Fatalf("contextFields() = %v, want one field", fields)
+	}
+
+	event := EntryEvent("pulse-agent", "host", zapcore.Entry{Message: "failed"}, append(fields, zap.String("topic", "logs")))
+	if _, ok := event.Attributes[eventServiceKey]; ok {
+		t.Errorf("attributes %v include the event service marker", event.Attributes)
+	}
+	if event.Attributes["topic"] != "logs" {
+		t.Errorf("attributes %v lost the topic", event.Attributes)
+	}
+
+	if contextFields(context.Background()) != nil {
+		t.Error("unmarked context has fields")
+	}
+}
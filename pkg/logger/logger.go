@@ -2,6 +2,7 @@
 package logger
 
 import (
+	"context"
 	"sync"
 
 	"go.uber.org/zap"
@@ -93,6 +94,13 @@ func Error(msg string, fields ...zapcore.Field) {
 	Logger.Error(msg, fields...)
 }
 
+// ErrorContext logs an error like Error, marking it with the event handled by
+// ctx.
+func ErrorContext(ctx context.Context, msg string, fields ...zapcore.Field) {
+	ensureLogger()
+	Logger.Error(msg, append(fields, contextFields(ctx)...)...)
+}
+
 func Fatal(msg string, fields ...zapcore.Field) {
 	ensureLogger()
 	Logger.Fatal(msg, fields...)
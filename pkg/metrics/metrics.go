@@ -0,0 +1,186 @@
+// Package metrics defines the Prometheus metrics exposed by the agent and the
+// collector on /metrics.
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "pulse"
+
+// Event results of the agent and the collector.
+const (
+	ResultAccepted  = "accepted"
+	ResultRejected  = "rejected"
+	ResultProcessed = "processed"
+	ResultDropped   = "dropped"
+	ResultFailed    = "failed"
+	ResultInvalid   = "invalid"
+)
+
+// Ingest metrics, labelled by transport.
+var (
+	IngestRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "ingest",
+		Name:      "requests_total",
+		Help:      "Ingest requests by transport and HTTP or gRPC status.",
+	}, []string{"transport", "status"})
+
+	IngestEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "ingest",
+		Name:      "events_total",
+		Help:      "Events received by transport, accepted or rejected by the agent.",
+	}, []string{"transport", "result"})
+
+	IngestBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "ingest",
+		Name:      "bytes_total",
+		Help:      "Bytes received by transport.",
+	}, []string{"transport"})
+)
+
+// Agent metrics.
+var (
+	AgentEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "agent",
+		Name:      "events_total",
+		Help:      "Events handled by the agent, processed, dropped by the pipeline or failed.",
+	}, []string{"result"})
+
+	KafkaWriteDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "write_duration_seconds",
+		Help:      "Latency of Kafka writes.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
+	})
+
+	KafkaWriteErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "write_errors_total",
+		Help:      "Failed Kafka writes.",
+	})
+)
+
+// Collector metrics.
+var (
+	ConsumerMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "messages_total",
+		Help:      "Kafka messages consumed by the collector, processed, invalid or failed.",
+	}, []string{"result"})
+
+	ConsumerLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "lag",
+		Help:      "Messages behind the end of each partition, as of the last message consumed from it.",
+	}, []string{"partition"})
+
+	ClickHouseInsertDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "clickhouse",
+		Name:      "insert_duration_seconds",
+		Help:      "Latency of ClickHouse inserts.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
+	})
+
+	ClickHouseInsertedRows = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "clickhouse",
+		Name:      "inserted_rows_total",
+		Help:      "Rows inserted into ClickHouse.",
+	})
+
+	ClickHouseInsertFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "clickhouse",
+		Name:      "insert_failures_total",
+		Help:      "Failed ClickHouse inserts.",
+	})
+
+	QueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "clickhouse",
+		Name:      "query_duration_seconds",
+		Help:      "Latency of ClickHouse queries by query type.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 12),
+	}, []string{"query"})
+)
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// InstrumentHandler counts the requests served by next by status, and the
+// bytes of their bodies, for an ingest transport.
+func InstrumentHandler(transport string, next http.Handler) http.Handler {
+	bytes := IngestBytes.WithLabelValues(transport)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		if r.Body != nil {
+			r.Body = &countingBody{ReadCloser: r.Body, reader: countingReader{r.Body, bytes}}
+		}
+
+		next.ServeHTTP(recorder, r)
+		IngestRequests.WithLabelValues(transport, strconv.Itoa(recorder.status)).Inc()
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// CountBytes returns a reader counting the bytes read from r in the ingest
+// bytes of a transport, for transports reading from a stream.
+func CountBytes(transport string, r io.Reader) io.Reader {
+	return countingReader{reader: r, counter: IngestBytes.WithLabelValues(transport)}
+}
+
+type countingReader struct {
+	reader  io.Reader
+	counter prometheus.Counter
+}
+
+func (r countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.counter.Add(float64(n))
+	return n, err
+}
+
+type countingBody struct {
+	io.ReadCloser
+	reader countingReader
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	return b.reader.Read(p)
+}
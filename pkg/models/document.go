@@ -0,0 +1,36 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// FlattenDocument flattens nested objects into dotted keys. Scalars are
+// formatted as strings and arrays are encoded as JSON.
+func FlattenDocument(document map[string]interface{}) map[string]string {
+	fields := make(map[string]string)
+
+	var flatten func(prefix string, value interface{})
+	flatten = func(prefix string, value interface{}) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for key, nested := range v {
+				if prefix != "" {
+					key = prefix + "." + key
+				}
+				flatten(key, nested)
+			}
+		case string:
+			fields[prefix] = v
+		case nil:
+		case []interface{}:
+			encoded, _ := json.Marshal(v)
+			fields[prefix] = string(encoded)
+		default:
+			fields[prefix] = fmt.Sprint(v)
+		}
+	}
+	flatten("", document)
+
+	return fields
+}
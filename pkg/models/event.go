@@ -1,17 +1,40 @@
 package models
 
 type Event struct {
-	EventTimeMs uint64 `json:"event_time_ms"`
-	Service     string `json:"service"`
-	Level       string `json:"level"`
-	Message     string `json:"message"`
-	Host        string `json:"host"`
-	RequestID   string `json:"request_id"`
+	EventTimeMs    uint64 `json:"event_time_ms"`
+	Service        string `json:"service"`
+	Level          string `json:"level"`
+	SeverityNumber uint8  `json:"severity_number"`
+	Message        string `json:"message"`
+	Host           string `json:"host"`
+	RequestID      string `json:"request_id"`
+	TraceID        string `json:"trace_id,omitempty"`
+	SpanID         string `json:"span_id,omitempty"`
+	TraceFlags     uint8  `json:"trace_flags,omitempty"`
+	// SampleRate is the number of events this event stands for after
+	// sampling. Zero means the event was not sampled.
+	SampleRate uint32 `json:"sample_rate,omitempty"`
+	// RepeatCount is the number of identical events this event stands for,
+	// logged between FirstSeenMs and LastSeenMs. Zero means the event was not
+	// deduplicated.
+	RepeatCount uint32 `json:"repeat_count,omitempty"`
+	FirstSeenMs uint64 `json:"first_seen_ms,omitempty"`
+	LastSeenMs  uint64 `json:"last_seen_ms,omitempty"`
+
+	Attributes map[string]string `json:"attributes,omitempty"`
+
+	// Source names the transport or file input that received the event. It
+	// is used to select agent processing and is not shipped.
+	Source string `json:"-"`
+	// RemoteAddr is the address of the client that sent the event, when the
+	// transport has one. It is only shipped through enrichment.
+	RemoteAddr string `json:"-"`
 }
 
 type QueryOptions struct {
 	Service     string `json:"service"`
 	Level       string `json:"level"`
+	LevelOp     string `json:"level_op"`
 	Host        string `json:"host"`
 	StartTime   uint64 `json:"start_time"`
 	EndTime     uint64 `json:"end_time"`
@@ -19,15 +42,78 @@ type QueryOptions struct {
 	PerPage     int    `json:"per_page"`
 	SortOrder   string `json:"sort_order"`
 	RequestID   string `json:"request_id"`
+	TraceID     string `json:"trace_id"`
 	SearchQuery string `json:"search_query"`
 }
 
 type PaginatedResponse struct {
-	Data        []Event `json:"data"`
-	Total       int64   `json:"total"`
-	PerPage     int     `json:"per_page"`
-	CurrentPage int     `json:"current_page"`
-	LastPage    int     `json:"last_page"`
-	From        int     `json:"from"`
-	To          int     `json:"to"`
+	Data  []Event `json:"data"`
+	Total int64   `json:"total"`
+	// EstimatedTotal extrapolates Total to the events logged before sampling.
+	EstimatedTotal int64 `json:"estimated_total"`
+	PerPage        int   `json:"per_page"`
+	CurrentPage    int   `json:"current_page"`
+	LastPage       int   `json:"last_page"`
+	From           int   `json:"from"`
+	To             int   `json:"to"`
+}
+
+// HistogramBucket counts the events in a time bucket starting at TimeMs.
+type HistogramBucket struct {
+	TimeMs         uint64 `json:"time_ms"`
+	Count          uint64 `json:"count"`
+	EstimatedCount uint64 `json:"estimated_count"`
+}
+
+// FacetValue counts the events with a value of a faceted field.
+type FacetValue struct {
+	Value          string `json:"value"`
+	Count          uint64 `json:"count"`
+	EstimatedCount uint64 `json:"estimated_count"`
+}
+
+// QueryEstimate reports the parts, rows and marks ClickHouse estimates it
+// reads for a query over the resolved time range, and whether the rows are
+// within the rows the query may read.
+type QueryEstimate struct {
+	StartTime     uint64 `json:"start_time"`
+	EndTime       uint64 `json:"end_time"`
+	Parts         uint64 `json:"parts"`
+	Rows          uint64 `json:"rows"`
+	Marks         uint64 `json:"marks"`
+	MaxRowsToRead uint64 `json:"max_rows_to_read"`
+	WithinLimits  bool   `json:"within_limits"`
+}
+
+// Statuses of a query job.
+const (
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// QueryJob reports the state of an asynchronous query job.
+type QueryJob struct {
+	ID       string        `json:"id"`
+	Status   string        `json:"status"`
+	Query    QueryOptions  `json:"query"`
+	Progress QueryProgress `json:"progress"`
+	// Rows is the number of events read so far, or of the result once the job
+	// is done. Truncated reports that the row cap cut the result short.
+	Rows         int    `json:"rows"`
+	Truncated    bool   `json:"truncated,omitempty"`
+	Error        string `json:"error,omitempty"`
+	ElapsedMs    int64  `json:"elapsed_ms"`
+	CreatedAtMs  int64  `json:"created_at_ms"`
+	FinishedAtMs int64  `json:"finished_at_ms,omitempty"`
+	// ExpiresAtMs is when the result of a finished job is dropped.
+	ExpiresAtMs int64 `json:"expires_at_ms,omitempty"`
+}
+
+// QueryProgress reports the rows and bytes ClickHouse has read for a query,
+// out of the rows it estimates reading in total.
+type QueryProgress struct {
+	RowsRead        uint64 `json:"rows_read"`
+	BytesRead       uint64 `json:"bytes_read"`
+	TotalRowsToRead uint64 `json:"total_rows_to_read"`
 }
@@ -0,0 +1,118 @@
+package models
+
+import "strings"
+
+// Canonical severity levels. Their severity numbers follow the OpenTelemetry
+// log data model, where each level covers a range of four numbers.
+const (
+	LevelTrace = "TRACE"
+	LevelDebug = "DEBUG"
+	LevelInfo  = "INFO"
+	LevelWarn  = "WARN"
+	LevelError = "ERROR"
+	LevelFatal = "FATAL"
+)
+
+// Levels lists the canonical levels ordered from least to most severe.
+var Levels = []string{LevelTrace, LevelDebug, LevelInfo, LevelWarn, LevelError, LevelFatal}
+
+var severityNumbers = map[string]uint8{
+	LevelTrace: 1,
+	LevelDebug: 5,
+	LevelInfo:  9,
+	LevelWarn:  13,
+	LevelError: 17,
+	LevelFatal: 21,
+}
+
+var levelAliases = map[string]string{
+	"TRACE":         LevelTrace,
+	"TRC":           LevelTrace,
+	"FINEST":        LevelTrace,
+	"DEBUG":         LevelDebug,
+	"DBG":           LevelDebug,
+	"FINE":          LevelDebug,
+	"INFO":          LevelInfo,
+	"INF":           LevelInfo,
+	"INFORMATION":   LevelInfo,
+	"INFORMATIONAL": LevelInfo,
+	"NOTICE":        LevelInfo,
+	"WARN":          LevelWarn,
+	"WRN":           LevelWarn,
+	"WARNING":       LevelWarn,
+	"ERROR":         LevelError,
+	"ERR":           LevelError,
+	"SEVERE":        LevelError,
+	"FATAL":         LevelFatal,
+	"FTL":           LevelFatal,
+	"CRITICAL":      LevelFatal,
+	"CRIT":          LevelFatal,
+	"ALERT":         LevelFatal,
+	"EMERG":         LevelFatal,
+	"EMERGENCY":     LevelFatal,
+	"PANIC":         LevelFatal,
+	"DPANIC":        LevelFatal,
+}
+
+// ParseLevel maps a level name or one of its common aliases (case-insensitive)
+// to the canonical level.
+func ParseLevel(s string) (string, bool) {
+	level, ok := levelAliases[strings.ToUpper(strings.TrimSpace(s))]
+	return level, ok
+}
+
+// SeverityNumber returns the lowest OpenTelemetry severity number of a
+// canonical level, or 0 if the level is unknown.
+func SeverityNumber(level string) uint8 {
+	return severityNumbers[level]
+}
+
+// SeverityRange returns the inclusive range of severity numbers covered by a
+// canonical level.
+func SeverityRange(level string) (uint8, uint8) {
+	n := severityNumbers[level]
+	if n == 0 {
+		return 0, 0
+	}
+	return n, n + 3
+}
+
+// LevelForSeverity maps an OpenTelemetry severity number (1-24) onto its
+// canonical level.
+func LevelForSeverity(n uint8) (string, bool) {
+	if n < 1 || n > 24 {
+		return "", false
+	}
+	return Levels[(n-1)/4], true
+}
+
+// SeverityFromNumber converts a severity number received on the wire.
+// Numbers outside the OpenTelemetry range 0-24 become 0, an unspecified
+// severity, rather than wrapping around into it.
+func SeverityFromNumber(n int64) uint8 {
+	if n < 0 || n > 24 {
+		return 0
+	}
+	return uint8(n)
+}
+
+// NormalizeSeverity rewrites Level to its canonical form and fills in
+// SeverityNumber. A numeric severity is used when the level text is missing
+// or unknown; events with neither are treated as INFO.
+func (e *Event) NormalizeSeverity() {
+	if level, ok := ParseLevel(e.Level); ok {
+		e.Level = level
+		if current, _ := LevelForSeverity(e.SeverityNumber); current != level {
+			e.SeverityNumber = SeverityNumber(level)
+		}
+		return
+	}
+
+	if level, ok := LevelForSeverity(e.SeverityNumber); ok {
+		e.Level = level
+		return
+	}
+
+	e.Level = LevelInfo
+	e.SeverityNumber = SeverityNumber(LevelInfo)
+}
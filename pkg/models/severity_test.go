@@ -0,0 +1,112 @@
+package models
+
+import "testing"
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{"INFO", LevelInfo, true},
+		{"info", LevelInfo, true},
+		{" Warning ", LevelWarn, true},
+		{"err", LevelError, true},
+		{"CRITICAL", LevelFatal, true},
+		{"dpanic", LevelFatal, true},
+		{"finest", LevelTrace, true},
+		{"", "", false},
+		{"verbose", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseLevel(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ParseLevel(%q) = %q, %v; want %q, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSeverityRange(t *testing.T) {
+	tests := []struct {
+		level         string
+		lowest, upper uint8
+	}{
+		{LevelTrace, 1, 4},
+		{LevelInfo, 9, 12},
+		{LevelFatal, 21, 24},
+		{"UNKNOWN", 0, 0},
+	}
+	for _, tt := range tests {
+		lowest, upper := SeverityRange(tt.level)
+		if lowest != tt.lowest || upper != tt.upper {
+			t.Errorf("SeverityRange(%q) = %d, %d; want %d, %d", tt.level, lowest, upper, tt.lowest, tt.upper)
+		}
+	}
+}
+
+func TestLevelForSeverity(t *testing.T) {
+	tests := []struct {
+		n    uint8
+		want string
+		ok   bool
+	}{
+		{0, "", false},
+		{1, LevelTrace, true},
+		{8, LevelDebug, true},
+		{9, LevelInfo, true},
+		{17, LevelError, true},
+		{24, LevelFatal, true},
+		{25, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := LevelForSeverity(tt.n)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("LevelForSeverity(%d) = %q, %v; want %q, %v", tt.n, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSeverityFromNumber(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want uint8
+	}{
+		{0, 0},
+		{9, 9},
+		{24, 24},
+		{25, 0},
+		{256, 0},
+		{265, 0},
+		{-1, 0},
+	}
+	for _, tt := range tests {
+		if got := SeverityFromNumber(tt.n); got != tt.want {
+			t.Errorf("SeverityFromNumber(%d) = %d, want %d", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeSeverity(t *testing.T) {
+	tests := []struct {
+		name     string
+		event    Event
+		level    string
+		severity uint8
+	}{
+		{"alias", Event{Level: "warning"}, LevelWarn, 13},
+		{"number within level", Event{Level: "ERROR", SeverityNumber: 19}, LevelError, 19},
+		{"number of other level", Event{Level: "ERROR", SeverityNumber: 9}, LevelError, 17},
+		{"number only", Event{SeverityNumber: 6}, LevelDebug, 6},
+		{"unknown level with number", Event{Level: "loud", SeverityNumber: 22}, LevelFatal, 22},
+		{"neither", Event{}, LevelInfo, 9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := tt.event
+			e.NormalizeSeverity()
+			if e.Level != tt.level || e.SeverityNumber != tt.severity {
+				t.Errorf("got %s/%d, want %s/%d", e.Level, e.SeverityNumber, tt.level, tt.severity)
+			}
+		})
+	}
+}
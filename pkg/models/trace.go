@@ -0,0 +1,41 @@
+package models
+
+import (
+	"encoding/hex"
+	"strings"
+)
+
+// IsTraceID reports whether s is a valid W3C trace ID: 32 hex digits, not all
+// zero.
+func IsTraceID(s string) bool {
+	return len(s) == 32 && isHex(s) && s != strings.Repeat("0", 32)
+}
+
+// IsSpanID reports whether s is a valid W3C span ID: 16 hex digits, not all
+// zero.
+func IsSpanID(s string) bool {
+	return len(s) == 16 && isHex(s) && s != strings.Repeat("0", 16)
+}
+
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// NormalizeTrace lowercases TraceID and SpanID and drops those that are not
+// valid W3C IDs, so that traces are stored and looked up in a single form. A
+// span only belongs to a trace, so the span is dropped along with an invalid
+// trace ID, and the trace flags along with an invalid span ID.
+func (e *Event) NormalizeTrace() {
+	e.TraceID = strings.ToLower(strings.TrimSpace(e.TraceID))
+	e.SpanID = strings.ToLower(strings.TrimSpace(e.SpanID))
+
+	if !IsTraceID(e.TraceID) {
+		e.TraceID = ""
+		e.SpanID = ""
+	}
+	if !IsSpanID(e.SpanID) {
+		e.SpanID = ""
+		e.TraceFlags = 0
+	}
+}
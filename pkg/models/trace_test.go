@@ -0,0 +1,38 @@
+package models
+
+import "testing"
+
+func TestNormalizeTrace(t *testing.T) {
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		spanID  = "00f067aa0ba902b7"
+	)
+
+	tests := []struct {
+		name    string
+		event   Event
+		traceID string
+		spanID  string
+		flags   uint8
+	}{
+		{"valid", Event{TraceID: traceID, SpanID: spanID, TraceFlags: 1}, traceID, spanID, 1},
+		{"uppercase", Event{TraceID: "4BF92F3577B34DA6A3CE929D0E0E4736", SpanID: "00F067AA0BA902B7"}, traceID, spanID, 0},
+		{"surrounding space", Event{TraceID: " " + traceID + " "}, traceID, "", 0},
+		{"short trace", Event{TraceID: "4bf92f35", SpanID: spanID, TraceFlags: 1}, "", "", 0},
+		{"non-hex trace", Event{TraceID: "zzf92f3577b34da6a3ce929d0e0e4736"}, "", "", 0},
+		{"zero trace", Event{TraceID: "00000000000000000000000000000000", SpanID: spanID}, "", "", 0},
+		{"invalid span", Event{TraceID: traceID, SpanID: "not-a-span", TraceFlags: 1}, traceID, "", 0},
+		{"zero span", Event{TraceID: traceID, SpanID: "0000000000000000", TraceFlags: 1}, traceID, "", 0},
+		{"span without trace", Event{SpanID: spanID}, "", "", 0},
+		{"none", Event{}, "", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := tt.event
+			e.NormalizeTrace()
+			if e.TraceID != tt.traceID || e.SpanID != tt.spanID || e.TraceFlags != tt.flags {
+				t.Errorf("got %q/%q/%d, want %q/%q/%d", e.TraceID, e.SpanID, e.TraceFlags, tt.traceID, tt.spanID, tt.flags)
+			}
+		})
+	}
+}
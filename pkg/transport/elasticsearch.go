@@ -0,0 +1,339 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mohammadhptp/pulse/pkg/logger"
+	"github.com/mohammadhptp/pulse/pkg/metrics"
+	"github.com/mohammadhptp/pulse/pkg/models"
+	"go.uber.org/zap"
+)
+
+const (
+	esMaxBodyBytes = 64 << 20
+
+	// DefaultElasticsearchVersion is the version reported to shippers probing
+	// the cluster.
+	DefaultElasticsearchVersion = "8.11.0"
+)
+
+// ElasticsearchFields names the document fields mapped onto an Event. Nested
+// fields are addressed with dots, matching both nested objects and flattened
+// keys.
+type ElasticsearchFields struct {
+	Timestamp string
+	Level     string
+	Service   string
+	Host      string
+	Message   string
+}
+
+// DefaultElasticsearchFields follows the Elastic Common Schema as written by
+// Filebeat and Fluent Bit.
+var DefaultElasticsearchFields = ElasticsearchFields{
+	Timestamp: "@timestamp",
+	Level:     "log.level",
+	Service:   "service.name",
+	Host:      "host.name",
+	Message:   "message",
+}
+
+// ElasticsearchTransport accepts the Elasticsearch bulk API so that Filebeat,
+// Fluent Bit and other shippers with an Elasticsearch output can ship to Pulse.
+type ElasticsearchTransport struct {
+	handlerRef
+	server  *http.Server
+	port    int
+	version string
+	fields  ElasticsearchFields
+}
+
+// NewElasticsearchTransport creates a bulk API transport listening on port.
+// Empty field names fall back to DefaultElasticsearchFields.
+func NewElasticsearchTransport(port int, version string, fields ElasticsearchFields) *ElasticsearchTransport {
+	if version == "" {
+		version = DefaultElasticsearchVersion
+	}
+	if fields.Timestamp == "" {
+		fields.Timestamp = DefaultElasticsearchFields.Timestamp
+	}
+	if fields.Level == "" {
+		fields.Level = DefaultElasticsearchFields.Level
+	}
+	if fields.Service == "" {
+		fields.Service = DefaultElasticsearchFields.Service
+	}
+	if fields.Host == "" {
+		fields.Host = DefaultElasticsearchFields.Host
+	}
+	if fields.Message == "" {
+		fields.Message = DefaultElasticsearchFields.Message
+	}
+
+	return &ElasticsearchTransport{
+		handlerRef: handlerRef{source: "elasticsearch"},
+		port:       port,
+		version:    version,
+		fields:     fields,
+	}
+}
+
+func (e *ElasticsearchTransport) Start(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", e.handleInfo)
+	mux.HandleFunc("GET /_license", e.handleLicense)
+	mux.HandleFunc("POST /_bulk", e.handleBulk)
+	mux.HandleFunc("PUT /_bulk", e.handleBulk)
+	mux.HandleFunc("POST /{index}/_bulk", e.handleBulk)
+	mux.HandleFunc("PUT /{index}/_bulk", e.handleBulk)
+
+	e.server = serveHTTP(ctx, "Elasticsearch", fmt.Sprintf(":%d", e.port), metrics.InstrumentHandler("elasticsearch", withElasticHeaders(mux)))
+	return nil
+}
+
+func (e *ElasticsearchTransport) Stop() error {
+	return shutdownHTTP("Elasticsearch", e.server)
+}
+
+func (e *ElasticsearchTransport) Close() error {
+	return e.Stop()
+}
+
+// withElasticHeaders adds the product header Elasticsearch clients since 7.14
+// require before talking to a cluster.
+func withElasticHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (e *ElasticsearchTransport) handleInfo(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"name":         "pulse",
+		"cluster_name": "pulse",
+		"cluster_uuid": "pulse",
+		"version": map[string]interface{}{
+			"number":                              e.version,
+			"build_flavor":                        "default",
+			"build_type":                          "docker",
+			"build_snapshot":                      false,
+			"minimum_wire_compatibility_version":  "7.17.0",
+			"minimum_index_compatibility_version": "7.0.0",
+		},
+		"tagline": "You Know, for Search",
+	})
+}
+
+func (e *ElasticsearchTransport) handleLicense(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"license": map[string]interface{}{
+			"status": "active",
+			"uid":    "pulse",
+			"type":   "basic",
+			"mode":   "basic",
+		},
+	})
+}
+
+// esBulkError is the error object reported for a failed bulk item.
+type esBulkError struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+type esBulkResult struct {
+	Index   string       `json:"_index"`
+	ID      string       `json:"_id,omitempty"`
+	Version int          `json:"_version,omitempty"`
+	Result  string       `json:"result,omitempty"`
+	Status  int          `json:"status"`
+	Error   *esBulkError `json:"error,omitempty"`
+}
+
+func (e *ElasticsearchTransport) handleBulk(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	handler := withRemoteAddr(e.eventHandler(), r.RemoteAddr)
+	if handler == nil {
+		http.Error(w, "Event handler not configured", http.StatusInternalServerError)
+		return
+	}
+
+	body, err := readBody(r, esMaxBodyBytes)
+	if err != nil {
+		logger.Warn("Failed to read bulk request", zap.Error(err))
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error":  esBulkError{Type: "parse_exception", Reason: err.Error()},
+			"status": http.StatusBadRequest,
+		})
+		return
+	}
+
+	defaultIndex := r.PathValue("index")
+	items := []map[string]esBulkResult{}
+	failed := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), esMaxBodyBytes)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var action map[string]struct {
+			Index string `json:"_index"`
+			ID    string `json:"_id"`
+		}
+		if err := json.Unmarshal(line, &action); err != nil || len(action) != 1 {
+			logger.Warn("Malformed bulk action", zap.ByteString("line", line))
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"error":  esBulkError{Type: "illegal_argument_exception", Reason: "Malformed action/metadata line"},
+				"status": http.StatusBadRequest,
+			})
+			return
+		}
+
+		for name, meta := range action {
+			index := meta.Index
+			if index == "" {
+				index = defaultIndex
+			}
+
+			result := esBulkResult{Index: index, ID: meta.ID}
+			switch name {
+			case "index", "create":
+				var source []byte
+				if scanner.Scan() {
+					source = bytes.TrimSpace(scanner.Bytes())
+				}
+				result = e.indexDocument(handler, index, meta.ID, source)
+			case "update":
+				scanner.Scan()
+				fallthrough
+			case "delete":
+				result.Status = http.StatusBadRequest
+				result.Error = &esBulkError{
+					Type:   "action_request_validation_exception",
+					Reason: name + " actions are not supported",
+				}
+			default:
+				result.Status = http.StatusBadRequest
+				result.Error = &esBulkError{Type: "illegal_argument_exception", Reason: "Unknown action " + name}
+			}
+
+			if result.Error != nil {
+				failed = true
+			}
+			items = append(items, map[string]esBulkResult{name: result})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		logger.Warn("Failed to read bulk request", zap.Error(err))
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"took":   time.Since(start).Milliseconds(),
+		"errors": failed,
+		"items":  items,
+	})
+}
+
+func (e *ElasticsearchTransport) indexDocument(handler EventHandler, index, id string, source []byte) esBulkResult {
+	result := esBulkResult{Index: index, ID: id}
+
+	decoder := json.NewDecoder(bytes.NewReader(source))
+	decoder.UseNumber()
+
+	var document map[string]interface{}
+	if err := decoder.Decode(&document); err != nil {
+		result.Status = http.StatusBadRequest
+		result.Error = &esBulkError{Type: "mapper_parsing_exception", Reason: "failed to parse document: " + err.Error()}
+		return result
+	}
+
+	event := e.event(index, models.FlattenDocument(document))
+	if result.ID == "" {
+		result.ID = event.RequestID
+	}
+
+	if err := handler(event); err != nil {
+		logger.Error("Failed to process bulk document", zap.Error(err))
+		result.Status = http.StatusTooManyRequests
+		result.Error = &esBulkError{Type: "es_rejected_execution_exception", Reason: err.Error()}
+		return result
+	}
+
+	result.Status = http.StatusCreated
+	result.Result = "created"
+	result.Version = 1
+	return result
+}
+
+// event maps a flattened document onto an Event. Fields without a mapping are
+// kept as attributes.
+func (e *ElasticsearchTransport) event(index string, fields map[string]string) models.Event {
+	event := models.Event{
+		EventTimeMs: uint64(time.Now().UnixMilli()),
+		Level:       fields[e.fields.Level],
+		Service:     fields[e.fields.Service],
+		Host:        fields[e.fields.Host],
+		Message:     fields[e.fields.Message],
+		RequestID:   uuid.New().String(),
+	}
+
+	if ts, ok := parseDocumentTime(fields[e.fields.Timestamp]); ok {
+		event.EventTimeMs = uint64(ts.UnixMilli())
+	}
+	if traceID := strings.ToLower(fields["trace.id"]); models.IsTraceID(traceID) {
+		event.TraceID = traceID
+	}
+	if spanID := strings.ToLower(fields["span.id"]); models.IsSpanID(spanID) {
+		event.SpanID = spanID
+	}
+
+	for _, mapped := range []string{e.fields.Timestamp, e.fields.Level, e.fields.Service, e.fields.Host, e.fields.Message} {
+		delete(fields, mapped)
+	}
+	if index != "" {
+		fields["elasticsearch.index"] = index
+	}
+	event.Attributes = fields
+
+	return event
+}
+
+// parseDocumentTime accepts RFC 3339 timestamps and epoch milliseconds, the
+// formats shippers write to @timestamp.
+func parseDocumentTime(value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+	if ts, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return ts, true
+	}
+	if ms, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.UnixMilli(int64(ms)), true
+	}
+	return time.Time{}, false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Error("Failed to encode response", zap.Error(err))
+	}
+}
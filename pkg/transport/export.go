@@ -0,0 +1,334 @@
+package transport
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mohammadhptp/pulse/internal/storage"
+	"github.com/mohammadhptp/pulse/pkg/logger"
+	"github.com/mohammadhptp/pulse/pkg/models"
+	"github.com/parquet-go/parquet-go"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultMaxExportRows caps the rows of an export when no cap is
+	// configured.
+	DefaultMaxExportRows = 1000000
+
+	// exportFlushRows is the number of rows written between flushes of the
+	// response, and the size of Parquet row groups.
+	exportFlushRows = 10000
+)
+
+// Headers and trailers of export responses.
+const (
+	exportLimitHeader      = "X-Export-Limit"
+	exportRowsTrailer      = "X-Export-Rows"
+	exportTruncatedTrailer = "X-Export-Truncated"
+)
+
+// exportColumns are the CSV columns of exported events.
+var exportColumns = []string{
+	"event_time", "service", "level", "severity_number", "host", "message",
+	"request_id", "trace_id", "span_id", "trace_flags",
+	"sample_rate", "repeat_count", "first_seen_ms", "last_seen_ms", "attributes",
+}
+
+// exportFormat describes an export file format.
+type exportFormat struct {
+	contentType string
+	extension   string
+	newWriter   func(w io.Writer) exportWriter
+}
+
+var exportFormats = map[string]exportFormat{
+	"ndjson":  {"application/x-ndjson", "ndjson", newNDJSONExportWriter},
+	"csv":     {"text/csv; charset=utf-8", "csv", newCSVExportWriter},
+	"parquet": {"application/vnd.apache.parquet", "parquet", newParquetExportWriter},
+}
+
+// exportWriter encodes exported events. Flush writes the events buffered so
+// far to the underlying writer, and Close completes the file.
+type exportWriter interface {
+	Write(e models.Event) error
+	Flush() error
+	Close() error
+}
+
+// SetMaxExportRows caps the rows of an export. It must be called before Start.
+func (h *HTTPTransport) SetMaxExportRows(rows int) {
+	h.maxExportRows = rows
+}
+
+// handleExport streams every event matching the query filters, without
+// pagination, as NDJSON, CSV or Parquet. The response is sent with chunked
+// transfer encoding as rows are read from ClickHouse, and the query is
+// cancelled when the client disconnects. The rows written and whether the row
+// cap cut the export short are sent as trailers.
+func (h *HTTPTransport) handleExport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	opts, err := parseQueryOptions(query)
+	if err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	name := query.Get("format")
+	if name == "" {
+		name = "ndjson"
+	}
+	format, ok := exportFormats[name]
+	if !ok {
+		http.Error(w, fmt.Sprintf("Bad request: unknown export format %q", name), http.StatusBadRequest)
+		return
+	}
+
+	limit := h.maxExportRows
+	if limit <= 0 {
+		limit = DefaultMaxExportRows
+	}
+	if v := query.Get("limit"); v != "" {
+		requested, err := strconv.Atoi(v)
+		if err != nil || requested <= 0 {
+			http.Error(w, "Bad request: invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(requested, limit)
+	}
+
+	ctx := storage.LongRunning(r.Context())
+	if isDryRun(query) {
+		h.handleEstimate(w, ctx, opts)
+		return
+	}
+
+	conn, err := h.queryConn()
+	if err != nil {
+		logger.Error("Failed to connect to ClickHouse", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", format.contentType)
+	header.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="events-%d.%s"`, time.Now().Unix(), format.extension))
+	header.Set(exportLimitHeader, strconv.Itoa(limit))
+	header.Set("Trailer", exportRowsTrailer+", "+exportTruncatedTrailer)
+
+	writer := format.newWriter(w)
+	controller := http.NewResponseController(w)
+	started := time.Now()
+
+	// One row past the limit tells whether the export was truncated.
+	rows := 0
+	_, err = storage.StreamEvents(ctx, conn, opts, limit+1, func(e models.Event) error {
+		if rows == limit {
+			return errExportTruncated
+		}
+		if err := writer.Write(e); err != nil {
+			return err
+		}
+		rows++
+		if rows%exportFlushRows == 0 {
+			if err := writer.Flush(); err != nil {
+				return err
+			}
+			return controller.Flush()
+		}
+		return nil
+	})
+
+	truncated := errors.Is(err, errExportTruncated)
+	if err != nil && !truncated {
+		if r.Context().Err() != nil {
+			logger.Info("Export cancelled by the client", zap.Int("rows", rows))
+			return
+		}
+		if rows == 0 {
+			header.Del("Content-Disposition")
+			header.Del(exportLimitHeader)
+			header.Del("Trailer")
+			queryFailed(w, err, "Failed to export events")
+			return
+		}
+		logger.Error("Failed to export events", zap.Error(err), zap.Int("rows", rows))
+		// Abort the response, so that clients do not take a partial export
+		// for a complete one.
+		panic(http.ErrAbortHandler)
+	}
+
+	if err := writer.Close(); err != nil {
+		logger.Error("Failed to complete export", zap.Error(err))
+		panic(http.ErrAbortHandler)
+	}
+	header.Set(exportRowsTrailer, strconv.Itoa(rows))
+	header.Set(exportTruncatedTrailer, strconv.FormatBool(truncated))
+
+	logger.Debug("Export completed",
+		zap.String("format", name),
+		zap.Int("rows", rows),
+		zap.Bool("truncated", truncated),
+		zap.Duration("took", time.Since(started)))
+}
+
+// errExportTruncated stops an export that reached its row cap.
+var errExportTruncated = errors.New("export row cap reached")
+
+type ndjsonExportWriter struct {
+	encoder *json.Encoder
+}
+
+func newNDJSONExportWriter(w io.Writer) exportWriter {
+	return &ndjsonExportWriter{encoder: json.NewEncoder(w)}
+}
+
+func (n *ndjsonExportWriter) Write(e models.Event) error {
+	return n.encoder.Encode(e)
+}
+
+func (n *ndjsonExportWriter) Flush() error { return nil }
+func (n *ndjsonExportWriter) Close() error { return nil }
+
+type csvExportWriter struct {
+	writer *csv.Writer
+	header bool
+}
+
+func newCSVExportWriter(w io.Writer) exportWriter {
+	return &csvExportWriter{writer: csv.NewWriter(w)}
+}
+
+func (c *csvExportWriter) Write(e models.Event) error {
+	if !c.header {
+		c.header = true
+		if err := c.writer.Write(exportColumns); err != nil {
+			return err
+		}
+	}
+
+	attributes := ""
+	if len(e.Attributes) > 0 {
+		encoded, err := json.Marshal(e.Attributes)
+		if err != nil {
+			return err
+		}
+		attributes = string(encoded)
+	}
+	return c.writer.Write([]string{
+		time.UnixMilli(int64(e.EventTimeMs)).UTC().Format(time.RFC3339Nano),
+		e.Service,
+		e.Level,
+		strconv.Itoa(int(e.SeverityNumber)),
+		e.Host,
+		e.Message,
+		e.RequestID,
+		e.TraceID,
+		e.SpanID,
+		strconv.Itoa(int(e.TraceFlags)),
+		strconv.FormatUint(uint64(e.SampleRate), 10),
+		strconv.FormatUint(uint64(e.RepeatCount), 10),
+		strconv.FormatUint(e.FirstSeenMs, 10),
+		strconv.FormatUint(e.LastSeenMs, 10),
+		attributes,
+	})
+}
+
+func (c *csvExportWriter) Flush() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+// Close writes the header of empty exports and flushes the rest.
+func (c *csvExportWriter) Close() error {
+	if !c.header {
+		c.header = true
+		if err := c.writer.Write(exportColumns); err != nil {
+			return err
+		}
+	}
+	return c.Flush()
+}
+
+// parquetEvent is the Parquet schema of exported events.
+type parquetEvent struct {
+	EventTime      int64             `parquet:"event_time,timestamp(millisecond:utc)"`
+	Service        string            `parquet:"service,dict"`
+	Level          string            `parquet:"level,dict"`
+	SeverityNumber int32             `parquet:"severity_number"`
+	Host           string            `parquet:"host,dict"`
+	Message        string            `parquet:"message"`
+	RequestID      string            `parquet:"request_id"`
+	TraceID        string            `parquet:"trace_id"`
+	SpanID         string            `parquet:"span_id"`
+	TraceFlags     int32             `parquet:"trace_flags"`
+	SampleRate     int64             `parquet:"sample_rate"`
+	RepeatCount    int64             `parquet:"repeat_count"`
+	FirstSeenMs    int64             `parquet:"first_seen_ms"`
+	LastSeenMs     int64             `parquet:"last_seen_ms"`
+	Attributes     map[string]string `parquet:"attributes"`
+}
+
+type parquetExportWriter struct {
+	writer *parquet.GenericWriter[parquetEvent]
+	rows   []parquetEvent
+}
+
+func newParquetExportWriter(w io.Writer) exportWriter {
+	return &parquetExportWriter{
+		writer: parquet.NewGenericWriter[parquetEvent](w, parquet.Compression(&parquet.Zstd)),
+		rows:   make([]parquetEvent, 0, 1024),
+	}
+}
+
+func (p *parquetExportWriter) Write(e models.Event) error {
+	p.rows = append(p.rows, parquetEvent{
+		EventTime:      int64(e.EventTimeMs),
+		Service:        e.Service,
+		Level:          e.Level,
+		SeverityNumber: int32(e.SeverityNumber),
+		Host:           e.Host,
+		Message:        e.Message,
+		RequestID:      e.RequestID,
+		TraceID:        e.TraceID,
+		SpanID:         e.SpanID,
+		TraceFlags:     int32(e.TraceFlags),
+		SampleRate:     int64(e.SampleRate),
+		RepeatCount:    int64(e.RepeatCount),
+		FirstSeenMs:    int64(e.FirstSeenMs),
+		LastSeenMs:     int64(e.LastSeenMs),
+		Attributes:     e.Attributes,
+	})
+	if len(p.rows) == cap(p.rows) {
+		return p.writeRows()
+	}
+	return nil
+}
+
+func (p *parquetExportWriter) writeRows() error {
+	_, err := p.writer.Write(p.rows)
+	p.rows = p.rows[:0]
+	return err
+}
+
+// Flush completes a row group, which is written to the response.
+func (p *parquetExportWriter) Flush() error {
+	if err := p.writeRows(); err != nil {
+		return err
+	}
+	return p.writer.Flush()
+}
+
+// Close writes the remaining rows and the file footer.
+func (p *parquetExportWriter) Close() error {
+	if err := p.writeRows(); err != nil {
+		return err
+	}
+	return p.writer.Close()
+}
@@ -0,0 +1,570 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mohammadhptp/pulse/pkg/logger"
+	"github.com/mohammadhptp/pulse/pkg/models"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultFilePollInterval is how often tailed files are checked for new
+	// data, rotation and newly matching paths.
+	DefaultFilePollInterval = time.Second
+
+	// DefaultMultilineTimeout is how long a multiline event waits for further
+	// lines before it is emitted.
+	DefaultMultilineTimeout = time.Second
+
+	// DefaultMultilineMaxLines bounds the number of lines joined into one event.
+	DefaultMultilineMaxLines = 500
+
+	fileReadChunkSize = 64 * 1024
+	fileMaxLineBytes  = 1 << 20
+
+	startAtBeginning = "beginning"
+	startAtEnd       = "end"
+)
+
+// FileInput configures a group of files tailed by a FileTransport.
+type FileInput struct {
+	// Name identifies the input in logs and as the event source; it is also
+	// the default Service.
+	Name string `mapstructure:"name"`
+	// Paths are glob patterns of the files to tail.
+	Paths []string `mapstructure:"paths"`
+	// Exclude are glob patterns matched against the file name and full path
+	// of files to skip.
+	Exclude []string `mapstructure:"exclude"`
+	// Service and Host are assigned to every event read from the files. Host
+	// defaults to the agent hostname.
+	Service string `mapstructure:"service"`
+	Host    string `mapstructure:"host"`
+	// StartAt is "beginning" or "end" and applies to files found at startup
+	// without a checkpoint. Files created later are always read from the
+	// beginning.
+	StartAt string `mapstructure:"start_at"`
+	// MultilinePattern, when set, is a regular expression matching the first
+	// line of an event. Lines that do not match are appended to the previous
+	// event, which joins stack traces into a single message. The event is
+	// emitted once the next event starts, after MultilineTimeout without new
+	// lines, or when it reaches MultilineMaxLines.
+	MultilinePattern  string        `mapstructure:"multiline_pattern"`
+	MultilineTimeout  time.Duration `mapstructure:"multiline_timeout"`
+	MultilineMaxLines int           `mapstructure:"multiline_max_lines"`
+}
+
+// fileCheckpoint is the persisted read position of a file.
+type fileCheckpoint struct {
+	Path   string `json:"path"`
+	Offset int64  `json:"offset"`
+}
+
+// FileTransport tails log files matched by glob patterns. Files are followed
+// across rename and copytruncate rotation and read offsets are persisted to a
+// checkpoint file, so a restarted agent resumes where it stopped.
+type FileTransport struct {
+	handlerRef
+	inputs         []*fileInput
+	checkpointPath string
+	pollInterval   time.Duration
+
+	files       map[string]*tailedFile
+	checkpoints map[string]fileCheckpoint
+	dirty       bool
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	once   sync.Once
+}
+
+type fileInput struct {
+	FileInput
+	multiline *regexp.Regexp
+}
+
+// tailedFile is an open file being followed. Offsets are byte positions in the
+// file: offset is where buffered data starts and committed is the end of the
+// last line handed to the event handler.
+type tailedFile struct {
+	input *fileInput
+	id    string
+	path  string
+	file  *os.File
+
+	offset    int64
+	committed int64
+	partial   []byte
+
+	pending     []string
+	pendingEnd  int64
+	pendingLast time.Time
+
+	seen bool
+}
+
+// NewFileTransport creates a transport tailing the files of the given inputs.
+// An empty checkpointPath disables offset persistence.
+func NewFileTransport(inputs []FileInput, checkpointPath string, pollInterval time.Duration) (*FileTransport, error) {
+	if pollInterval <= 0 {
+		pollInterval = DefaultFilePollInterval
+	}
+
+	hostname, _ := os.Hostname()
+
+	compiled := make([]*fileInput, 0, len(inputs))
+	for i, input := range inputs {
+		if len(input.Paths) == 0 {
+			return nil, fmt.Errorf("file input %d has no paths", i)
+		}
+		for _, pattern := range append(input.Paths, input.Exclude...) {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("file input %d: invalid pattern %q: %w", i, pattern, err)
+			}
+		}
+
+		if input.Name == "" {
+			input.Name = fmt.Sprintf("file-%d", i)
+		}
+		if input.Service == "" {
+			input.Service = input.Name
+		}
+		if input.Host == "" {
+			input.Host = hostname
+		}
+
+		switch input.StartAt {
+		case "":
+			input.StartAt = startAtBeginning
+		case startAtBeginning, startAtEnd:
+		default:
+			return nil, fmt.Errorf("file input %q: start_at must be %q or %q", input.Name, startAtBeginning, startAtEnd)
+		}
+
+		c := &fileInput{FileInput: input}
+		if input.MultilinePattern != "" {
+			re, err := regexp.Compile(input.MultilinePattern)
+			if err != nil {
+				return nil, fmt.Errorf("file input %q: invalid multiline pattern: %w", input.Name, err)
+			}
+			c.multiline = re
+			if c.MultilineTimeout <= 0 {
+				c.MultilineTimeout = DefaultMultilineTimeout
+			}
+			if c.MultilineMaxLines <= 0 {
+				c.MultilineMaxLines = DefaultMultilineMaxLines
+			}
+		}
+		compiled = append(compiled, c)
+	}
+
+	return &FileTransport{
+		handlerRef:     handlerRef{source: "file"},
+		inputs:         compiled,
+		checkpointPath: checkpointPath,
+		pollInterval:   pollInterval,
+		files:          make(map[string]*tailedFile),
+		checkpoints:    make(map[string]fileCheckpoint),
+	}, nil
+}
+
+func (f *FileTransport) Start(ctx context.Context) error {
+	if err := f.loadCheckpoints(); err != nil {
+		return err
+	}
+
+	ctx, f.cancel = context.WithCancel(ctx)
+	f.done = make(chan struct{})
+
+	logger.Info("Starting file transport",
+		zap.Int("inputs", len(f.inputs)),
+		zap.String("checkpointPath", f.checkpointPath))
+
+	go f.run(ctx)
+	return nil
+}
+
+func (f *FileTransport) Stop() error {
+	if f.cancel == nil {
+		return nil
+	}
+
+	f.once.Do(func() {
+		logger.Info("Stopping file transport")
+		f.cancel()
+		<-f.done
+	})
+	return nil
+}
+
+func (f *FileTransport) Close() error {
+	return f.Stop()
+}
+
+func (f *FileTransport) run(ctx context.Context) {
+	defer close(f.done)
+
+	ticker := time.NewTicker(f.pollInterval)
+	defer ticker.Stop()
+
+	f.poll(true)
+	for {
+		select {
+		case <-ctx.Done():
+			for _, tf := range f.files {
+				tf.file.Close()
+			}
+			f.saveCheckpoints()
+			return
+		case <-ticker.C:
+			f.poll(false)
+		}
+	}
+}
+
+// poll discovers matching files, reads new data from every tailed file and
+// persists the resulting offsets.
+func (f *FileTransport) poll(startup bool) {
+	for _, tf := range f.files {
+		tf.seen = false
+	}
+
+	for _, input := range f.inputs {
+		for _, path := range input.match() {
+			f.track(input, path, startup)
+		}
+	}
+
+	now := time.Now()
+	for id, tf := range f.files {
+		if !tf.seen {
+			// The file was deleted or rotated away from every pattern. Read
+			// what is left and stop following it.
+			f.read(tf)
+			f.finish(tf)
+			tf.file.Close()
+			delete(f.files, id)
+			continue
+		}
+
+		f.read(tf)
+		if len(tf.pending) > 0 && now.Sub(tf.pendingLast) >= tf.input.MultilineTimeout {
+			f.flushPending(tf)
+		}
+		f.checkpoint(tf)
+	}
+
+	// Forget checkpoints of files that no longer exist.
+	for id := range f.checkpoints {
+		if _, ok := f.files[id]; !ok {
+			delete(f.checkpoints, id)
+			f.dirty = true
+		}
+	}
+
+	f.saveCheckpoints()
+}
+
+// match returns the files matching the input patterns that are not excluded.
+func (in *fileInput) match() []string {
+	var paths []string
+	for _, pattern := range in.Paths {
+		matches, _ := filepath.Glob(pattern)
+		for _, path := range matches {
+			if !in.excluded(path) {
+				paths = append(paths, path)
+			}
+		}
+	}
+	return paths
+}
+
+func (in *fileInput) excluded(path string) bool {
+	for _, pattern := range in.Exclude {
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, filepath.Base(path)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// track follows a matching path. Files are identified by device and inode, so
+// a file renamed to another matching path keeps its position, and a new file
+// created at a rotated path is read from the beginning.
+func (f *FileTransport) track(input *fileInput, path string, startup bool) {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return
+	}
+
+	id := fileID(path, info)
+	if tf, ok := f.files[id]; ok {
+		tf.seen = true
+		tf.path = path
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		logger.Warn("Failed to open file", zap.String("path", path), zap.Error(err))
+		return
+	}
+
+	var offset int64
+	if cp, ok := f.checkpoints[id]; ok && cp.Offset <= info.Size() {
+		offset = cp.Offset
+	} else if startup && input.StartAt == startAtEnd {
+		offset = info.Size()
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		logger.Warn("Failed to seek file", zap.String("path", path), zap.Error(err))
+		file.Close()
+		return
+	}
+
+	logger.Info("Tailing file",
+		zap.String("input", input.Name),
+		zap.String("path", path),
+		zap.Int64("offset", offset))
+
+	f.files[id] = &tailedFile{
+		input:     input,
+		id:        id,
+		path:      path,
+		file:      file,
+		offset:    offset,
+		committed: offset,
+		seen:      true,
+	}
+}
+
+// read consumes the data appended to a file since the last poll.
+func (f *FileTransport) read(tf *tailedFile) {
+	// A file smaller than the read position was truncated in place, as done by
+	// copytruncate rotation; start over from the beginning. The buffered
+	// lines are gone from the file, so they are emitted first.
+	if info, err := tf.file.Stat(); err == nil && info.Size() < tf.offset+int64(len(tf.partial)) {
+		logger.Info("File truncated, reading from the beginning", zap.String("path", tf.path))
+		if !f.finish(tf) {
+			logger.Warn("Dropping buffered lines of truncated file", zap.String("path", tf.path))
+		}
+		f.rewind(tf, 0)
+	}
+
+	chunk := make([]byte, fileReadChunkSize)
+	for {
+		n, err := tf.file.Read(chunk)
+		if n > 0 {
+			tf.partial = append(tf.partial, chunk[:n]...)
+			if !f.consumeLines(tf) {
+				return
+			}
+		}
+		if err != nil {
+			if err != io.EOF {
+				logger.Warn("Failed to read file", zap.String("path", tf.path), zap.Error(err))
+			}
+			return
+		}
+	}
+}
+
+// consumeLines handles the complete lines buffered for a file. It returns false
+// when an event could not be handled and the file was rewound to retry later.
+func (f *FileTransport) consumeLines(tf *tailedFile) bool {
+	for {
+		i := bytes.IndexByte(tf.partial, '\n')
+		if i < 0 {
+			if len(tf.partial) < fileMaxLineBytes {
+				return true
+			}
+			// Split overlong lines rather than buffering without bound.
+			i = fileMaxLineBytes
+		}
+
+		line := strings.TrimSuffix(string(tf.partial[:i]), "\r")
+		consumed := i
+		if consumed < len(tf.partial) && tf.partial[consumed] == '\n' {
+			consumed++
+		}
+		end := tf.offset + int64(consumed)
+
+		tf.partial = tf.partial[consumed:]
+		tf.offset = end
+
+		if !f.handleLine(tf, line, end) {
+			f.rewind(tf, tf.committed)
+			return false
+		}
+	}
+}
+
+// handleLine emits a line, or joins it with the pending multiline event when
+// it does not start a new one.
+func (f *FileTransport) handleLine(tf *tailedFile, line string, end int64) bool {
+	if tf.input.multiline == nil {
+		if !f.emit(tf, line) {
+			return false
+		}
+		tf.committed = end
+		return true
+	}
+
+	if tf.input.multiline.MatchString(line) && len(tf.pending) > 0 {
+		if !f.flushPending(tf) {
+			return false
+		}
+	}
+
+	tf.pending = append(tf.pending, line)
+	tf.pendingEnd = end
+	tf.pendingLast = time.Now()
+
+	if len(tf.pending) >= tf.input.MultilineMaxLines {
+		return f.flushPending(tf)
+	}
+	return true
+}
+
+func (f *FileTransport) flushPending(tf *tailedFile) bool {
+	if len(tf.pending) == 0 {
+		return true
+	}
+	if !f.emit(tf, strings.Join(tf.pending, "\n")) {
+		return false
+	}
+
+	tf.committed = tf.pendingEnd
+	tf.pending = nil
+	return true
+}
+
+// finish emits whatever is buffered for a file that is no longer followed or
+// was truncated, including a final line without a trailing newline. It
+// returns false when an event could not be handled.
+func (f *FileTransport) finish(tf *tailedFile) bool {
+	if len(tf.partial) > 0 {
+		line := strings.TrimSuffix(string(tf.partial), "\r")
+		end := tf.offset + int64(len(tf.partial))
+		tf.partial = nil
+		if !f.handleLine(tf, line, end) {
+			return false
+		}
+	}
+	return f.flushPending(tf)
+}
+
+// rewind drops buffered data and moves the read position of a file back to
+// offset.
+func (f *FileTransport) rewind(tf *tailedFile, offset int64) {
+	if _, err := tf.file.Seek(offset, io.SeekStart); err != nil {
+		logger.Warn("Failed to seek file", zap.String("path", tf.path), zap.Error(err))
+	}
+	tf.offset = offset
+	tf.committed = offset
+	tf.partial = nil
+	tf.pending = nil
+}
+
+func (f *FileTransport) emit(tf *tailedFile, message string) bool {
+	if strings.TrimSpace(message) == "" {
+		return true
+	}
+
+	handler := f.eventHandler()
+	if handler == nil {
+		logger.Warn("Event handler not configured, pausing file", zap.String("path", tf.path))
+		return false
+	}
+
+	event := models.Event{
+		EventTimeMs: uint64(time.Now().UnixMilli()),
+		Service:     tf.input.Service,
+		Host:        tf.input.Host,
+		Message:     message,
+		Source:      tf.input.Name,
+		Attributes: map[string]string{
+			"file.path": tf.path,
+			"file.name": filepath.Base(tf.path),
+		},
+	}
+
+	if err := handler(event); err != nil {
+		logger.Error("Failed to process file line",
+			zap.String("path", tf.path),
+			zap.Error(err))
+		return false
+	}
+	return true
+}
+
+func (f *FileTransport) checkpoint(tf *tailedFile) {
+	cp := fileCheckpoint{Path: tf.path, Offset: tf.committed}
+	if f.checkpoints[tf.id] != cp {
+		f.checkpoints[tf.id] = cp
+		f.dirty = true
+	}
+}
+
+func (f *FileTransport) loadCheckpoints() error {
+	if f.checkpointPath == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(f.checkpointPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading file checkpoints: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &f.checkpoints); err != nil {
+		logger.Warn("Ignoring invalid file checkpoints",
+			zap.String("path", f.checkpointPath),
+			zap.Error(err))
+		f.checkpoints = make(map[string]fileCheckpoint)
+	}
+	return nil
+}
+
+// saveCheckpoints writes the offsets to a temporary file and renames it over
+// the checkpoint file, so a crash never leaves a partially written file.
+func (f *FileTransport) saveCheckpoints() {
+	if f.checkpointPath == "" || !f.dirty {
+		return
+	}
+
+	data, err := json.MarshalIndent(f.checkpoints, "", "  ")
+	if err != nil {
+		logger.Error("Failed to encode file checkpoints", zap.Error(err))
+		return
+	}
+
+	tmp := f.checkpointPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		logger.Error("Failed to write file checkpoints", zap.Error(err))
+		return
+	}
+	if err := os.Rename(tmp, f.checkpointPath); err != nil {
+		logger.Error("Failed to write file checkpoints", zap.Error(err))
+		return
+	}
+	f.dirty = false
+}
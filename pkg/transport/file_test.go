@@ -0,0 +1,337 @@
+package transport
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mohammadhptp/pulse/pkg/models"
+)
+
+// fileTail drives a FileTransport poll by poll, recording the messages it
+// emits.
+type fileTail struct {
+	*FileTransport
+	messages []string
+	fail     bool
+}
+
+func newFileTail(t *testing.T, input FileInput, checkpointPath string) *fileTail {
+	t.Helper()
+	if input.Name == "" {
+		input.Name = "app"
+	}
+	transport, err := NewFileTransport([]FileInput{input}, checkpointPath, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := transport.loadCheckpoints(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		for _, tf := range transport.files {
+			tf.file.Close()
+		}
+	})
+
+	tail := &fileTail{FileTransport: transport}
+	transport.SetEventHandler(func(e models.Event) error {
+		if tail.fail {
+			return errors.New("kafka unavailable")
+		}
+		tail.messages = append(tail.messages, e.Message)
+		return nil
+	})
+	return tail
+}
+
+// next polls and returns the messages emitted since the previous call.
+func (tail *fileTail) next(startup bool) []string {
+	tail.poll(startup)
+	messages := tail.messages
+	tail.messages = nil
+	return messages
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectMessages(t *testing.T, step string, got []string, want ...string) {
+	t.Helper()
+	if len(got) == 0 && len(want) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%s: messages = %q, want %q", step, got, want)
+	}
+}
+
+func TestFileTransportTail(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	writeFile(t, path, "first\r\nsecond\npart")
+
+	tail := newFileTail(t, FileInput{Paths: []string{filepath.Join(dir, "*.log")}}, "")
+	expectMessages(t, "startup", tail.next(true), "first", "second")
+
+	appendFile(t, path, "ial\n\n  \nthird\n")
+	expectMessages(t, "append", tail.next(false), "partial", "third")
+	expectMessages(t, "no new data", tail.next(false))
+
+	// A deleted file is read to the end, including a last line without a
+	// newline, and forgotten.
+	appendFile(t, path, "last")
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	expectMessages(t, "deleted", tail.next(false), "last")
+	if len(tail.files) != 0 {
+		t.Errorf("still tailing %d files", len(tail.files))
+	}
+}
+
+func TestFileTransportStartAt(t *testing.T) {
+	tests := []struct {
+		startAt string
+		want    []string
+	}{
+		{"", []string{"old", "new", "created"}},
+		{"beginning", []string{"old", "new", "created"}},
+		{"end", []string{"new", "created"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.startAt, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "app.log")
+			writeFile(t, path, "old\n")
+
+			tail := newFileTail(t, FileInput{Paths: []string{filepath.Join(dir, "*.log")}, StartAt: tt.startAt}, "")
+			got := tail.next(true)
+			appendFile(t, path, "new\n")
+			got = append(got, tail.next(false)...)
+			// Files appearing after startup are read from the beginning.
+			writeFile(t, filepath.Join(dir, "other.log"), "created\n")
+			got = append(got, tail.next(false)...)
+
+			expectMessages(t, "start_at "+tt.startAt, got, tt.want...)
+		})
+	}
+}
+
+func TestFileTransportExclude(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "app.log"), "kept\n")
+	writeFile(t, filepath.Join(dir, "debug.log"), "excluded\n")
+
+	tail := newFileTail(t, FileInput{
+		Paths:   []string{filepath.Join(dir, "*.log")},
+		Exclude: []string{"debug.*"},
+	}, "")
+	expectMessages(t, "startup", tail.next(true), "kept")
+}
+
+func TestFileTransportCheckpointResume(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	checkpoints := filepath.Join(dir, "checkpoints.json")
+	input := FileInput{Paths: []string{path}, StartAt: "end"}
+	writeFile(t, path, "first\nsecond\n")
+
+	tail := newFileTail(t, FileInput{Paths: []string{path}}, checkpoints)
+	expectMessages(t, "first run", tail.next(true), "first", "second")
+
+	// Lines written while the agent was stopped are read on restart, even
+	// with start_at end, and lines already handled are not read again.
+	appendFile(t, path, "third\n")
+	restarted := newFileTail(t, input, checkpoints)
+	expectMessages(t, "restart", restarted.next(true), "third")
+
+	// A checkpoint beyond the end of the file, truncated while the agent was
+	// stopped, is ignored.
+	if !strings.Contains(readFile(t, checkpoints), `"offset": 19`) {
+		t.Fatalf("checkpoints = %s, want offset 19", readFile(t, checkpoints))
+	}
+	writeFile(t, path, "rewritten\n")
+	fresh := newFileTail(t, FileInput{Paths: []string{path}}, checkpoints)
+	expectMessages(t, "stale checkpoint", fresh.next(true), "rewritten")
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestFileTransportRenameRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	writeFile(t, path, "one\n")
+
+	tail := newFileTail(t, FileInput{Paths: []string{path}}, "")
+	expectMessages(t, "startup", tail.next(true), "one")
+
+	// Lines written before the rotation are read from the renamed file, and
+	// the new file is read from the beginning.
+	appendFile(t, path, "two\n")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, path, "three\n")
+	// The files are read in no particular order.
+	rotated := tail.next(false)
+	sort.Strings(rotated)
+	expectMessages(t, "rotated", rotated, "three", "two")
+
+	appendFile(t, path, "four\n")
+	expectMessages(t, "after rotation", tail.next(false), "four")
+}
+
+func TestFileTransportRenameWithinPattern(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	writeFile(t, path, "one\n")
+
+	tail := newFileTail(t, FileInput{Paths: []string{filepath.Join(dir, "app.log*")}}, "")
+	expectMessages(t, "startup", tail.next(true), "one")
+
+	// A file renamed to another matching path keeps its position.
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path+".1", "two\n")
+	expectMessages(t, "renamed", tail.next(false), "two")
+}
+
+func TestFileTransportCopyTruncate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	tests := []struct {
+		name      string
+		multiline string
+		before    string
+		after     string
+		first     []string
+		second    []string
+	}{
+		{
+			name:   "lines",
+			before: "one\ntwo\n",
+			after:  "three\n",
+			first:  []string{"one", "two"},
+			second: []string{"three"},
+		},
+		{
+			name:   "partial line",
+			before: "one\ntw",
+			after:  "3\n",
+			first:  []string{"one"},
+			second: []string{"tw", "3"},
+		},
+		{
+			name:      "pending multiline event",
+			multiline: `^\S`,
+			before:    "ERROR boom\n  at a\n  at b\n",
+			after:     "INFO next\n",
+			second:    []string{"ERROR boom\n  at a\n  at b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeFile(t, path, tt.before)
+			tail := newFileTail(t, FileInput{
+				Paths:            []string{path},
+				MultilinePattern: tt.multiline,
+				MultilineTimeout: time.Hour,
+			}, "")
+			expectMessages(t, "before truncation", tail.next(true), tt.first...)
+
+			writeFile(t, path, tt.after)
+			expectMessages(t, "after truncation", tail.next(false), tt.second...)
+		})
+	}
+}
+
+func TestFileTransportMultiline(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	writeFile(t, path, "")
+
+	tail := newFileTail(t, FileInput{
+		Paths:             []string{path},
+		MultilinePattern:  `^\d{4}-`,
+		MultilineTimeout:  50 * time.Millisecond,
+		MultilineMaxLines: 3,
+	}, "")
+	expectMessages(t, "startup", tail.next(true))
+
+	// An event is emitted once the next one starts.
+	appendFile(t, path, "2024-01-01 panic\n\tat main\n\tat run\n2024-01-01 next\n")
+	expectMessages(t, "joined", tail.next(false), "2024-01-01 panic\n\tat main\n\tat run")
+
+	// Or once no line followed within the timeout.
+	time.Sleep(60 * time.Millisecond)
+	expectMessages(t, "timeout", tail.next(false), "2024-01-01 next")
+
+	// Or once it reaches the maximum number of lines.
+	appendFile(t, path, "2024-01-02 long\n1\n2\n3\n")
+	expectMessages(t, "max lines", tail.next(false), "2024-01-02 long\n1\n2")
+
+	// Continuation lines without a first line form an event of their own.
+	time.Sleep(60 * time.Millisecond)
+	expectMessages(t, "orphan", tail.next(false), "3")
+}
+
+func TestFileTransportOverlongLine(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	long := strings.Repeat("a", fileMaxLineBytes)
+	writeFile(t, path, long+"tail\nnext\n")
+
+	tail := newFileTail(t, FileInput{Paths: []string{path}}, "")
+	got := tail.next(true)
+	if len(got) != 3 || got[0] != long || got[1] != "tail" || got[2] != "next" {
+		lengths := make([]int, len(got))
+		for i, message := range got {
+			lengths[i] = len(message)
+		}
+		t.Errorf("message lengths = %v, want [%d 4 4]", lengths, fileMaxLineBytes)
+	}
+}
+
+func TestFileTransportRetriesFailedLines(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	writeFile(t, path, "one\ntwo\n")
+
+	tail := newFileTail(t, FileInput{Paths: []string{path}}, "")
+	tail.fail = true
+	expectMessages(t, "failing", tail.next(true))
+
+	tail.fail = false
+	expectMessages(t, "recovered", tail.next(false), "one", "two")
+}
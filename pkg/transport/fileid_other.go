@@ -0,0 +1,11 @@
+//go:build !unix
+
+package transport
+
+import "os"
+
+// fileID falls back to the path where inodes are unavailable, so renamed files
+// are treated as new files.
+func fileID(path string, info os.FileInfo) string {
+	return path
+}
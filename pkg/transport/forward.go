@@ -0,0 +1,509 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mohammadhptp/pulse/pkg/logger"
+	"github.com/mohammadhptp/pulse/pkg/metrics"
+	"github.com/mohammadhptp/pulse/pkg/models"
+	"github.com/vmihailenco/msgpack/v5"
+	"go.uber.org/zap"
+)
+
+// forwardEventTime is the Fluentd EventTime extension (type 0): seconds and
+// nanoseconds as two big-endian uint32 values.
+type forwardEventTime struct {
+	time.Time
+}
+
+func (t *forwardEventTime) MarshalMsgpack() ([]byte, error) {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint32(b, uint32(t.Unix()))
+	binary.BigEndian.PutUint32(b[4:], uint32(t.Nanosecond()))
+	return b, nil
+}
+
+func (t *forwardEventTime) UnmarshalMsgpack(b []byte) error {
+	if len(b) != 8 {
+		return fmt.Errorf("invalid EventTime length %d", len(b))
+	}
+	t.Time = time.Unix(int64(binary.BigEndian.Uint32(b)), int64(binary.BigEndian.Uint32(b[4:])))
+	return nil
+}
+
+func init() {
+	msgpack.RegisterExt(0, (*forwardEventTime)(nil))
+}
+
+// forwardMaxChunkBytes bounds the decompressed entries of a
+// CompressedPackedForward message.
+const forwardMaxChunkBytes = 64 << 20
+
+var (
+	forwardMessageKeys = []string{"message", "log", "msg"}
+	forwardLevelKeys   = []string{"level", "severity", "log.level"}
+	forwardHostKeys    = []string{"host", "hostname", "host.name"}
+	forwardServiceKeys = []string{"service", "service_name", "service.name"}
+)
+
+// ForwardTransport receives events over the Fluentd Forward protocol, as sent
+// by the forward output of Fluentd and Fluent Bit. Message, Forward,
+// PackedForward and CompressedPackedForward modes are supported.
+type ForwardTransport struct {
+	handlerRef
+	port      int
+	sharedKey string
+	hostname  string
+
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+	connMu   sync.Mutex
+	wg       sync.WaitGroup
+}
+
+// NewForwardTransport creates a Forward protocol transport listening on port.
+// When sharedKey is set, clients must complete the shared key handshake
+// before sending events; hostname is the server name used in the handshake.
+func NewForwardTransport(port int, sharedKey, hostname string) *ForwardTransport {
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+
+	return &ForwardTransport{
+		handlerRef: handlerRef{source: "forward"},
+		port:       port,
+		sharedKey:  sharedKey,
+		hostname:   hostname,
+		conns:      make(map[net.Conn]struct{}),
+	}
+}
+
+func (f *ForwardTransport) Start(ctx context.Context) error {
+	addr := fmt.Sprintf(":%d", f.port)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	f.listener = listener
+
+	logger.Info("Starting Forward transport",
+		zap.String("address", addr),
+		zap.Bool("sharedKey", f.sharedKey != ""))
+
+	f.wg.Add(1)
+	go f.accept()
+
+	go func() {
+		<-ctx.Done()
+		f.Stop()
+	}()
+
+	return nil
+}
+
+func (f *ForwardTransport) Stop() error {
+	f.connMu.Lock()
+	if f.closed || f.listener == nil {
+		f.connMu.Unlock()
+		return nil
+	}
+	f.closed = true
+
+	logger.Info("Stopping Forward transport")
+	f.listener.Close()
+	for conn := range f.conns {
+		conn.Close()
+	}
+	f.connMu.Unlock()
+
+	f.wg.Wait()
+	return nil
+}
+
+func (f *ForwardTransport) Close() error {
+	return f.Stop()
+}
+
+func (f *ForwardTransport) accept() {
+	defer f.wg.Done()
+
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logger.Error("Forward accept error", zap.Error(err))
+			}
+			return
+		}
+
+		f.connMu.Lock()
+		if f.closed {
+			f.connMu.Unlock()
+			conn.Close()
+			return
+		}
+		f.conns[conn] = struct{}{}
+		f.wg.Add(1)
+		f.connMu.Unlock()
+
+		go f.serveConn(conn)
+	}
+}
+
+func (f *ForwardTransport) serveConn(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		f.connMu.Lock()
+		delete(f.conns, conn)
+		f.connMu.Unlock()
+		f.wg.Done()
+	}()
+
+	remote := conn.RemoteAddr().String()
+	decoder := msgpack.NewDecoder(bufio.NewReader(metrics.CountBytes("forward", conn)))
+	encoder := msgpack.NewEncoder(conn)
+
+	if f.sharedKey != "" {
+		if err := f.handshake(decoder, encoder); err != nil {
+			logger.Warn("Forward handshake failed", zap.Error(err), zap.String("remote", remote))
+			return
+		}
+	}
+
+	for {
+		message, err := decoder.DecodeInterface()
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				logger.Warn("Forward connection error", zap.Error(err), zap.String("remote", remote))
+			}
+			return
+		}
+
+		chunk, err := f.handleMessage(message, remote)
+		if err != nil {
+			logger.Warn("Invalid Forward message", zap.Error(err), zap.String("remote", remote))
+			return
+		}
+
+		// Acknowledge only after every event of the chunk was accepted, so
+		// the client retries the chunk otherwise.
+		if chunk != "" {
+			if err := encoder.Encode(map[string]string{"ack": chunk}); err != nil {
+				logger.Warn("Failed to acknowledge Forward chunk", zap.Error(err), zap.String("remote", remote))
+				return
+			}
+		}
+	}
+}
+
+// handshake runs the shared key authentication of the Forward protocol:
+// HELO from the server, PING from the client and PONG from the server.
+func (f *ForwardTransport) handshake(decoder *msgpack.Decoder, encoder *msgpack.Encoder) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	helo := []interface{}{"HELO", map[string]interface{}{
+		"nonce":     nonce,
+		"auth":      "",
+		"keepalive": true,
+	}}
+	if err := encoder.Encode(helo); err != nil {
+		return err
+	}
+
+	ping, err := decoder.DecodeSlice()
+	if err != nil {
+		return err
+	}
+	if len(ping) < 4 || stringValue(ping[0]) != "PING" {
+		return errors.New("expected PING message")
+	}
+
+	clientHostname := stringValue(ping[1])
+	salt := stringValue(ping[2])
+	digest := stringValue(ping[3])
+
+	expected := forwardDigest(salt, clientHostname, nonce, f.sharedKey)
+	authenticated := subtle.ConstantTimeCompare([]byte(digest), []byte(expected)) == 1
+
+	reason := ""
+	if !authenticated {
+		reason = "shared key mismatch"
+	}
+
+	pong := []interface{}{
+		"PONG",
+		authenticated,
+		reason,
+		f.hostname,
+		forwardDigest(salt, f.hostname, nonce, f.sharedKey),
+	}
+	if err := encoder.Encode(pong); err != nil {
+		return err
+	}
+
+	if !authenticated {
+		return fmt.Errorf("client %q failed shared key authentication", clientHostname)
+	}
+	return nil
+}
+
+func forwardDigest(salt, hostname string, nonce []byte, sharedKey string) string {
+	h := sha512.New()
+	h.Write([]byte(salt))
+	h.Write([]byte(hostname))
+	h.Write(nonce)
+	h.Write([]byte(sharedKey))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// handleMessage processes one Forward message received from remote and returns
+// the chunk ID to acknowledge, if the client asked for one.
+func (f *ForwardTransport) handleMessage(message interface{}, remote string) (string, error) {
+	handler := withRemoteAddr(f.eventHandler(), remote)
+	if handler == nil {
+		return "", errors.New("event handler not configured")
+	}
+
+	parts, ok := message.([]interface{})
+	if !ok || len(parts) < 2 {
+		return "", errors.New("message is not an array")
+	}
+
+	tag := stringValue(parts[0])
+
+	var entries [][]interface{}
+	var option map[string]interface{}
+
+	switch payload := parts[1].(type) {
+	case []interface{}:
+		// Forward mode: [tag, [[time, record], ...], option]
+		for _, item := range payload {
+			entry, ok := item.([]interface{})
+			if !ok || len(entry) < 2 {
+				return "", errors.New("invalid Forward entry")
+			}
+			entries = append(entries, entry)
+		}
+		option = optionAt(parts, 2)
+	case []byte, string:
+		// PackedForward mode: [tag, msgpack stream of entries, option]
+		option = optionAt(parts, 2)
+		packed, err := unpackEntries([]byte(stringValue(payload)), option["compressed"] == "gzip")
+		if err != nil {
+			return "", err
+		}
+		entries = packed
+	default:
+		// Message mode: [tag, time, record, option]
+		if len(parts) < 3 {
+			return "", errors.New("invalid Message mode message")
+		}
+		entries = [][]interface{}{{parts[1], parts[2]}}
+		option = optionAt(parts, 3)
+	}
+
+	for _, entry := range entries {
+		record, ok := entry[1].(map[string]interface{})
+		if !ok {
+			return "", errors.New("record is not a map")
+		}
+
+		if err := handler(forwardEvent(tag, entry[0], record)); err != nil {
+			logger.Error("Failed to process Forward event", zap.Error(err))
+			// Without an acknowledgement the client resends the chunk,
+			// including the events already written.
+			return "", nil
+		}
+	}
+
+	chunk, _ := option["chunk"].(string)
+	return chunk, nil
+}
+
+func optionAt(parts []interface{}, i int) map[string]interface{} {
+	if len(parts) <= i {
+		return nil
+	}
+	option, _ := parts[i].(map[string]interface{})
+	return option
+}
+
+// unpackEntries decodes the entries of a (Compressed)PackedForward message.
+func unpackEntries(packed []byte, compressed bool) ([][]interface{}, error) {
+	if compressed {
+		gz, err := gzip.NewReader(bytes.NewReader(packed))
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+
+		packed, err = io.ReadAll(io.LimitReader(gz, forwardMaxChunkBytes+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(packed) > forwardMaxChunkBytes {
+			return nil, fmt.Errorf("decompressed entries exceed %d bytes", forwardMaxChunkBytes)
+		}
+	}
+
+	decoder := msgpack.NewDecoder(bytes.NewReader(packed))
+	var entries [][]interface{}
+	for {
+		entry, err := decoder.DecodeSlice()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(entry) < 2 {
+			return nil, errors.New("invalid PackedForward entry")
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// forwardEvent maps a Forward record onto an Event. Well-known keys provide
+// the message, level, host and service, falling back to the tag for the
+// service; everything else is flattened into attributes.
+func forwardEvent(tag string, eventTime interface{}, record map[string]interface{}) models.Event {
+	event := models.Event{
+		EventTimeMs: forwardTimeMs(eventTime),
+		Service:     tag,
+	}
+
+	fields := models.FlattenDocument(normalizeRecord(record))
+	event.Message = takeField(fields, forwardMessageKeys)
+	event.Level = takeField(fields, forwardLevelKeys)
+	event.Host = takeField(fields, forwardHostKeys)
+	if service := takeField(fields, forwardServiceKeys); service != "" {
+		event.Service = service
+	}
+
+	fields["fluent.tag"] = tag
+	event.Attributes = fields
+
+	return event
+}
+
+// forwardTimeMs converts the time of an entry, in seconds unless it is an
+// EventTime, to milliseconds. Missing times, and negative ones or those too
+// large for milliseconds, which would otherwise wrap around, become the
+// current time.
+func forwardTimeMs(value interface{}) uint64 {
+	const maxSeconds = math.MaxInt64 / 1000
+
+	switch t := value.(type) {
+	case *forwardEventTime:
+		return uint64(t.UnixMilli())
+	case uint64:
+		if t <= maxSeconds {
+			return t * 1000
+		}
+	case int8, int16, int32, int64, uint8, uint16, uint32:
+		if seconds := toInt64(t); seconds >= 0 && seconds <= maxSeconds {
+			return uint64(seconds) * 1000
+		}
+	case float64:
+		if t >= 0 && t*1000 < math.MaxInt64 {
+			return uint64(t * 1000)
+		}
+	case float32:
+		if t >= 0 && float64(t)*1000 < math.MaxInt64 {
+			return uint64(float64(t) * 1000)
+		}
+	}
+	return uint64(time.Now().UnixMilli())
+}
+
+func toInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case int64:
+		return n
+	case int8:
+		return int64(n)
+	case int16:
+		return int64(n)
+	case int32:
+		return int64(n)
+	case uint8:
+		return int64(n)
+	case uint16:
+		return int64(n)
+	case uint32:
+		return int64(n)
+	default:
+		return 0
+	}
+}
+
+// normalizeRecord converts msgpack binary values to strings so records can be
+// flattened like JSON documents.
+func normalizeRecord(value map[string]interface{}) map[string]interface{} {
+	for key, v := range value {
+		value[key] = normalizeValue(v)
+	}
+	return value
+}
+
+func normalizeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case map[string]interface{}:
+		return normalizeRecord(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = normalizeValue(v[i])
+		}
+		return v
+	case *forwardEventTime:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return v
+	}
+}
+
+// takeField removes and returns the first present field of keys.
+func takeField(fields map[string]string, keys []string) string {
+	for _, key := range keys {
+		if value, ok := fields[key]; ok {
+			delete(fields, key)
+			return value
+		}
+	}
+	return ""
+}
+
+func stringValue(v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case []byte:
+		return string(s)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(s)
+	}
+}
@@ -0,0 +1,371 @@
+package transport
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mohammadhptp/pulse/pkg/models"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// forwardClient is the client end of a connection served by a
+// ForwardTransport.
+type forwardClient struct {
+	conn    net.Conn
+	encoder *msgpack.Encoder
+	decoder *msgpack.Decoder
+}
+
+func dialForward(t *testing.T, f *ForwardTransport) *forwardClient {
+	t.Helper()
+	if f.listener == nil {
+		if err := f.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { f.Stop() })
+	}
+
+	conn, err := net.Dial("tcp", f.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	t.Cleanup(func() { conn.Close() })
+
+	return &forwardClient{conn: conn, encoder: msgpack.NewEncoder(conn), decoder: msgpack.NewDecoder(conn)}
+}
+
+func (c *forwardClient) send(t *testing.T, message ...interface{}) {
+	t.Helper()
+	if err := c.encoder.Encode(message); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (c *forwardClient) ack(t *testing.T) string {
+	t.Helper()
+	response, err := c.decoder.DecodeMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stringValue(response["ack"])
+}
+
+// recordEvents sets a handler on f collecting its events, failing those whose
+// message is "fail".
+func recordEvents(f *ForwardTransport) func() []models.Event {
+	var mu sync.Mutex
+	var events []models.Event
+	f.SetEventHandler(func(e models.Event) error {
+		if e.Message == "fail" {
+			return errors.New("kafka unavailable")
+		}
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+		return nil
+	})
+	return func() []models.Event {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]models.Event(nil), events...)
+	}
+}
+
+func packEntries(t *testing.T, entries ...[]interface{}) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	encoder := msgpack.NewEncoder(&buf)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestForwardModes(t *testing.T) {
+	first := map[string]interface{}{"message": "first", "level": "warn", "user": map[string]interface{}{"id": 7}}
+	second := map[string]interface{}{"log": "second", "service": "checkout", "host": []byte("web-1")}
+	packed := packEntries(t, []interface{}{int64(1700000000), first}, []interface{}{1700000001.5, second})
+
+	tests := []struct {
+		name    string
+		message []interface{}
+	}{
+		{
+			name: "Message",
+			message: []interface{}{"app.web", int64(1700000000), first,
+				map[string]interface{}{"chunk": "c1"}},
+		},
+		{
+			name: "Forward",
+			message: []interface{}{"app.web", []interface{}{
+				[]interface{}{int64(1700000000), first},
+				[]interface{}{&forwardEventTime{time.Unix(1700000001, 500000000)}, second},
+			}, map[string]interface{}{"chunk": "c1"}},
+		},
+		{
+			name:    "PackedForward",
+			message: []interface{}{"app.web", packed, map[string]interface{}{"chunk": "c1"}},
+		},
+		{
+			name: "CompressedPackedForward",
+			message: []interface{}{"app.web", gzipBytes(t, packed),
+				map[string]interface{}{"chunk": "c1", "compressed": "gzip"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewForwardTransport(0, "", "server")
+			events := recordEvents(f)
+			client := dialForward(t, f)
+
+			client.send(t, tt.message...)
+			if chunk := client.ack(t); chunk != "c1" {
+				t.Fatalf("ack = %q, want c1", chunk)
+			}
+
+			got := events()
+			want := []models.Event{
+				{EventTimeMs: 1700000000000, Service: "app.web", Level: "warn", Message: "first",
+					Attributes: map[string]string{"user.id": "7", "fluent.tag": "app.web"}},
+				{EventTimeMs: 1700000001500, Service: "checkout", Host: "web-1", Message: "second",
+					Attributes: map[string]string{"fluent.tag": "app.web"}},
+			}
+			if tt.name == "Message" {
+				want = want[:1]
+			}
+			if len(got) != len(want) {
+				t.Fatalf("got %d events, want %d: %+v", len(got), len(want), got)
+			}
+			for i := range want {
+				g, w := got[i], want[i]
+				if g.EventTimeMs != w.EventTimeMs || g.Service != w.Service || g.Level != w.Level ||
+					g.Message != w.Message || g.Host != w.Host || !sameAttributes(g.Attributes, w.Attributes) {
+					t.Errorf("event %d = %+v, want %+v", i, g, w)
+				}
+			}
+		})
+	}
+}
+
+func sameAttributes(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if b[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+func TestForwardAcknowledgements(t *testing.T) {
+	f := NewForwardTransport(0, "", "server")
+	events := recordEvents(f)
+	client := dialForward(t, f)
+
+	record := func(message string) map[string]interface{} {
+		return map[string]interface{}{"message": message}
+	}
+	// Without a chunk option nothing is acknowledged, and a chunk with a
+	// failed event is not acknowledged so that the client resends it.
+	client.send(t, "app", int64(1700000000), record("unacknowledged"))
+	client.send(t, "app", []interface{}{
+		[]interface{}{int64(1700000000), record("written")},
+		[]interface{}{int64(1700000000), record("fail")},
+	}, map[string]interface{}{"chunk": "failed"})
+	client.send(t, "app", int64(1700000000), record("acknowledged"), map[string]interface{}{"chunk": "ok"})
+
+	if chunk := client.ack(t); chunk != "ok" {
+		t.Errorf("ack = %q, want ok", chunk)
+	}
+
+	var messages []string
+	for _, e := range events() {
+		messages = append(messages, e.Message)
+	}
+	if want := "unacknowledged written acknowledged"; strings.Join(messages, " ") != want {
+		t.Errorf("written %v, want %s", messages, want)
+	}
+}
+
+func TestForwardInvalidMessageClosesConnection(t *testing.T) {
+	f := NewForwardTransport(0, "", "server")
+	recordEvents(f)
+	client := dialForward(t, f)
+
+	client.send(t, "app", []interface{}{"not an entry"}, map[string]interface{}{"chunk": "c1"})
+	if _, err := client.decoder.DecodeMap(); err == nil {
+		t.Error("invalid message was acknowledged, want the connection closed")
+	}
+}
+
+func sha512Hex(parts ...[]byte) string {
+	h := sha512.New()
+	for _, part := range parts {
+		h.Write(part)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func TestForwardHandshake(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		ok   bool
+	}{
+		{"shared key", "secret", true},
+		{"wrong key", "guess", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewForwardTransport(0, "secret", "server")
+			events := recordEvents(f)
+			client := dialForward(t, f)
+
+			helo, err := client.decoder.DecodeSlice()
+			if err != nil {
+				t.Fatal(err)
+			}
+			options, _ := helo[1].(map[string]interface{})
+			if stringValue(helo[0]) != "HELO" || options == nil {
+				t.Fatalf("HELO = %v", helo)
+			}
+			nonce := []byte(stringValue(options["nonce"]))
+			if len(nonce) == 0 {
+				t.Fatal("HELO without nonce")
+			}
+
+			digest := sha512Hex([]byte("salt"), []byte("client"), nonce, []byte(tt.key))
+			client.send(t, "PING", "client", "salt", digest, "", "")
+
+			pong, err := client.decoder.DecodeSlice()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pong) != 5 || stringValue(pong[0]) != "PONG" || pong[1] != tt.ok {
+				t.Fatalf("PONG = %v, want authenticated %v", pong, tt.ok)
+			}
+			if want := sha512Hex([]byte("salt"), []byte("server"), nonce, []byte("secret")); stringValue(pong[4]) != want {
+				t.Errorf("server digest = %v, want %s", pong[4], want)
+			}
+
+			// An unauthenticated client is disconnected after the PONG.
+			message := []interface{}{"app", int64(1700000000), map[string]interface{}{"message": "hello"}, map[string]interface{}{"chunk": "c1"}}
+			if !tt.ok {
+				client.encoder.Encode(message)
+				if _, err := client.decoder.DecodeMap(); err == nil {
+					t.Error("unauthenticated client was acknowledged")
+				}
+				if len(events()) != 0 {
+					t.Errorf("unauthenticated client wrote %v", events())
+				}
+				return
+			}
+			client.send(t, message...)
+			if chunk := client.ack(t); chunk != "c1" {
+				t.Errorf("ack = %q, want c1", chunk)
+			}
+		})
+	}
+}
+
+func TestUnpackEntriesLimit(t *testing.T) {
+	entry := packEntries(t, []interface{}{int64(1), map[string]interface{}{"message": strings.Repeat("a", 1024)}})
+	oversized := bytes.Repeat(entry, forwardMaxChunkBytes/len(entry)+1)
+
+	tests := []struct {
+		name    string
+		packed  []byte
+		entries int
+		err     bool
+	}{
+		{"within the limit", gzipBytes(t, bytes.Repeat(entry, 10)), 10, false},
+		{"over the limit", gzipBytes(t, oversized), 0, true},
+		{"invalid gzip", []byte("not gzip"), 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := unpackEntries(tt.packed, true)
+			if (err != nil) != tt.err || len(entries) != tt.entries {
+				t.Errorf("unpackEntries() = %d entries, %v; want %d entries, error %v", len(entries), err, tt.entries, tt.err)
+			}
+		})
+	}
+}
+
+func TestForwardTimeMs(t *testing.T) {
+	now := uint64(time.Now().UnixMilli())
+
+	tests := []struct {
+		name  string
+		value interface{}
+		want  uint64
+	}{
+		{"EventTime", &forwardEventTime{time.UnixMilli(1700000000123)}, 1700000000123},
+		{"int64", int64(1700000000), 1700000000000},
+		{"uint32", uint32(1700000000), 1700000000000},
+		{"int8", int8(1), 1000},
+		{"float64", 1700000000.25, 1700000000250},
+		{"float32", float32(2.5), 2500},
+		{"zero", int64(0), 0},
+		{"negative int", int64(-1), now},
+		{"negative int8", int8(-1), now},
+		{"negative float", -0.5, now},
+		{"too large int", int64(math.MaxInt64), now},
+		{"too large uint", uint64(math.MaxUint64), now},
+		{"too large float", 1e300, now},
+		{"NaN", math.NaN(), now},
+		{"missing", nil, now},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := forwardTimeMs(tt.value)
+			// The current time is only compared to the second.
+			if tt.want == now && (got < now || got > now+1000) || tt.want != now && got != tt.want {
+				t.Errorf("forwardTimeMs(%v) = %d, want %d", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForwardEventTimeRoundTrip(t *testing.T) {
+	in := &forwardEventTime{time.Unix(1700000000, 123456789)}
+	data, err := msgpack.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out interface{}
+	if err := msgpack.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := out.(*forwardEventTime); !ok || !got.Equal(in.Time) {
+		t.Errorf("decoded %v, want %v", out, in)
+	}
+}
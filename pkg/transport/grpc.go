@@ -0,0 +1,293 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/mohammadhptp/pulse/pkg/logger"
+	"github.com/mohammadhptp/pulse/pkg/metrics"
+	"github.com/mohammadhptp/pulse/pkg/models"
+	"github.com/mohammadhptp/pulse/pkg/pb/pulsev1"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// GRPCTransport receives events over the pulse.v1.EventService gRPC service.
+type GRPCTransport struct {
+	pulsev1.UnimplementedEventServiceServer
+	handlerRef
+
+	server         *grpc.Server
+	health         *health.Server
+	port           int
+	maxRecvMsgSize int
+	timeout        time.Duration
+}
+
+// NewGRPCTransport creates a gRPC transport listening on port. maxRecvMsgSize
+// limits the size of a single request message and timeout bounds how long an
+// RPC may run; zero values keep the gRPC defaults.
+func NewGRPCTransport(port, maxRecvMsgSize int, timeout time.Duration) *GRPCTransport {
+	return &GRPCTransport{
+		handlerRef:     handlerRef{source: "grpc"},
+		port:           port,
+		maxRecvMsgSize: maxRecvMsgSize,
+		timeout:        timeout,
+	}
+}
+
+func (g *GRPCTransport) Start(ctx context.Context) error {
+	addr := fmt.Sprintf(":%d", g.port)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	unary := []grpc.UnaryServerInterceptor{unaryMetrics}
+	stream := []grpc.StreamServerInterceptor{streamMetrics}
+	if g.timeout > 0 {
+		unary = append(unary, g.unaryDeadline)
+		stream = append(stream, g.streamDeadline)
+	}
+
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	}
+	if g.maxRecvMsgSize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(g.maxRecvMsgSize))
+	}
+
+	g.server = grpc.NewServer(opts...)
+	g.health = health.NewServer()
+
+	pulsev1.RegisterEventServiceServer(g.server, g)
+	healthpb.RegisterHealthServer(g.server, g.health)
+	reflection.Register(g.server)
+
+	g.health.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	g.health.SetServingStatus(pulsev1.EventService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+
+	logger.Info("Starting gRPC transport", zap.String("address", addr))
+
+	go func() {
+		if err := g.server.Serve(listener); err != nil && err != grpc.ErrServerStopped {
+			logger.Error("gRPC server error", zap.Error(err))
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		g.Stop()
+	}()
+
+	return nil
+}
+
+func (g *GRPCTransport) Stop() error {
+	if g.server == nil {
+		return nil
+	}
+
+	logger.Info("Stopping gRPC transport")
+	g.health.Shutdown()
+
+	stopped := make(chan struct{})
+	go func() {
+		g.server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		g.server.Stop()
+	}
+
+	return nil
+}
+
+func (g *GRPCTransport) Close() error {
+	return g.Stop()
+}
+
+func (g *GRPCTransport) Push(ctx context.Context, req *pulsev1.PushRequest) (*pulsev1.PushResponse, error) {
+	handler := withRemoteAddr(g.eventHandler(), peerAddr(ctx))
+	if handler == nil {
+		return nil, status.Error(codes.Unavailable, "event handler not configured")
+	}
+
+	response := &pulsev1.PushResponse{}
+	g.pushEvents(ctx, handler, req.GetEvents(), response)
+
+	if response.Accepted == 0 && response.Rejected > 0 {
+		return nil, status.Error(codes.Unavailable, "failed to process events")
+	}
+
+	return response, nil
+}
+
+func (g *GRPCTransport) PushStream(stream grpc.ClientStreamingServer[pulsev1.PushRequest, pulsev1.PushResponse]) error {
+	handler := withRemoteAddr(g.eventHandler(), peerAddr(stream.Context()))
+	if handler == nil {
+		return status.Error(codes.Unavailable, "event handler not configured")
+	}
+
+	response := &pulsev1.PushResponse{}
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(response)
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Context().Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
+
+		g.pushEvents(stream.Context(), handler, req.GetEvents(), response)
+	}
+}
+
+// peerAddr returns the address of the client of a call.
+func peerAddr(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return ""
+}
+
+// pushEvents hands events to the handler and records the outcome of each in
+// response. Indexes continue from the events already counted in response.
+func (g *GRPCTransport) pushEvents(ctx context.Context, handler EventHandler, events []*pulsev1.Event, response *pulsev1.PushResponse) {
+	var traceparent string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(TraceparentHeader); len(values) > 0 {
+			traceparent = values[0]
+		}
+	}
+
+	offset := response.Accepted + response.Rejected
+	for i, pbEvent := range events {
+		event := eventFromProto(pbEvent)
+		applyTraceparent(&event, traceparent)
+
+		if err := handler(event); err != nil {
+			logger.Error("Failed to process event", zap.Error(err))
+			response.Rejected++
+			response.Errors = append(response.Errors, &pulsev1.PushError{
+				Index:   offset + uint32(i),
+				Message: err.Error(),
+			})
+			continue
+		}
+		response.Accepted++
+	}
+}
+
+// unaryMetrics counts event service calls by status code and the bytes of
+// their requests.
+func unaryMetrics(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !isEventService(info.FullMethod) {
+		return handler(ctx, req)
+	}
+	if m, ok := req.(proto.Message); ok {
+		metrics.IngestBytes.WithLabelValues("grpc").Add(float64(proto.Size(m)))
+	}
+	resp, err := handler(ctx, req)
+	metrics.IngestRequests.WithLabelValues("grpc", status.Code(err).String()).Inc()
+	return resp, err
+}
+
+// streamMetrics counts event service streams by status code and the bytes of
+// the messages received on them.
+func streamMetrics(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !isEventService(info.FullMethod) {
+		return handler(srv, ss)
+	}
+	err := handler(srv, &countingStream{ServerStream: ss})
+	metrics.IngestRequests.WithLabelValues("grpc", status.Code(err).String()).Inc()
+	return err
+}
+
+// isEventService reports whether a method belongs to pulse.v1.EventService,
+// rather than to health checks or reflection.
+func isEventService(fullMethod string) bool {
+	return strings.HasPrefix(fullMethod, "/"+pulsev1.EventService_ServiceDesc.ServiceName+"/")
+}
+
+type countingStream struct {
+	grpc.ServerStream
+}
+
+func (s *countingStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if msg, ok := m.(proto.Message); ok {
+		metrics.IngestBytes.WithLabelValues("grpc").Add(float64(proto.Size(msg)))
+	}
+	return nil
+}
+
+func (g *GRPCTransport) unaryDeadline(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, cancel := g.withDeadline(ctx)
+	defer cancel()
+	return handler(ctx, req)
+}
+
+func (g *GRPCTransport) streamDeadline(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, cancel := g.withDeadline(ss.Context())
+	defer cancel()
+	return handler(srv, &deadlineStream{ServerStream: ss, ctx: ctx})
+}
+
+// withDeadline applies the configured timeout unless the client already set
+// a shorter deadline.
+func (g *GRPCTransport) withDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= g.timeout {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, g.timeout)
+}
+
+type deadlineStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *deadlineStream) Context() context.Context {
+	return s.ctx
+}
+
+func eventFromProto(e *pulsev1.Event) models.Event {
+	event := models.Event{
+		EventTimeMs:    e.GetEventTimeMs(),
+		Service:        e.GetService(),
+		Level:          e.GetLevel(),
+		SeverityNumber: models.SeverityFromNumber(int64(e.GetSeverityNumber())),
+		Message:        e.GetMessage(),
+		Host:           e.GetHost(),
+		RequestID:      e.GetRequestId(),
+		TraceID:        e.GetTraceId(),
+		SpanID:         e.GetSpanId(),
+		TraceFlags:     uint8(e.GetTraceFlags()),
+		Attributes:     e.GetAttributes(),
+	}
+	event.NormalizeTrace()
+	return event
+}
@@ -0,0 +1,64 @@
+package transport
+
+import (
+	"testing"
+
+	"github.com/mohammadhptp/pulse/pkg/pb/pulsev1"
+)
+
+func TestEventFromProtoTraceContext(t *testing.T) {
+	tests := []struct {
+		name    string
+		event   *pulsev1.Event
+		traceID string
+		spanID  string
+		flags   uint8
+	}{
+		{
+			name:    "valid",
+			event:   &pulsev1.Event{TraceId: "4BF92F3577B34DA6A3CE929D0E0E4736", SpanId: "00F067AA0BA902B7", TraceFlags: 1},
+			traceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+			spanID:  "00f067aa0ba902b7",
+			flags:   1,
+		},
+		{
+			name:  "invalid trace",
+			event: &pulsev1.Event{TraceId: "abc", SpanId: "00f067aa0ba902b7", TraceFlags: 1},
+		},
+		{
+			name:    "invalid span",
+			event:   &pulsev1.Event{TraceId: "4bf92f3577b34da6a3ce929d0e0e4736", SpanId: "xyz", TraceFlags: 1},
+			traceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := eventFromProto(tt.event)
+			if e.TraceID != tt.traceID || e.SpanID != tt.spanID || e.TraceFlags != tt.flags {
+				t.Errorf("got %q/%q/%d, want %q/%q/%d", e.TraceID, e.SpanID, e.TraceFlags, tt.traceID, tt.spanID, tt.flags)
+			}
+		})
+	}
+}
+
+func TestEventFromProtoSeverity(t *testing.T) {
+	tests := []struct {
+		name     string
+		event    *pulsev1.Event
+		level    string
+		severity uint8
+	}{
+		{"number", &pulsev1.Event{SeverityNumber: 17}, "", 17},
+		{"out of range", &pulsev1.Event{Level: "WARN", SeverityNumber: 25}, "WARN", 0},
+		{"wrapping to zero", &pulsev1.Event{Level: "ERROR", SeverityNumber: 256}, "ERROR", 0},
+		{"wrapping to a severity", &pulsev1.Event{SeverityNumber: 265}, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := eventFromProto(tt.event)
+			if e.Level != tt.level || e.SeverityNumber != tt.severity {
+				t.Errorf("got %q/%d, want %q/%d", e.Level, e.SeverityNumber, tt.level, tt.severity)
+			}
+		})
+	}
+}
@@ -1,33 +1,79 @@
 package transport
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/google/uuid"
 	"github.com/mohammadhptp/pulse/internal/storage"
 	"github.com/mohammadhptp/pulse/pkg/logger"
+	"github.com/mohammadhptp/pulse/pkg/metrics"
 	"github.com/mohammadhptp/pulse/pkg/models"
 	"go.uber.org/zap"
 )
 
+const (
+	httpMaxBodyBytes = 16 << 20
+
+	defaultHistogramRange = time.Hour
+	maxHistogramBuckets   = 120
+
+	defaultFacetLimit = 10
+	maxFacetLimit     = 100
+)
+
+// defaultFacetFields are the fields faceted when a request names none.
+var defaultFacetFields = []string{"service", "level", "host"}
+
+// histogramIntervals are the bucket sizes picked for histograms without an
+// explicit interval.
+var histogramIntervals = []time.Duration{
+	time.Second, 5 * time.Second, 10 * time.Second, 30 * time.Second,
+	time.Minute, 5 * time.Minute, 10 * time.Minute, 30 * time.Minute,
+	time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour, 24 * time.Hour, 7 * 24 * time.Hour,
+}
+
 type HTTPTransport struct {
 	server   *http.Server
 	handler  EventHandler
 	port     int
 	endpoint string
 	mu       sync.RWMutex
+
+	conn   clickhouse.Conn
+	connMu sync.Mutex
+
+	routes []httpRoute
+	ingest http.Handler
+
+	maxExportRows int
+	jobs          *jobStore
+}
+
+type httpRoute struct {
+	pattern string
+	handler http.Handler
 }
 
 func NewHTTPTransport(port int, endpoint string) *HTTPTransport {
-	return &HTTPTransport{
+	h := &HTTPTransport{
 		port:     port,
 		endpoint: endpoint,
+		jobs:     newJobStore(),
 	}
+	h.ingest = metrics.InstrumentHandler("http", http.HandlerFunc(h.handleEvents))
+	return h
 }
 
 func (h *HTTPTransport) SetEventHandler(handler EventHandler) {
@@ -36,10 +82,26 @@ func (h *HTTPTransport) SetEventHandler(handler EventHandler) {
 	h.handler = handler
 }
 
+// Handle registers an additional handler on the HTTP server, using the
+// http.ServeMux pattern syntax. It must be called before Start.
+func (h *HTTPTransport) Handle(pattern string, handler http.Handler) {
+	h.routes = append(h.routes, httpRoute{pattern: pattern, handler: handler})
+}
+
 func (h *HTTPTransport) Start(ctx context.Context) error {
 	mux := http.NewServeMux()
-	mux.HandleFunc(h.endpoint, h.handleEvents)
-	mux.HandleFunc(h.endpoint, h.handleFilterEvents)
+	mux.HandleFunc(h.endpoint, h.handleEndpoint)
+	mux.HandleFunc("GET "+h.endpoint+"/histogram", h.handleHistogram)
+	mux.HandleFunc("GET "+h.endpoint+"/facets", h.handleFacets)
+	mux.HandleFunc("GET "+h.endpoint+"/export", h.handleExport)
+	mux.HandleFunc("POST "+h.endpoint+"/jobs", h.handleSubmitJob)
+	mux.HandleFunc("GET "+h.endpoint+"/jobs/{id}", h.handleJob)
+	mux.HandleFunc("GET "+h.endpoint+"/jobs/{id}/results", h.handleJobResults)
+	mux.HandleFunc("DELETE "+h.endpoint+"/jobs/{id}", h.handleCancelJob)
+	mux.HandleFunc("GET /traces/{trace_id}", h.handleTrace)
+	for _, route := range h.routes {
+		mux.Handle(route.pattern, route.handler)
+	}
 
 	addr := fmt.Sprintf(":%d", h.port)
 	h.server = &http.Server{
@@ -72,19 +134,35 @@ func (h *HTTPTransport) Stop() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	return h.server.Shutdown(ctx)
+	err := h.server.Shutdown(ctx)
+	h.jobs.stop()
+
+	h.connMu.Lock()
+	if h.conn != nil {
+		h.conn.Close()
+		h.conn = nil
+	}
+	h.connMu.Unlock()
+
+	return err
 }
 
 func (h *HTTPTransport) Close() error {
 	return h.Stop()
 }
 
-func (h *HTTPTransport) handleEvents(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+func (h *HTTPTransport) handleEndpoint(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		h.ingest.ServeHTTP(w, r)
+	case http.MethodGet:
+		h.handleFilterEvents(w, r)
+	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
 	}
+}
 
+func (h *HTTPTransport) handleEvents(w http.ResponseWriter, r *http.Request) {
 	h.mu.RLock()
 	handler := h.handler
 	h.mu.RUnlock()
@@ -93,39 +171,417 @@ func (h *HTTPTransport) handleEvents(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Event handler not configured", http.StatusInternalServerError)
 		return
 	}
+	handler = countEvents("http", handler)
 
-	var event models.Event
-	event.RequestID = uuid.New().String()
-	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+	body, err := readBody(r, httpMaxBodyBytes)
+	if err != nil {
+		logger.Warn("Failed to read events", zap.Error(err))
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	events, batch, err := decodeEvents(body)
+	if err != nil {
 		logger.Warn("Failed to parse event", zap.Error(err))
 		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
 		return
 	}
-	defer r.Body.Close()
 
-	if err := handler(event); err != nil {
-		logger.Error("Failed to process event", zap.Error(err))
-		http.Error(w, "Failed to process event", http.StatusInternalServerError)
+	traceparent := r.Header.Get(TraceparentHeader)
+	remoteAddr := remoteHost(r.RemoteAddr)
+
+	var accepted, rejected int
+	var failures []batchError
+	for i, event := range events {
+		if event.RequestID == "" {
+			event.RequestID = uuid.New().String()
+		}
+		applyTraceparent(&event, traceparent)
+		event.Source = "http"
+		event.RemoteAddr = remoteAddr
+
+		if err := handler(event); err != nil {
+			logger.Error("Failed to process event", zap.Error(err))
+			rejected++
+			failures = append(failures, batchError{Index: i, Error: err.Error()})
+			continue
+		}
+		accepted++
+	}
+
+	if !batch {
+		if rejected > 0 {
+			http.Error(w, "Failed to process event", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"status":"accepted"}`))
 		return
 	}
 
-	w.WriteHeader(http.StatusAccepted)
-	w.Write([]byte(`{"status":"accepted"}`))
+	// Accepted events are already written, so a batch with some of them is
+	// answered with the index of every rejected event, which clients resend
+	// alone. Only batches without any accepted event are failed as a whole.
+	status, code := "accepted", http.StatusAccepted
+	switch {
+	case rejected == 0:
+	case accepted == 0:
+		status, code = "failed", http.StatusInternalServerError
+	default:
+		status, code = "partial", http.StatusMultiStatus
+	}
+	writeJSON(w, code, batchResponse{Status: status, Accepted: accepted, Rejected: rejected, Errors: failures})
+}
+
+// batchResponse answers a batch of events.
+type batchResponse struct {
+	Status   string       `json:"status"`
+	Accepted int          `json:"accepted"`
+	Rejected int          `json:"rejected"`
+	Errors   []batchError `json:"errors,omitempty"`
+}
+
+// batchError reports an event of a batch that was rejected.
+type batchError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+// decodeEvents decodes a single JSON event, a JSON array of events, or
+// newline delimited events, and reports whether the body held a batch.
+func decodeEvents(body []byte) ([]models.Event, bool, error) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return nil, false, errors.New("empty body")
+	}
+
+	if trimmed[0] == '[' {
+		var events []models.Event
+		if err := json.Unmarshal(trimmed, &events); err != nil {
+			return nil, true, err
+		}
+		return events, true, nil
+	}
+
+	var events []models.Event
+	decoder := json.NewDecoder(bytes.NewReader(trimmed))
+	for {
+		var event models.Event
+		err := decoder.Decode(&event)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, len(events) > 0, fmt.Errorf("event %d: %w", len(events), err)
+		}
+		events = append(events, event)
+	}
+	return events, len(events) > 1, nil
 }
 
 func (h *HTTPTransport) handleFilterEvents(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	query := r.URL.Query()
+	opts, err := parseQueryOptions(query)
+	if err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	opts := models.QueryOptions{}
+	if isDryRun(query) {
+		h.handleEstimate(w, r.Context(), opts)
+		return
+	}
 
+	conn, err := h.queryConn()
+	if err != nil {
+		logger.Error("Failed to connect to ClickHouse", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	events, err := storage.QueryEvents(r.Context(), conn, opts)
+	if err != nil {
+		queryFailed(w, err, "Failed to query events")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(events); err != nil {
+		logger.Error("Failed to encode response", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *HTTPTransport) handleTrace(w http.ResponseWriter, r *http.Request) {
+	traceID := strings.ToLower(r.PathValue("trace_id"))
+	if !models.IsTraceID(traceID) {
+		http.Error(w, "Bad request: invalid trace id", http.StatusBadRequest)
+		return
+	}
+
+	// Only the time range of the query string applies to a trace.
+	opts, err := parseQueryOptions(r.URL.Query())
+	if err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts = models.QueryOptions{TraceID: traceID, StartTime: opts.StartTime, EndTime: opts.EndTime}
+
+	conn, err := h.queryConn()
+	if err != nil {
+		logger.Error("Failed to connect to ClickHouse", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	events, err := storage.QueryTrace(r.Context(), conn, opts)
+	if err != nil {
+		queryFailed(w, err, "Failed to query trace")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(events); err != nil {
+		logger.Error("Failed to encode response", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleHistogram counts the events matching the query filters over time. The
+// estimated counts extrapolate sampled events to the volume actually logged.
+func (h *HTTPTransport) handleHistogram(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query()
+	opts, err := parseQueryOptions(query)
+	if err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if opts.EndTime == 0 {
+		opts.EndTime = uint64(time.Now().UnixMilli())
+	}
+	if opts.StartTime == 0 {
+		opts.StartTime = opts.EndTime - uint64(defaultHistogramRange.Milliseconds())
+	}
+	if opts.StartTime >= opts.EndTime {
+		http.Error(w, "Bad request: start_time must be before end_time", http.StatusBadRequest)
+		return
+	}
+
+	spanMs := opts.EndTime - opts.StartTime
+	interval := histogramInterval(spanMs)
+	if v := query.Get("interval"); v != "" {
+		interval, err = time.ParseDuration(v)
+		if err != nil || interval < time.Millisecond {
+			http.Error(w, "Bad request: invalid interval", http.StatusBadRequest)
+			return
+		}
+		if histogramBuckets(spanMs, interval) > maxHistogramBuckets {
+			http.Error(w, fmt.Sprintf("Bad request: interval must split the time range into at most %d buckets", maxHistogramBuckets), http.StatusBadRequest)
+			return
+		}
+	}
+
+	conn, err := h.queryConn()
+	if err != nil {
+		logger.Error("Failed to connect to ClickHouse", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	buckets, err := storage.QueryHistogram(r.Context(), conn, opts, interval)
+	if err != nil {
+		queryFailed(w, err, "Failed to query histogram")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"start_time":  opts.StartTime,
+		"end_time":    opts.EndTime,
+		"interval_ms": interval.Milliseconds(),
+		"buckets":     buckets,
+	}); err != nil {
+		logger.Error("Failed to encode response", zap.Error(err))
+	}
+}
+
+// handleFacets returns the most frequent values of fields among the events
+// matching the query filters. Fields are given as repeated or comma separated
+// field parameters and default to service, level and host.
+func (h *HTTPTransport) handleFacets(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	opts, err := parseQueryOptions(query)
+	if err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var fields []string
+	for _, v := range query["field"] {
+		for _, field := range strings.Split(v, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			if !storage.ValidFacetField(field) {
+				http.Error(w, fmt.Sprintf("Bad request: unknown facet field %q", field), http.StatusBadRequest)
+				return
+			}
+			fields = append(fields, field)
+		}
+	}
+	if len(fields) == 0 {
+		fields = defaultFacetFields
+	}
+
+	limit := defaultFacetLimit
+	if v := query.Get("limit"); v != "" {
+		if _, err := fmt.Sscanf(v, "%d", &limit); err != nil || limit <= 0 || limit > maxFacetLimit {
+			http.Error(w, fmt.Sprintf("Bad request: limit must be between 1 and %d", maxFacetLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	conn, err := h.queryConn()
+	if err != nil {
+		logger.Error("Failed to connect to ClickHouse", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	facets := make(map[string][]models.FacetValue, len(fields))
+	for _, field := range fields {
+		if _, ok := facets[field]; ok {
+			continue
+		}
+		values, err := storage.QueryFacets(r.Context(), conn, opts, field, limit)
+		if err != nil {
+			queryFailed(w, err, "Failed to query facets")
+			return
+		}
+		facets[field] = values
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"facets": facets,
+	}); err != nil {
+		logger.Error("Failed to encode response", zap.Error(err))
+	}
+}
+
+// handleEstimate responds with the rows ClickHouse estimates reading for the
+// events matching opts, instead of running the query.
+func (h *HTTPTransport) handleEstimate(w http.ResponseWriter, ctx context.Context, opts models.QueryOptions) {
+	conn, err := h.queryConn()
+	if err != nil {
+		logger.Error("Failed to connect to ClickHouse", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	estimate, err := storage.EstimateEvents(ctx, conn, opts)
+	if err != nil {
+		queryFailed(w, err, "Failed to estimate query")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(estimate); err != nil {
+		logger.Error("Failed to encode response", zap.Error(err))
+	}
+}
+
+// queryFailed responds to a failed query. Queries rejected or stopped by the
+// query limits are answered as bad requests, with the reason.
+func queryFailed(w http.ResponseWriter, err error, message string) {
+	var limitErr *storage.LimitError
+	if errors.As(err, &limitErr) {
+		logger.Warn("Query exceeds limits", zap.Error(err))
+		http.Error(w, "Bad request: "+limitErr.Error(), http.StatusBadRequest)
+		return
+	}
+	logger.Error(message, zap.Error(err))
+	http.Error(w, message, http.StatusInternalServerError)
+}
+
+// isDryRun reports whether the query string asks for the estimate of a query
+// instead of its results.
+func isDryRun(query url.Values) bool {
+	dryRun, _ := strconv.ParseBool(query.Get("dry_run"))
+	return dryRun
+}
+
+// histogramInterval picks the smallest of a fixed set of intervals that splits
+// a time range of spanMs milliseconds into at most maxHistogramBuckets buckets.
+func histogramInterval(spanMs uint64) time.Duration {
+	for _, interval := range histogramIntervals {
+		if histogramBuckets(spanMs, interval) <= maxHistogramBuckets {
+			return interval
+		}
+	}
+	return histogramIntervals[len(histogramIntervals)-1]
+}
+
+// histogramBuckets returns the number of buckets of interval covering a time
+// range of spanMs milliseconds, counting a partial last bucket.
+func histogramBuckets(spanMs uint64, interval time.Duration) uint64 {
+	intervalMs := uint64(interval.Milliseconds())
+	buckets := spanMs / intervalMs
+	if spanMs%intervalMs != 0 {
+		buckets++
+	}
+	return buckets
+}
+
+// queryConn returns the ClickHouse connection used for queries, opening it on
+// first use.
+func (h *HTTPTransport) queryConn() (clickhouse.Conn, error) {
+	h.connMu.Lock()
+	defer h.connMu.Unlock()
+
+	if h.conn != nil {
+		return h.conn, nil
+	}
+
+	conn, err := storage.Connect(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	h.conn = conn
+	return conn, nil
+}
+
+// CheckClickHouse reports whether ClickHouse, which serves the query
+// endpoints, answers pings.
+func (h *HTTPTransport) CheckClickHouse(ctx context.Context) error {
+	conn, err := h.queryConn()
+	if err != nil {
+		return err
+	}
+	return conn.Ping(ctx)
+}
+
+// parseQueryOptions reads the event filters, sorting and paging from the query
+// string.
+func parseQueryOptions(query url.Values) (models.QueryOptions, error) {
+	opts := models.QueryOptions{}
+
+	level, op, err := parseLevelFilter(query)
+	if err != nil {
+		return opts, err
+	}
+
 	opts.Service = query.Get("service")
-	opts.Level = query.Get("level")
+	opts.Level = level
+	opts.LevelOp = op
 	opts.Host = query.Get("host")
 	opts.RequestID = query.Get("request_id")
+	opts.TraceID = query.Get("trace_id")
 	opts.SearchQuery = query.Get("search")
 	opts.SortOrder = query.Get("sort_order")
 
@@ -161,24 +617,37 @@ func (h *HTTPTransport) handleFilterEvents(w http.ResponseWriter, r *http.Reques
 		}
 	}
 
-	conn, err := storage.Connect(context.Background())
-	if err != nil {
-		logger.Error("Failed to connect to ClickHouse", zap.Error(err))
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+	return opts, nil
+}
+
+// parseLevelFilter reads the level filter from the query string. Thresholds can
+// be given in the value (level=>=WARN) or, as happens when a client writes
+// level>=WARN literally, in the key (level>=WARN parses as "level>" = "WARN").
+func parseLevelFilter(query url.Values) (string, string, error) {
+	var level, op string
+	switch {
+	case query.Get("level>") != "":
+		level, op = query.Get("level>"), ">="
+	case query.Get("level<") != "":
+		level, op = query.Get("level<"), "<="
+	default:
+		level = query.Get("level")
+		for _, prefix := range []string{">=", "<=", ">", "<", "="} {
+			if strings.HasPrefix(level, prefix) {
+				level, op = level[len(prefix):], prefix
+				break
+			}
+		}
 	}
 
-	events, err := storage.QueryEvents(r.Context(), conn, opts)
-	if err != nil {
-		logger.Error("Failed to query events", zap.Error(err))
-		http.Error(w, "Failed to query events", http.StatusInternalServerError)
-		return
+	if level == "" {
+		return "", "", nil
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(events); err != nil {
-		logger.Error("Failed to encode response", zap.Error(err))
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+	canonical, ok := models.ParseLevel(level)
+	if !ok {
+		return "", "", fmt.Errorf("unknown level %q", level)
 	}
+
+	return canonical, op, nil
 }
@@ -0,0 +1,136 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mohammadhptp/pulse/pkg/models"
+)
+
+func TestHistogramInterval(t *testing.T) {
+	tests := []struct {
+		span time.Duration
+		want time.Duration
+	}{
+		{time.Minute, time.Second},
+		{2 * time.Minute, time.Second},
+		{2*time.Minute + time.Millisecond, 5 * time.Second},
+		{time.Hour, 30 * time.Second},
+		{24 * time.Hour, 30 * time.Minute},
+		{31 * 24 * time.Hour, 12 * time.Hour},
+		{10 * 365 * 24 * time.Hour, 7 * 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := histogramInterval(uint64(tt.span.Milliseconds())); got != tt.want {
+			t.Errorf("histogramInterval(%s) = %s, want %s", tt.span, got, tt.want)
+		}
+	}
+}
+
+func TestHistogramBuckets(t *testing.T) {
+	tests := []struct {
+		spanMs   uint64
+		interval time.Duration
+		want     uint64
+	}{
+		{0, time.Second, 0},
+		{1000, time.Second, 1},
+		{1001, time.Second, 2},
+		{3600000, time.Minute, 60},
+		{1<<64 - 1, time.Millisecond, 1<<64 - 1},
+		{1<<64 - 1, time.Second, 1<<64/1000 + 1},
+	}
+	for _, tt := range tests {
+		if got := histogramBuckets(tt.spanMs, tt.interval); got != tt.want {
+			t.Errorf("histogramBuckets(%d, %s) = %d, want %d", tt.spanMs, tt.interval, got, tt.want)
+		}
+	}
+}
+
+func TestHandleHistogramRejectsInvalidInterval(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"unparsable", "interval=soon"},
+		{"below a millisecond", "interval=1us"},
+		{"too many buckets", "start_time=0&end_time=3600000&interval=1s"},
+		{"too many buckets by default range", "interval=1ms"},
+		{"start after end", "start_time=2000&end_time=1000"},
+	}
+	h := NewHTTPTransport(0, "")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.handleHistogram(w, httptest.NewRequest(http.MethodGet, "/events/histogram?"+tt.query, nil))
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body)
+			}
+		})
+	}
+}
+
+func TestHandleEventsBatchResults(t *testing.T) {
+	failure := errors.New("kafka unavailable")
+	tests := []struct {
+		name     string
+		body     string
+		fail     map[string]bool
+		code     int
+		response batchResponse
+	}{
+		{
+			name:     "accepted",
+			body:     `[{"message":"a"},{"message":"b"}]`,
+			code:     http.StatusAccepted,
+			response: batchResponse{Status: "accepted", Accepted: 2},
+		},
+		{
+			name: "partial",
+			body: "{\"message\":\"a\"}\n{\"message\":\"b\"}\n{\"message\":\"c\"}",
+			fail: map[string]bool{"b": true},
+			code: http.StatusMultiStatus,
+			response: batchResponse{Status: "partial", Accepted: 2, Rejected: 1,
+				Errors: []batchError{{Index: 1, Error: failure.Error()}}},
+		},
+		{
+			name: "failed",
+			body: `[{"message":"a"},{"message":"b"}]`,
+			fail: map[string]bool{"a": true, "b": true},
+			code: http.StatusInternalServerError,
+			response: batchResponse{Status: "failed", Rejected: 2,
+				Errors: []batchError{{Index: 0, Error: failure.Error()}, {Index: 1, Error: failure.Error()}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHTTPTransport(0, "")
+			h.SetEventHandler(func(e models.Event) error {
+				if tt.fail[e.Message] {
+					return failure
+				}
+				return nil
+			})
+
+			w := httptest.NewRecorder()
+			h.handleEvents(w, httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(tt.body)))
+			if w.Code != tt.code {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.code, w.Body)
+			}
+
+			var response batchResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(response, tt.response) {
+				t.Errorf("response = %+v, want %+v", response, tt.response)
+			}
+		})
+	}
+}
@@ -0,0 +1,479 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/google/uuid"
+	"github.com/mohammadhptp/pulse/internal/storage"
+	"github.com/mohammadhptp/pulse/pkg/logger"
+	"github.com/mohammadhptp/pulse/pkg/models"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultJobResultTTL is how long the result of a finished query job is
+	// kept when no TTL is configured.
+	DefaultJobResultTTL = 10 * time.Minute
+
+	// DefaultMaxJobRows caps the rows of a query job result when no cap is
+	// configured.
+	DefaultMaxJobRows = 100000
+
+	// maxRunningJobs caps the query jobs running at once, and maxCachedJobs
+	// and maxCachedRows the finished jobs whose results are kept and their
+	// rows. The oldest results are dropped first, except for the newest one,
+	// so at most maxCachedRows rows plus those of one running job each are
+	// held in memory.
+	maxRunningJobs = 4
+	maxCachedJobs  = 32
+	maxCachedRows  = 1000000
+
+	// killQueryTimeout bounds the KILL QUERY sent for a cancelled job.
+	killQueryTimeout = 5 * time.Second
+)
+
+var errTooManyJobs = errors.New("too many running query jobs")
+
+// queryJob is a query running in the background, or its finished result.
+type queryJob struct {
+	id      string
+	key     string
+	options models.QueryOptions
+	created time.Time
+	cancel  context.CancelFunc
+
+	rows      atomic.Int64
+	rowsRead  atomic.Uint64
+	bytesRead atomic.Uint64
+	totalRows atomic.Uint64
+
+	mu        sync.Mutex
+	status    string
+	finished  time.Time
+	expires   time.Time
+	events    []models.Event
+	estimated int64
+	truncated bool
+	err       string
+}
+
+// jobStore keeps the query jobs of a transport. A query submitted while an
+// identical one runs or has its result cached shares that job.
+type jobStore struct {
+	ttl     time.Duration
+	maxRows int
+
+	mu       sync.Mutex
+	jobs     map[string]*queryJob
+	byKey    map[string]*queryJob
+	finished []*queryJob
+	running  int
+}
+
+func newJobStore() *jobStore {
+	return &jobStore{
+		ttl:     DefaultJobResultTTL,
+		maxRows: DefaultMaxJobRows,
+		jobs:    make(map[string]*queryJob),
+		byKey:   make(map[string]*queryJob),
+	}
+}
+
+// SetJobResultTTL sets how long the results of finished query jobs are kept.
+// It must be called before Start.
+func (h *HTTPTransport) SetJobResultTTL(ttl time.Duration) {
+	if ttl > 0 {
+		h.jobs.ttl = ttl
+	}
+}
+
+// SetMaxJobRows caps the rows of a query job result. It must be called before
+// Start.
+func (h *HTTPTransport) SetMaxJobRows(rows int) {
+	if rows > 0 {
+		h.jobs.maxRows = rows
+	}
+}
+
+// submit starts a job for the filters and sort order of options, or returns
+// the running or finished job of an identical query. It reports whether the
+// job was started.
+func (s *jobStore) submit(conn clickhouse.Conn, options models.QueryOptions) (*queryJob, bool, error) {
+	key, err := json.Marshal(options)
+	if err != nil {
+		return nil, false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if job, ok := s.byKey[string(key)]; ok {
+		return job, false, nil
+	}
+	if s.running >= maxRunningJobs {
+		return nil, false, errTooManyJobs
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &queryJob{
+		id:      uuid.New().String(),
+		key:     string(key),
+		options: options,
+		created: time.Now(),
+		cancel:  cancel,
+		status:  models.JobRunning,
+	}
+	s.jobs[job.id] = job
+	s.byKey[job.key] = job
+	s.running++
+
+	go s.run(ctx, conn, job)
+	return job, true, nil
+}
+
+// run runs the query of a job. The job ID is used as the ClickHouse query ID,
+// so that a cancelled job can be killed on the server.
+func (s *jobStore) run(ctx context.Context, conn clickhouse.Conn, job *queryJob) {
+	ctx = clickhouse.Context(storage.LongRunning(ctx),
+		clickhouse.WithQueryID(job.id),
+		clickhouse.WithProgress(func(p *clickhouse.Progress) {
+			// Progress is reported as increments.
+			job.rowsRead.Add(p.Rows)
+			job.bytesRead.Add(p.Bytes)
+			job.totalRows.Add(p.TotalRows)
+		}))
+
+	// One row past the cap tells whether the result was truncated.
+	var events []models.Event
+	_, err := storage.StreamEvents(ctx, conn, job.options, s.maxRows+1, func(e models.Event) error {
+		events = append(events, e)
+		job.rows.Add(1)
+		return nil
+	})
+
+	if ctx.Err() != nil {
+		s.mu.Lock()
+		s.running--
+		s.mu.Unlock()
+		logger.Debug("Query job cancelled", zap.String("job_id", job.id))
+		return
+	}
+
+	truncated := len(events) > s.maxRows
+	if truncated {
+		events = events[:s.maxRows]
+	}
+	var estimated int64
+	for _, e := range events {
+		estimated += int64(e.SampleRate) * int64(e.RepeatCount)
+	}
+
+	status := models.JobDone
+	message := ""
+	if err != nil {
+		logger.Error("Query job failed", zap.Error(err), zap.String("job_id", job.id))
+		status, message, events, estimated = models.JobFailed, "Failed to query events", nil, 0
+
+		var limitErr *storage.LimitError
+		if errors.As(err, &limitErr) {
+			message = limitErr.Error()
+		}
+	}
+
+	now := time.Now()
+	job.mu.Lock()
+	job.status = status
+	job.finished = now
+	job.expires = now.Add(s.ttl)
+	job.events = events
+	job.estimated = estimated
+	job.truncated = truncated && err == nil
+	job.err = message
+	job.mu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running--
+	if s.jobs[job.id] != job {
+		return
+	}
+	if status != models.JobDone {
+		delete(s.byKey, job.key)
+	}
+	s.finished = append(s.finished, job)
+	s.evict()
+	time.AfterFunc(s.ttl, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.remove(job)
+	})
+
+	logger.Debug("Query job finished",
+		zap.String("job_id", job.id),
+		zap.String("status", status),
+		zap.Int("rows", len(events)),
+		zap.Duration("took", now.Sub(job.created)))
+}
+
+func (s *jobStore) get(id string) *queryJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jobs[id]
+}
+
+// delete cancels a job and drops it with its result. It reports whether the
+// job was still running.
+func (s *jobStore) delete(job *queryJob) bool {
+	s.mu.Lock()
+	s.remove(job)
+	s.mu.Unlock()
+
+	job.cancel()
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	return job.status == models.JobRunning
+}
+
+// remove drops a job from the store. s.mu must be held.
+func (s *jobStore) remove(job *queryJob) {
+	if s.jobs[job.id] != job {
+		return
+	}
+	delete(s.jobs, job.id)
+	if s.byKey[job.key] == job {
+		delete(s.byKey, job.key)
+	}
+	for i, finished := range s.finished {
+		if finished == job {
+			s.finished = append(s.finished[:i], s.finished[i+1:]...)
+			break
+		}
+	}
+}
+
+// evict drops the oldest finished jobs beyond maxCachedJobs or maxCachedRows,
+// keeping the newest one. s.mu must be held.
+func (s *jobStore) evict() {
+	for len(s.finished) > maxCachedJobs || len(s.finished) > 1 && s.cachedRows() > maxCachedRows {
+		s.remove(s.finished[0])
+	}
+}
+
+// cachedRows returns the rows of the finished jobs. s.mu must be held.
+func (s *jobStore) cachedRows() int {
+	var rows int
+	for _, job := range s.finished {
+		// The result of a finished job no longer changes.
+		rows += len(job.events)
+	}
+	return rows
+}
+
+// stop cancels the running jobs and drops every job.
+func (s *jobStore) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, job := range s.jobs {
+		job.cancel()
+	}
+	s.jobs = make(map[string]*queryJob)
+	s.byKey = make(map[string]*queryJob)
+	s.finished = nil
+}
+
+// snapshot reports the state of the job.
+func (j *queryJob) snapshot() models.QueryJob {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	end := j.finished
+	if end.IsZero() {
+		end = time.Now()
+	}
+	job := models.QueryJob{
+		ID:     j.id,
+		Status: j.status,
+		Query:  j.options,
+		Progress: models.QueryProgress{
+			RowsRead:        j.rowsRead.Load(),
+			BytesRead:       j.bytesRead.Load(),
+			TotalRowsToRead: j.totalRows.Load(),
+		},
+		Rows:        int(j.rows.Load()),
+		Truncated:   j.truncated,
+		Error:       j.err,
+		ElapsedMs:   end.Sub(j.created).Milliseconds(),
+		CreatedAtMs: j.created.UnixMilli(),
+	}
+	if !j.finished.IsZero() {
+		job.Rows = len(j.events)
+		job.FinishedAtMs = j.finished.UnixMilli()
+		job.ExpiresAtMs = j.expires.UnixMilli()
+	}
+	return job
+}
+
+// page returns a page of the result of a finished job, paginated as the query
+// API. From and To are zero for pages past the end. It returns false when the
+// job has no result.
+func (j *queryJob) page(page, perPage int) (*models.PaginatedResponse, string, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.status != models.JobDone {
+		return nil, j.status, false
+	}
+
+	total := len(j.events)
+	offset := min((page-1)*perPage, total)
+	end := min(offset+perPage, total)
+
+	response := &models.PaginatedResponse{
+		Data:           j.events[offset:end],
+		Total:          int64(total),
+		EstimatedTotal: j.estimated,
+		PerPage:        perPage,
+		CurrentPage:    page,
+		LastPage:       (total + perPage - 1) / perPage,
+	}
+	if offset < end {
+		response.From, response.To = offset+1, end
+	}
+	return response, j.status, true
+}
+
+// handleSubmitJob starts a query job for the filters of the query string or
+// form body, which are those of the query API.
+func (h *HTTPTransport) handleSubmitJob(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts, err := parseQueryOptions(r.Form)
+	if err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if isDryRun(r.Form) {
+		h.handleEstimate(w, storage.LongRunning(r.Context()), opts)
+		return
+	}
+
+	// Jobs are not paginated, their results are. The time range is resolved
+	// on submission, so that a job covers the events up to then.
+	opts.Page, opts.PerPage = 0, 0
+	opts, err = storage.ApplyLimits(opts, time.Now())
+	if err != nil {
+		queryFailed(w, err, "Failed to submit query job")
+		return
+	}
+
+	conn, err := h.queryConn()
+	if err != nil {
+		logger.Error("Failed to connect to ClickHouse", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	job, started, err := h.jobs.submit(conn, opts)
+	if errors.Is(err, errTooManyJobs) {
+		http.Error(w, "Too many running query jobs", http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to submit query job", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	code := http.StatusOK
+	if started {
+		code = http.StatusAccepted
+		w.Header().Set("Location", h.endpoint+"/jobs/"+job.id)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(job.snapshot()); err != nil {
+		logger.Error("Failed to encode response", zap.Error(err))
+	}
+}
+
+// handleJob reports the status and progress of a query job.
+func (h *HTTPTransport) handleJob(w http.ResponseWriter, r *http.Request) {
+	job := h.jobs.get(r.PathValue("id"))
+	if job == nil {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(job.snapshot()); err != nil {
+		logger.Error("Failed to encode response", zap.Error(err))
+	}
+}
+
+// handleJobResults returns a page of the result of a finished query job, with
+// the page and per_page parameters of the query API.
+func (h *HTTPTransport) handleJobResults(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseQueryOptions(r.URL.Query())
+	if err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := storage.CheckPageSize(opts.PerPage); err != nil {
+		queryFailed(w, err, "Failed to page job results")
+		return
+	}
+
+	job := h.jobs.get(r.PathValue("id"))
+	if job == nil {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	response, status, ok := job.page(opts.Page, opts.PerPage)
+	if !ok {
+		http.Error(w, "Job is "+status, http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Error("Failed to encode response", zap.Error(err))
+	}
+}
+
+// handleCancelJob cancels a query job, killing its query on the ClickHouse
+// server, and drops its result.
+func (h *HTTPTransport) handleCancelJob(w http.ResponseWriter, r *http.Request) {
+	job := h.jobs.get(r.PathValue("id"))
+	if job == nil {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	// The job is dropped even when the kill fails, as cancelling its context
+	// already closed the connection running the query.
+	if h.jobs.delete(job) {
+		conn, err := h.queryConn()
+		if err != nil {
+			logger.Error("Failed to connect to ClickHouse", zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), killQueryTimeout)
+		defer cancel()
+		storage.KillQuery(ctx, conn, job.id)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,120 @@
+package transport
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mohammadhptp/pulse/internal/storage"
+	"github.com/mohammadhptp/pulse/pkg/models"
+)
+
+func doneJob(id string, rows int) *queryJob {
+	return &queryJob{id: id, key: id, status: models.JobDone, events: make([]models.Event, rows)}
+}
+
+func TestQueryJobPage(t *testing.T) {
+	tests := []struct {
+		name     string
+		rows     int
+		page     int
+		perPage  int
+		data     int
+		from, to int
+		lastPage int
+	}{
+		{"first page", 25, 1, 10, 10, 1, 10, 3},
+		{"last partial page", 25, 3, 10, 5, 21, 25, 3},
+		{"past the end", 25, 4, 10, 0, 0, 0, 3},
+		{"far past the end", 25, 1000, 10, 0, 0, 0, 3},
+		{"empty result", 0, 1, 10, 0, 0, 0, 0},
+		{"exact pages", 20, 2, 10, 10, 11, 20, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, _, ok := doneJob("job", tt.rows).page(tt.page, tt.perPage)
+			if !ok {
+				t.Fatal("page() reported no result")
+			}
+			if len(response.Data) != tt.data || response.From != tt.from || response.To != tt.to || response.LastPage != tt.lastPage {
+				t.Errorf("page(%d, %d) = %d events, from %d to %d of %d pages; want %d events, from %d to %d of %d pages",
+					tt.page, tt.perPage, len(response.Data), response.From, response.To, response.LastPage,
+					tt.data, tt.from, tt.to, tt.lastPage)
+			}
+		})
+	}
+
+	running := &queryJob{status: models.JobRunning}
+	if _, status, ok := running.page(1, 10); ok || status != models.JobRunning {
+		t.Errorf("page() of a running job = %s, %v", status, ok)
+	}
+}
+
+func TestJobStoreEvict(t *testing.T) {
+	tests := []struct {
+		name string
+		rows []int
+		kept []string
+	}{
+		{"within limits", []int{10, 20}, []string{"job-0", "job-1"}},
+		{"too many jobs", make([]int, maxCachedJobs+2), nil},
+		{"too many rows", []int{maxCachedRows / 2, maxCachedRows / 2, 1}, []string{"job-1", "job-2"}},
+		{"newest job kept", []int{10, maxCachedRows + 1}, []string{"job-1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newJobStore()
+			for i, rows := range tt.rows {
+				job := doneJob(fmt.Sprintf("job-%d", i), rows)
+				s.jobs[job.id] = job
+				s.byKey[job.key] = job
+				s.finished = append(s.finished, job)
+				s.evict()
+			}
+
+			if tt.kept == nil {
+				if len(s.finished) != maxCachedJobs {
+					t.Errorf("%d jobs kept, want %d", len(s.finished), maxCachedJobs)
+				}
+				return
+			}
+			var kept []string
+			for _, job := range s.finished {
+				kept = append(kept, job.id)
+			}
+			if fmt.Sprint(kept) != fmt.Sprint(tt.kept) {
+				t.Errorf("kept %v, want %v", kept, tt.kept)
+			}
+			if len(s.jobs) != len(tt.kept) || len(s.byKey) != len(tt.kept) {
+				t.Errorf("store holds %d jobs and %d keys, want %d", len(s.jobs), len(s.byKey), len(tt.kept))
+			}
+		})
+	}
+}
+
+func TestHandleJobResultsPerPage(t *testing.T) {
+	h := NewHTTPTransport(0, "")
+	job := doneJob("job", 5)
+	h.jobs.jobs[job.id] = job
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /events/jobs/{id}/results", h.handleJobResults)
+
+	tests := []struct {
+		query string
+		code  int
+	}{
+		{"per_page=100", http.StatusOK},
+		{fmt.Sprintf("per_page=%d", storage.DefaultMaxPerPage), http.StatusOK},
+		{fmt.Sprintf("per_page=%d", storage.DefaultMaxPerPage+1), http.StatusBadRequest},
+		{"page=9", http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/events/jobs/job/results?"+tt.query, nil))
+		if w.Code != tt.code {
+			t.Errorf("%s: status = %d, want %d: %s", tt.query, w.Code, tt.code, w.Body)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/mohammadhptp/pulse/pkg/logger"
+	"github.com/mohammadhptp/pulse/pkg/metrics"
+	"github.com/mohammadhptp/pulse/pkg/models"
+	"github.com/mohammadhptp/pulse/pkg/pb/lokipb"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// LokiPushPath is the path Loki clients push log streams to.
+	LokiPushPath = "/loki/api/v1/push"
+
+	lokiMaxBodyBytes = 16 << 20
+)
+
+var (
+	// DefaultLokiServiceLabels are the stream labels checked, in order, for the
+	// event service.
+	DefaultLokiServiceLabels = []string{"service_name", "service", "app", "application", "job", "container"}
+	// DefaultLokiHostLabels are the stream labels checked, in order, for the
+	// event host.
+	DefaultLokiHostLabels = []string{"host", "hostname", "node_name", "nodename", "instance"}
+
+	lokiLevelLabels = []string{"level", "detected_level", "severity", "lvl"}
+)
+
+// LokiTransport accepts the Loki push API so that Promtail, Grafana Agent and
+// other Loki clients can ship to Pulse unchanged.
+type LokiTransport struct {
+	handlerRef
+	server        *http.Server
+	port          int
+	serviceLabels []string
+	hostLabels    []string
+}
+
+// NewLokiTransport creates a Loki push transport listening on port. Empty label
+// lists fall back to DefaultLokiServiceLabels and DefaultLokiHostLabels.
+func NewLokiTransport(port int, serviceLabels, hostLabels []string) *LokiTransport {
+	if len(serviceLabels) == 0 {
+		serviceLabels = DefaultLokiServiceLabels
+	}
+	if len(hostLabels) == 0 {
+		hostLabels = DefaultLokiHostLabels
+	}
+
+	return &LokiTransport{
+		handlerRef:    handlerRef{source: "loki"},
+		port:          port,
+		serviceLabels: serviceLabels,
+		hostLabels:    hostLabels,
+	}
+}
+
+func (l *LokiTransport) Start(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc(LokiPushPath, l.handlePush)
+
+	l.server = serveHTTP(ctx, "Loki", fmt.Sprintf(":%d", l.port), metrics.InstrumentHandler("loki", mux))
+	return nil
+}
+
+func (l *LokiTransport) Stop() error {
+	return shutdownHTTP("Loki", l.server)
+}
+
+func (l *LokiTransport) Close() error {
+	return l.Stop()
+}
+
+// lokiStream is a stream decoded from either push encoding.
+type lokiStream struct {
+	labels  map[string]string
+	entries []lokiEntry
+}
+
+type lokiEntry struct {
+	timestamp time.Time
+	line      string
+	metadata  map[string]string
+}
+
+func (l *LokiTransport) handlePush(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	handler := withRemoteAddr(l.eventHandler(), r.RemoteAddr)
+	if handler == nil {
+		http.Error(w, "Event handler not configured", http.StatusInternalServerError)
+		return
+	}
+
+	body, err := readBody(r, lokiMaxBodyBytes)
+	if err != nil {
+		logger.Warn("Failed to read Loki push request", zap.Error(err))
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var streams []lokiStream
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch contentType {
+	case contentTypeJSON:
+		streams, err = decodeLokiJSON(body)
+	case "", contentTypeProtobuf:
+		streams, err = decodeLokiProtobuf(body)
+	default:
+		http.Error(w, "Unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		logger.Warn("Failed to parse Loki push request", zap.Error(err))
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Loki has no way to report a partial success, so a failed entry fails
+	// the request and the client resends the entries already written.
+	for _, stream := range streams {
+		for _, entry := range stream.entries {
+			if err := handler(l.event(stream.labels, entry)); err != nil {
+				logger.Error("Failed to process Loki entry", zap.Error(err))
+				http.Error(w, "Failed to process entries", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// event maps a Loki entry onto an Event. Configured labels provide the service
+// and host; every other label and the structured metadata become attributes.
+func (l *LokiTransport) event(labels map[string]string, entry lokiEntry) models.Event {
+	event := models.Event{
+		EventTimeMs: uint64(entry.timestamp.UnixMilli()),
+		Message:     entry.line,
+		Attributes:  make(map[string]string, len(labels)+len(entry.metadata)),
+	}
+
+	serviceLabel := firstLabel(labels, l.serviceLabels)
+	hostLabel := firstLabel(labels, l.hostLabels)
+	event.Service = labels[serviceLabel]
+	event.Host = labels[hostLabel]
+
+	for name, value := range labels {
+		if name != serviceLabel && name != hostLabel {
+			event.Attributes[name] = value
+		}
+	}
+	for name, value := range entry.metadata {
+		event.Attributes[name] = value
+	}
+
+	if levelLabel := firstLabel(event.Attributes, lokiLevelLabels); levelLabel != "" {
+		event.Level = event.Attributes[levelLabel]
+	}
+	if traceID := strings.ToLower(event.Attributes["trace_id"]); models.IsTraceID(traceID) {
+		event.TraceID = traceID
+	}
+
+	return event
+}
+
+func firstLabel(labels map[string]string, names []string) string {
+	for _, name := range names {
+		if labels[name] != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+func decodeLokiProtobuf(body []byte) ([]lokiStream, error) {
+	// The decoded length is read from the header, and decoding allocates it
+	// up front.
+	size, err := snappy.DecodedLen(body)
+	if err != nil {
+		return nil, fmt.Errorf("decompressing snappy body: %w", err)
+	}
+	if size > lokiMaxBodyBytes {
+		return nil, fmt.Errorf("decompressed body of %d bytes exceeds %d bytes", size, lokiMaxBodyBytes)
+	}
+
+	decoded, err := snappy.Decode(nil, body)
+	if err != nil {
+		return nil, fmt.Errorf("decompressing snappy body: %w", err)
+	}
+
+	request := &lokipb.PushRequest{}
+	if err := proto.Unmarshal(decoded, request); err != nil {
+		return nil, err
+	}
+
+	streams := make([]lokiStream, 0, len(request.GetStreams()))
+	for _, s := range request.GetStreams() {
+		labels, err := parseLokiLabels(s.GetLabels())
+		if err != nil {
+			return nil, err
+		}
+
+		stream := lokiStream{labels: labels}
+		for _, e := range s.GetEntries() {
+			entry := lokiEntry{
+				timestamp: e.GetTimestamp().AsTime(),
+				line:      e.GetLine(),
+			}
+			if len(e.GetStructuredMetadata()) > 0 {
+				entry.metadata = make(map[string]string, len(e.GetStructuredMetadata()))
+				for _, pair := range e.GetStructuredMetadata() {
+					entry.metadata[pair.GetName()] = pair.GetValue()
+				}
+			}
+			stream.entries = append(stream.entries, entry)
+		}
+		streams = append(streams, stream)
+	}
+
+	return streams, nil
+}
+
+// decodeLokiJSON decodes the JSON push format, where each value is a
+// [nanosecond timestamp, line] pair with optional structured metadata.
+func decodeLokiJSON(body []byte) ([]lokiStream, error) {
+	var request struct {
+		Streams []struct {
+			Stream map[string]string   `json:"stream"`
+			Values [][]json.RawMessage `json:"values"`
+		} `json:"streams"`
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	if err := decoder.Decode(&request); err != nil {
+		return nil, err
+	}
+
+	streams := make([]lokiStream, 0, len(request.Streams))
+	for _, s := range request.Streams {
+		stream := lokiStream{labels: s.Stream}
+		for _, value := range s.Values {
+			if len(value) < 2 {
+				return nil, errors.New("stream value must contain a timestamp and a line")
+			}
+
+			var ts string
+			var entry lokiEntry
+			if err := json.Unmarshal(value[0], &ts); err != nil {
+				return nil, fmt.Errorf("invalid timestamp: %w", err)
+			}
+			nanos, err := strconv.ParseInt(ts, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timestamp %q", ts)
+			}
+			entry.timestamp = time.Unix(0, nanos)
+
+			if err := json.Unmarshal(value[1], &entry.line); err != nil {
+				return nil, fmt.Errorf("invalid line: %w", err)
+			}
+			if len(value) > 2 {
+				if err := json.Unmarshal(value[2], &entry.metadata); err != nil {
+					return nil, fmt.Errorf("invalid structured metadata: %w", err)
+				}
+			}
+
+			stream.entries = append(stream.entries, entry)
+		}
+		streams = append(streams, stream)
+	}
+
+	return streams, nil
+}
+
+// parseLokiLabels parses labels in the Prometheus text format, such as
+// {job="app", host="server-1"}.
+func parseLokiLabels(s string) (map[string]string, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") {
+		return nil, fmt.Errorf("invalid stream labels %q", s)
+	}
+	s = s[1 : len(s)-1]
+
+	labels := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " ,")
+		if s == "" {
+			return labels, nil
+		}
+
+		eq := strings.Index(s, "=\"")
+		if eq <= 0 {
+			return nil, fmt.Errorf("invalid stream label near %q", s)
+		}
+		name := strings.TrimSpace(s[:eq])
+		s = s[eq+1:]
+
+		// The quoted value ends at the first unescaped quote.
+		end := 1
+		for end < len(s) && s[end] != '"' {
+			if s[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(s) {
+			return nil, fmt.Errorf("unterminated value for label %q", name)
+		}
+
+		value, err := strconv.Unquote(s[:end+1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for label %q: %w", name, err)
+		}
+		labels[name] = value
+		s = s[end+1:]
+	}
+}
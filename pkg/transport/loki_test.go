@@ -0,0 +1,48 @@
+package transport
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/mohammadhptp/pulse/pkg/pb/lokipb"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestDecodeLokiProtobufSize(t *testing.T) {
+	request, err := proto.Marshal(&lokipb.PushRequest{Streams: []*lokipb.StreamAdapter{{
+		Labels:  `{service="api"}`,
+		Entries: []*lokipb.EntryAdapter{{Line: "hello"}},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A header claiming a huge decoded length, followed by nothing.
+	header := binary.AppendUvarint(nil, 1<<30)
+
+	tests := []struct {
+		name string
+		body []byte
+		err  string
+	}{
+		{"valid", snappy.Encode(nil, request), ""},
+		{"decoded length over the limit", header, "exceeds"},
+		{"invalid header", []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, "snappy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			streams, err := decodeLokiProtobuf(tt.body)
+			if tt.err == "" {
+				if err != nil || len(streams) != 1 || len(streams[0].entries) != 1 {
+					t.Errorf("decodeLokiProtobuf() = %v, %v", streams, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("decodeLokiProtobuf() error = %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
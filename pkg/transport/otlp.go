@@ -0,0 +1,349 @@
+package transport
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mohammadhptp/pulse/pkg/logger"
+	"github.com/mohammadhptp/pulse/pkg/metrics"
+	"github.com/mohammadhptp/pulse/pkg/models"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// OTLPLogsPath is the path OpenTelemetry exporters post logs to.
+	OTLPLogsPath = "/v1/logs"
+
+	otlpMaxBodyBytes = 16 << 20
+
+	contentTypeProtobuf = "application/x-protobuf"
+	contentTypeJSON     = "application/json"
+)
+
+// OTLPTransport receives logs over OTLP/HTTP in both the protobuf and the JSON
+// encoding.
+type OTLPTransport struct {
+	handlerRef
+	server *http.Server
+	port   int
+}
+
+func NewOTLPTransport(port int) *OTLPTransport {
+	return &OTLPTransport{
+		handlerRef: handlerRef{source: "otlp"},
+		port:       port,
+	}
+}
+
+func (o *OTLPTransport) Start(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc(OTLPLogsPath, o.handleLogs)
+
+	o.server = serveHTTP(ctx, "OTLP", fmt.Sprintf(":%d", o.port), metrics.InstrumentHandler("otlp", mux))
+	return nil
+}
+
+func (o *OTLPTransport) Stop() error {
+	return shutdownHTTP("OTLP", o.server)
+}
+
+func (o *OTLPTransport) Close() error {
+	return o.Stop()
+}
+
+func (o *OTLPTransport) handleLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	handler := withRemoteAddr(o.eventHandler(), r.RemoteAddr)
+	if handler == nil {
+		http.Error(w, "Event handler not configured", http.StatusInternalServerError)
+		return
+	}
+
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if contentType != contentTypeProtobuf && contentType != contentTypeJSON {
+		http.Error(w, "Unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := readBody(r, otlpMaxBodyBytes)
+	if err != nil {
+		logger.Warn("Failed to read OTLP request", zap.Error(err))
+		http.Error(w, "Bad request: "+err.Error(), readBodyStatus(err))
+		return
+	}
+
+	request := &collogspb.ExportLogsServiceRequest{}
+	if contentType == contentTypeProtobuf {
+		err = proto.Unmarshal(body, request)
+	} else {
+		err = unmarshalOTLPJSON(body, request)
+	}
+	if err != nil {
+		logger.Warn("Failed to parse OTLP request", zap.Error(err))
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	events := otlpEvents(request)
+
+	var rejected int64
+	var lastErr error
+	for _, event := range events {
+		if err := handler(event); err != nil {
+			rejected++
+			lastErr = err
+		}
+	}
+
+	if len(events) > 0 && rejected == int64(len(events)) {
+		logger.Error("Failed to process OTLP logs", zap.Error(lastErr))
+		http.Error(w, "Failed to process logs", http.StatusServiceUnavailable)
+		return
+	}
+
+	response := &collogspb.ExportLogsServiceResponse{}
+	if rejected > 0 {
+		response.PartialSuccess = &collogspb.ExportLogsPartialSuccess{
+			RejectedLogRecords: rejected,
+			ErrorMessage:       lastErr.Error(),
+		}
+	}
+
+	var payload []byte
+	if contentType == contentTypeProtobuf {
+		payload, err = proto.Marshal(response)
+	} else {
+		payload, err = protojson.Marshal(response)
+	}
+	if err != nil {
+		logger.Error("Failed to encode OTLP response", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(payload)
+}
+
+// readBody reads a request body of at most limit bytes, decompressing it when
+// it is gzip encoded. A body over the limit, compressed or not, fails with an
+// *http.MaxBytesError.
+func readBody(r *http.Request, limit int64) ([]byte, error) {
+	defer r.Body.Close()
+
+	reader := http.MaxBytesReader(nil, r.Body, limit)
+	if r.Header.Get("Content-Encoding") != "gzip" {
+		return io.ReadAll(reader)
+	}
+
+	gz, err := gzip.NewReader(reader)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	body, err := io.ReadAll(io.LimitReader(gz, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, &http.MaxBytesError{Limit: limit}
+	}
+	return body, nil
+}
+
+// readBodyStatus returns the status answering a request whose body could not
+// be read: 413 when it is too large, and 400 otherwise.
+func readBodyStatus(err error) int {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// unmarshalOTLPJSON decodes the OTLP JSON encoding. It differs from the
+// canonical protobuf JSON mapping in that trace and span IDs are hex rather
+// than base64 encoded, so those are converted before decoding.
+func unmarshalOTLPJSON(body []byte, request *collogspb.ExportLogsServiceRequest) error {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var raw map[string]interface{}
+	if err := decoder.Decode(&raw); err != nil {
+		return err
+	}
+
+	for _, resourceLogs := range jsonObjects(raw["resourceLogs"]) {
+		for _, scopeLogs := range jsonObjects(resourceLogs["scopeLogs"]) {
+			for _, record := range jsonObjects(scopeLogs["logRecords"]) {
+				hexToBase64(record, "traceId")
+				hexToBase64(record, "spanId")
+			}
+		}
+	}
+
+	converted, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+
+	return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(converted, request)
+}
+
+func jsonObjects(v interface{}) []map[string]interface{} {
+	items, _ := v.([]interface{})
+	objects := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		if object, ok := item.(map[string]interface{}); ok {
+			objects = append(objects, object)
+		}
+	}
+	return objects
+}
+
+func hexToBase64(object map[string]interface{}, key string) {
+	value, ok := object[key].(string)
+	if !ok || value == "" {
+		return
+	}
+	if decoded, err := hex.DecodeString(value); err == nil {
+		object[key] = base64.StdEncoding.EncodeToString(decoded)
+	}
+}
+
+// otlpEvents maps every log record of an export request onto an Event.
+func otlpEvents(request *collogspb.ExportLogsServiceRequest) []models.Event {
+	var events []models.Event
+
+	for _, resourceLogs := range request.GetResourceLogs() {
+		resource := make(map[string]string)
+		for _, kv := range resourceLogs.GetResource().GetAttributes() {
+			resource[kv.GetKey()] = anyValueString(kv.GetValue())
+		}
+
+		for _, scopeLogs := range resourceLogs.GetScopeLogs() {
+			scope := scopeLogs.GetScope().GetName()
+			for _, record := range scopeLogs.GetLogRecords() {
+				events = append(events, otlpEvent(resource, scope, record))
+			}
+		}
+	}
+
+	return events
+}
+
+func otlpEvent(resource map[string]string, scope string, record *logspb.LogRecord) models.Event {
+	event := models.Event{
+		Service:        resource["service.name"],
+		Host:           resource["host.name"],
+		Level:          record.GetSeverityText(),
+		SeverityNumber: models.SeverityFromNumber(int64(record.GetSeverityNumber())),
+		Message:        anyValueString(record.GetBody()),
+		RequestID:      uuid.New().String(),
+		TraceFlags:     uint8(record.GetFlags() & 0xff),
+		Attributes:     make(map[string]string),
+	}
+
+	switch {
+	case record.GetTimeUnixNano() > 0:
+		event.EventTimeMs = record.GetTimeUnixNano() / uint64(time.Millisecond)
+	case record.GetObservedTimeUnixNano() > 0:
+		event.EventTimeMs = record.GetObservedTimeUnixNano() / uint64(time.Millisecond)
+	default:
+		event.EventTimeMs = uint64(time.Now().UnixMilli())
+	}
+
+	if traceID := hex.EncodeToString(record.GetTraceId()); models.IsTraceID(traceID) {
+		event.TraceID = traceID
+	}
+	if spanID := hex.EncodeToString(record.GetSpanId()); models.IsSpanID(spanID) {
+		event.SpanID = spanID
+	}
+
+	for key, value := range resource {
+		if key != "service.name" && key != "host.name" {
+			event.Attributes[key] = value
+		}
+	}
+	if scope != "" {
+		event.Attributes["otel.scope.name"] = scope
+	}
+	for _, kv := range record.GetAttributes() {
+		event.Attributes[kv.GetKey()] = anyValueString(kv.GetValue())
+	}
+
+	return event
+}
+
+// anyValueString renders an OTLP value as a string. Scalars are formatted
+// directly while arrays, maps and bytes are encoded as JSON.
+func anyValueString(value *commonpb.AnyValue) string {
+	if s, ok := value.GetValue().(*commonpb.AnyValue_StringValue); ok {
+		return s.StringValue
+	}
+
+	v := anyValueInterface(value)
+	if v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(encoded)
+}
+
+func anyValueInterface(value *commonpb.AnyValue) interface{} {
+	switch v := value.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return v.BoolValue
+	case *commonpb.AnyValue_IntValue:
+		return v.IntValue
+	case *commonpb.AnyValue_DoubleValue:
+		return v.DoubleValue
+	case *commonpb.AnyValue_BytesValue:
+		return v.BytesValue
+	case *commonpb.AnyValue_ArrayValue:
+		items := make([]interface{}, 0, len(v.ArrayValue.GetValues()))
+		for _, item := range v.ArrayValue.GetValues() {
+			items = append(items, anyValueInterface(item))
+		}
+		return items
+	case *commonpb.AnyValue_KvlistValue:
+		object := make(map[string]interface{}, len(v.KvlistValue.GetValues()))
+		for _, kv := range v.KvlistValue.GetValues() {
+			object[kv.GetKey()] = anyValueInterface(kv.GetValue())
+		}
+		return object
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,106 @@
+package transport
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mohammadhptp/pulse/pkg/models"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+)
+
+func gzipped(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadBody(t *testing.T) {
+	const limit = 1024
+
+	tests := []struct {
+		name     string
+		body     []byte
+		encoding string
+		want     string
+		status   int
+	}{
+		{name: "plain", body: []byte("hello"), want: "hello"},
+		{name: "plain at the limit", body: bytes.Repeat([]byte("a"), limit), want: strings.Repeat("a", limit)},
+		{name: "plain over the limit", body: bytes.Repeat([]byte("a"), limit+1), status: http.StatusRequestEntityTooLarge},
+		{name: "gzip", body: gzipped(t, "hello"), encoding: "gzip", want: "hello"},
+		{name: "gzip at the limit", body: gzipped(t, strings.Repeat("a", limit)), encoding: "gzip", want: strings.Repeat("a", limit)},
+		{name: "gzip decompressed over the limit", body: gzipped(t, strings.Repeat("a", 100*limit)), encoding: "gzip", status: http.StatusRequestEntityTooLarge},
+		{name: "invalid gzip", body: []byte("not gzip"), encoding: "gzip", status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, OTLPLogsPath, bytes.NewReader(tt.body))
+			r.Header.Set("Content-Encoding", tt.encoding)
+
+			body, err := readBody(r, limit)
+			if tt.status != 0 {
+				if err == nil {
+					t.Fatalf("readBody() = %q, want an error", body)
+				}
+				if status := readBodyStatus(err); status != tt.status {
+					t.Errorf("readBodyStatus(%v) = %d, want %d", err, status, tt.status)
+				}
+				return
+			}
+			if err != nil || string(body) != tt.want {
+				t.Errorf("readBody() = %q, %v, want %q", body, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOTLPRejectsOversizedGzipBody(t *testing.T) {
+	o := NewOTLPTransport(0)
+	o.SetEventHandler(func(models.Event) error {
+		return errors.New("no event expected")
+	})
+
+	body := gzipped(t, `{"resourceLogs": []}`+strings.Repeat(" ", otlpMaxBodyBytes))
+	r := httptest.NewRequest(http.MethodPost, OTLPLogsPath, bytes.NewReader(body))
+	r.Header.Set("Content-Type", contentTypeJSON)
+	r.Header.Set("Content-Encoding", "gzip")
+
+	w := httptest.NewRecorder()
+	o.handleLogs(w, r)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestOTLPEventSeverity(t *testing.T) {
+	tests := []struct {
+		name     string
+		number   logspb.SeverityNumber
+		severity uint8
+	}{
+		{"unspecified", logspb.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED, 0},
+		{"warn", logspb.SeverityNumber_SEVERITY_NUMBER_WARN, 13},
+		{"out of range", 300, 0},
+		{"negative", -1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := otlpEvent(nil, "", &logspb.LogRecord{SeverityNumber: tt.number})
+			if e.SeverityNumber != tt.severity {
+				t.Errorf("SeverityNumber = %d, want %d", e.SeverityNumber, tt.severity)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package transport
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mohammadhptp/pulse/pkg/logger"
+	"github.com/mohammadhptp/pulse/pkg/metrics"
+	"github.com/mohammadhptp/pulse/pkg/models"
+	"go.uber.org/zap"
+)
+
+// handlerRef holds the event handler of a transport. Embedding it provides the
+// SetEventHandler method of EventProducer. Events passed to the handler returned
+// by eventHandler are tagged with source unless they already name one, and are
+// counted in the ingest metrics of the source.
+type handlerRef struct {
+	handler EventHandler
+	source  string
+	mu      sync.RWMutex
+}
+
+func (r *handlerRef) SetEventHandler(handler EventHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handler = handler
+}
+
+func (r *handlerRef) eventHandler() EventHandler {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	handler, source := r.handler, r.source
+	if handler == nil || source == "" {
+		return handler
+	}
+	return countEvents(source, func(event models.Event) error {
+		if event.Source == "" {
+			event.Source = source
+		}
+		return handler(event)
+	})
+}
+
+// countEvents counts the events accepted and rejected by handler in the ingest
+// metrics of a transport.
+func countEvents(transport string, handler EventHandler) EventHandler {
+	accepted := metrics.IngestEvents.WithLabelValues(transport, metrics.ResultAccepted)
+	rejected := metrics.IngestEvents.WithLabelValues(transport, metrics.ResultRejected)
+	return func(event models.Event) error {
+		if err := handler(event); err != nil {
+			rejected.Inc()
+			return err
+		}
+		accepted.Inc()
+		return nil
+	}
+}
+
+// withRemoteAddr tags events passed to handler with the address, without the
+// port, of the client that sent them.
+func withRemoteAddr(handler EventHandler, addr string) EventHandler {
+	if handler == nil {
+		return nil
+	}
+
+	host := remoteHost(addr)
+	return func(event models.Event) error {
+		if event.RemoteAddr == "" {
+			event.RemoteAddr = host
+		}
+		return handler(event)
+	}
+}
+
+// remoteHost strips the port from a network address.
+func remoteHost(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// serveHTTP starts an HTTP server for a transport in the background and shuts
+// it down once the context is cancelled.
+func serveHTTP(ctx context.Context, name, addr string, handler http.Handler) *http.Server {
+	server := &http.Server{
+		Addr:    addr,
+		Handler: handler,
+	}
+
+	logger.Info("Starting "+name+" transport", zap.String("address", addr))
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Error(name+" server error", zap.Error(err))
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		shutdownHTTP(name, server)
+	}()
+
+	return server
+}
+
+// shutdownHTTP gracefully stops a server started by serveHTTP.
+func shutdownHTTP(name string, server *http.Server) error {
+	if server == nil {
+		return nil
+	}
+
+	logger.Info("Stopping " + name + " transport")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return server.Shutdown(ctx)
+}
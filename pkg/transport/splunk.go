@@ -0,0 +1,453 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mohammadhptp/pulse/pkg/logger"
+	"github.com/mohammadhptp/pulse/pkg/metrics"
+	"github.com/mohammadhptp/pulse/pkg/models"
+	"go.uber.org/zap"
+)
+
+const (
+	hecMaxBodyBytes = 64 << 20
+
+	// hecMaxPendingAcks bounds the acknowledgements kept per channel that
+	// clients have not queried yet.
+	hecMaxPendingAcks = 10000
+	hecMaxChannels    = 10000
+
+	hecChannelHeader = "X-Splunk-Request-Channel"
+)
+
+// hecResponse is the status body of every HEC response. Code follows the
+// Splunk HEC status codes.
+type hecResponse struct {
+	Text               string  `json:"text"`
+	Code               int     `json:"code"`
+	AckID              *uint64 `json:"ackId,omitempty"`
+	InvalidEventNumber *int    `json:"invalid-event-number,omitempty"`
+}
+
+var (
+	hecSuccess         = hecResponse{Text: "Success", Code: 0}
+	hecTokenRequired   = hecResponse{Text: "Token is required", Code: 2}
+	hecInvalidAuth     = hecResponse{Text: "Invalid authorization", Code: 3}
+	hecInvalidToken    = hecResponse{Text: "Invalid token", Code: 4}
+	hecNoData          = hecResponse{Text: "No data", Code: 5}
+	hecInvalidFormat   = hecResponse{Text: "Invalid data format", Code: 6}
+	hecServerBusy      = hecResponse{Text: "Server is busy", Code: 9}
+	hecHealthy         = hecResponse{Text: "HEC is healthy", Code: 17}
+	hecEventRequired   = hecResponse{Text: "Event field is required", Code: 12}
+	hecEventBlank      = hecResponse{Text: "Event field cannot be blank", Code: 13}
+	hecChannelRequired = hecResponse{Text: "Data channel is missing", Code: 10}
+)
+
+// hecEvent is a single event of the HEC JSON format.
+type hecEvent struct {
+	Time       json.Number            `json:"time"`
+	Host       string                 `json:"host"`
+	Source     string                 `json:"source"`
+	SourceType string                 `json:"sourcetype"`
+	Index      string                 `json:"index"`
+	Event      json.RawMessage        `json:"event"`
+	Fields     map[string]interface{} `json:"fields"`
+}
+
+// hecChannel tracks the acknowledgements handed out on a data channel.
+type hecChannel struct {
+	next    uint64
+	pending map[uint64]struct{}
+}
+
+// SplunkTransport emulates the Splunk HTTP Event Collector for vendors and
+// tools that can only export logs over HEC.
+type SplunkTransport struct {
+	handlerRef
+	server *http.Server
+	port   int
+	tokens []string
+
+	channels  map[string]*hecChannel
+	channelMu sync.Mutex
+}
+
+// NewSplunkTransport creates a HEC transport listening on port. When tokens is
+// empty, requests are accepted without authentication.
+func NewSplunkTransport(port int, tokens []string) *SplunkTransport {
+	return &SplunkTransport{
+		handlerRef: handlerRef{source: "splunk"},
+		port:       port,
+		tokens:     tokens,
+		channels:   make(map[string]*hecChannel),
+	}
+}
+
+func (s *SplunkTransport) Start(ctx context.Context) error {
+	if len(s.tokens) == 0 {
+		logger.Warn("No HEC tokens configured, accepting unauthenticated requests")
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /services/collector", s.authorize(s.handleEvents))
+	mux.HandleFunc("POST /services/collector/event", s.authorize(s.handleEvents))
+	mux.HandleFunc("POST /services/collector/event/1.0", s.authorize(s.handleEvents))
+	mux.HandleFunc("POST /services/collector/raw", s.authorize(s.handleRaw))
+	mux.HandleFunc("POST /services/collector/raw/1.0", s.authorize(s.handleRaw))
+	mux.HandleFunc("POST /services/collector/ack", s.authorize(s.handleAck))
+	mux.HandleFunc("GET /services/collector/health", s.handleHealth)
+	mux.HandleFunc("GET /services/collector/health/1.0", s.handleHealth)
+
+	s.server = serveHTTP(ctx, "Splunk HEC", fmt.Sprintf(":%d", s.port), metrics.InstrumentHandler("splunk", mux))
+	return nil
+}
+
+func (s *SplunkTransport) Stop() error {
+	return shutdownHTTP("Splunk HEC", s.server)
+}
+
+func (s *SplunkTransport) Close() error {
+	return s.Stop()
+}
+
+// authorize checks the "Authorization: Splunk <token>" header against the
+// configured tokens.
+func (s *SplunkTransport) authorize(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(s.tokens) == 0 {
+			next(w, r)
+			return
+		}
+
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			writeJSON(w, http.StatusUnauthorized, hecTokenRequired)
+			return
+		}
+
+		scheme, token, ok := strings.Cut(header, " ")
+		if !ok || !strings.EqualFold(scheme, "Splunk") {
+			writeJSON(w, http.StatusUnauthorized, hecInvalidAuth)
+			return
+		}
+
+		for _, valid := range s.tokens {
+			if subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(valid)) == 1 {
+				next(w, r)
+				return
+			}
+		}
+
+		writeJSON(w, http.StatusForbidden, hecInvalidToken)
+	}
+}
+
+func (s *SplunkTransport) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, hecHealthy)
+}
+
+// handleEvents ingests the HEC JSON format, where a request body holds one or
+// more concatenated event objects.
+func (s *SplunkTransport) handleEvents(w http.ResponseWriter, r *http.Request) {
+	handler := withRemoteAddr(s.eventHandler(), r.RemoteAddr)
+	if handler == nil {
+		http.Error(w, "Event handler not configured", http.StatusInternalServerError)
+		return
+	}
+
+	body, err := readBody(r, hecMaxBodyBytes)
+	if err != nil {
+		logger.Warn("Failed to read HEC request", zap.Error(err))
+		writeJSON(w, http.StatusBadRequest, hecInvalidFormat)
+		return
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		writeJSON(w, http.StatusBadRequest, hecNoData)
+		return
+	}
+
+	var events []models.Event
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	for i := 0; ; i++ {
+		var raw hecEvent
+		err := decoder.Decode(&raw)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, withEventNumber(hecInvalidFormat, i))
+			return
+		}
+
+		event, status := hecEventToEvent(raw)
+		if status != nil {
+			writeJSON(w, http.StatusBadRequest, withEventNumber(*status, i))
+			return
+		}
+		events = append(events, event)
+	}
+
+	s.process(w, r, handler, events)
+}
+
+// handleRaw ingests a raw body, one event per line. Metadata is taken from the
+// query string.
+func (s *SplunkTransport) handleRaw(w http.ResponseWriter, r *http.Request) {
+	handler := withRemoteAddr(s.eventHandler(), r.RemoteAddr)
+	if handler == nil {
+		http.Error(w, "Event handler not configured", http.StatusInternalServerError)
+		return
+	}
+
+	body, err := readBody(r, hecMaxBodyBytes)
+	if err != nil {
+		logger.Warn("Failed to read HEC request", zap.Error(err))
+		writeJSON(w, http.StatusBadRequest, hecInvalidFormat)
+		return
+	}
+
+	query := r.URL.Query()
+	meta := hecEvent{
+		Host:       query.Get("host"),
+		Source:     query.Get("source"),
+		SourceType: query.Get("sourcetype"),
+		Index:      query.Get("index"),
+	}
+	now := uint64(time.Now().UnixMilli())
+
+	var events []models.Event
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), hecMaxBodyBytes)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		event := hecMetadataEvent(meta)
+		event.EventTimeMs = now
+		event.Message = line
+		events = append(events, event)
+	}
+	if len(events) == 0 {
+		writeJSON(w, http.StatusBadRequest, hecNoData)
+		return
+	}
+
+	s.process(w, r, handler, events)
+}
+
+// process hands the events of a request to the handler and acknowledges the
+// request on its data channel, if the client sent one. When an event fails,
+// the response names it, as the events before it are already written.
+func (s *SplunkTransport) process(w http.ResponseWriter, r *http.Request, handler EventHandler, events []models.Event) {
+	for i, event := range events {
+		if err := handler(event); err != nil {
+			logger.Error("Failed to process HEC event", zap.Error(err), zap.Int("event", i))
+			writeJSON(w, http.StatusServiceUnavailable, withEventNumber(hecServerBusy, i))
+			return
+		}
+	}
+
+	response := hecSuccess
+	if channel := requestChannel(r); channel != "" {
+		ackID, ok := s.acknowledge(channel)
+		if !ok {
+			writeJSON(w, http.StatusServiceUnavailable, hecServerBusy)
+			return
+		}
+		response.AckID = &ackID
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleAck reports the status of acknowledgements previously handed out on
+// a channel. Events are written before a request succeeds, so every known ID
+// is acknowledged and forgotten once reported.
+func (s *SplunkTransport) handleAck(w http.ResponseWriter, r *http.Request) {
+	channel := requestChannel(r)
+	if channel == "" {
+		writeJSON(w, http.StatusBadRequest, hecChannelRequired)
+		return
+	}
+
+	var request struct {
+		Acks []uint64 `json:"acks"`
+	}
+	body, err := readBody(r, hecMaxBodyBytes)
+	if err != nil || json.Unmarshal(body, &request) != nil {
+		writeJSON(w, http.StatusBadRequest, hecInvalidFormat)
+		return
+	}
+
+	acks := make(map[string]bool, len(request.Acks))
+	s.channelMu.Lock()
+	state := s.channels[channel]
+	for _, id := range request.Acks {
+		acked := false
+		if state != nil {
+			_, acked = state.pending[id]
+			delete(state.pending, id)
+		}
+		acks[strconv.FormatUint(id, 10)] = acked
+	}
+	s.channelMu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"acks": acks})
+}
+
+func (s *SplunkTransport) acknowledge(channel string) (uint64, bool) {
+	s.channelMu.Lock()
+	defer s.channelMu.Unlock()
+
+	state := s.channels[channel]
+	if state == nil {
+		if len(s.channels) >= hecMaxChannels {
+			return 0, false
+		}
+		state = &hecChannel{pending: make(map[uint64]struct{})}
+		s.channels[channel] = state
+	}
+
+	id := state.next
+	state.next++
+	state.pending[id] = struct{}{}
+	if id >= hecMaxPendingAcks {
+		delete(state.pending, id-hecMaxPendingAcks)
+	}
+
+	return id, true
+}
+
+func requestChannel(r *http.Request) string {
+	if channel := r.Header.Get(hecChannelHeader); channel != "" {
+		return channel
+	}
+	return r.URL.Query().Get("channel")
+}
+
+func withEventNumber(response hecResponse, n int) hecResponse {
+	response.InvalidEventNumber = &n
+	return response
+}
+
+// hecEventToEvent maps a HEC event onto an Event. A string event becomes the
+// message; an object event is flattened, with its message, level and service
+// fields lifted and the rest kept as attributes.
+func hecEventToEvent(raw hecEvent) (models.Event, *hecResponse) {
+	if len(raw.Event) == 0 || string(raw.Event) == "null" {
+		return models.Event{}, &hecEventRequired
+	}
+
+	event := hecMetadataEvent(raw)
+
+	event.EventTimeMs = uint64(time.Now().UnixMilli())
+	if raw.Time != "" {
+		seconds, err := raw.Time.Float64()
+		if err != nil || seconds < 0 || seconds*1000 >= math.MaxInt64 {
+			return models.Event{}, &hecInvalidFormat
+		}
+		event.EventTimeMs = uint64(math.Round(seconds * 1000))
+	}
+
+	var message string
+	if err := json.Unmarshal(raw.Event, &message); err == nil {
+		if strings.TrimSpace(message) == "" {
+			return models.Event{}, &hecEventBlank
+		}
+		event.Message = message
+		return event, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw.Event))
+	decoder.UseNumber()
+	var object map[string]interface{}
+	if err := decoder.Decode(&object); err != nil {
+		// Numbers, booleans and arrays are indexed as their JSON text.
+		event.Message = string(raw.Event)
+		return event, nil
+	}
+
+	fields := models.FlattenDocument(object)
+	for _, key := range []string{"message", "msg", "log"} {
+		if value, ok := fields[key]; ok {
+			event.Message = value
+			delete(fields, key)
+			break
+		}
+	}
+	if event.Message == "" {
+		event.Message = string(raw.Event)
+	}
+	for _, key := range []string{"level", "severity"} {
+		if value, ok := fields[key]; ok {
+			event.Level = value
+			delete(fields, key)
+			break
+		}
+	}
+	if value, ok := fields["service"]; ok {
+		if _, indexed := raw.Fields["service"]; !indexed {
+			event.Service = value
+		}
+		delete(fields, "service")
+	}
+	for key, value := range fields {
+		event.Attributes[key] = value
+	}
+
+	return event, nil
+}
+
+// hecMetadataEvent builds an event from the HEC metadata. The service comes
+// from the "service" indexed field, falling back to the source.
+func hecMetadataEvent(raw hecEvent) models.Event {
+	event := models.Event{
+		Host:       raw.Host,
+		Service:    raw.Source,
+		Attributes: make(map[string]string),
+	}
+
+	if raw.Source != "" {
+		event.Attributes["splunk.source"] = raw.Source
+	}
+	if raw.SourceType != "" {
+		event.Attributes["splunk.sourcetype"] = raw.SourceType
+	}
+	if raw.Index != "" {
+		event.Attributes["splunk.index"] = raw.Index
+	}
+
+	for key, value := range raw.Fields {
+		switch v := value.(type) {
+		case string:
+			event.Attributes[key] = v
+		case []interface{}:
+			encoded, _ := json.Marshal(v)
+			event.Attributes[key] = string(encoded)
+		default:
+			event.Attributes[key] = fmt.Sprint(v)
+		}
+	}
+	if service := event.Attributes["service"]; service != "" {
+		event.Service = service
+		delete(event.Attributes, "service")
+	}
+
+	return event
+}
@@ -0,0 +1,82 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/mohammadhptp/pulse/pkg/models"
+)
+
+func TestHECEventTime(t *testing.T) {
+	tests := []struct {
+		name   string
+		time   json.Number
+		timeMs uint64
+		status *hecResponse
+	}{
+		{name: "seconds", time: "1700000000", timeMs: 1700000000000},
+		{name: "fractional seconds", time: "1700000000.1234", timeMs: 1700000000123},
+		{name: "epoch", time: "0", timeMs: 0},
+		{name: "negative", time: "-1", status: &hecInvalidFormat},
+		{name: "too large", time: "1e300", status: &hecInvalidFormat},
+		{name: "not a number", time: "soon", status: &hecInvalidFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, status := hecEventToEvent(hecEvent{Time: tt.time, Event: json.RawMessage(`"hello"`)})
+			if status != tt.status {
+				t.Fatalf("status = %v, want %v", status, tt.status)
+			}
+			if status == nil && event.EventTimeMs != tt.timeMs {
+				t.Errorf("EventTimeMs = %d, want %d", event.EventTimeMs, tt.timeMs)
+			}
+		})
+	}
+}
+
+func TestHECProcessReportsFailedEvent(t *testing.T) {
+	tests := []struct {
+		name   string
+		failAt int
+		code   int
+		number *int
+	}{
+		{name: "all written", failAt: -1, code: http.StatusOK},
+		{name: "first failed", failAt: 0, code: http.StatusServiceUnavailable, number: intPtr(0)},
+		{name: "later failed", failAt: 2, code: http.StatusServiceUnavailable, number: intPtr(2)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := make([]models.Event, 3)
+			var written int
+			handler := func(models.Event) error {
+				if written == tt.failAt {
+					return errors.New("kafka unavailable")
+				}
+				written++
+				return nil
+			}
+
+			w := httptest.NewRecorder()
+			NewSplunkTransport(0, nil).process(w, httptest.NewRequest(http.MethodPost, "/services/collector", nil), handler, events)
+			if w.Code != tt.code {
+				t.Fatalf("status = %d, want %d", w.Code, tt.code)
+			}
+			var response hecResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(response.InvalidEventNumber, tt.number) {
+				t.Errorf("invalid-event-number = %v, want %v", response.InvalidEventNumber, tt.number)
+			}
+		})
+	}
+}
+
+func intPtr(n int) *int {
+	return &n
+}
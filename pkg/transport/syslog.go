@@ -0,0 +1,290 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mohammadhptp/pulse/pkg/logger"
+	"github.com/mohammadhptp/pulse/pkg/metrics"
+	"github.com/mohammadhptp/pulse/pkg/models"
+	"go.uber.org/zap"
+)
+
+// syslogMaxMessageSize bounds a single syslog message, both for UDP datagrams
+// and for octet-counted and newline-terminated stream frames.
+const syslogMaxMessageSize = 64 * 1024
+
+// SyslogConfig configures the listeners of a SyslogTransport. Listeners with an
+// empty address are disabled.
+type SyslogConfig struct {
+	UDPAddr     string
+	TCPAddr     string
+	TLSAddr     string
+	TLSCertFile string
+	TLSKeyFile  string
+}
+
+// SyslogTransport receives RFC 5424 and RFC 3164 syslog messages over UDP, TCP
+// and TLS. Stream listeners accept both octet-counted and newline framing.
+type SyslogTransport struct {
+	handlerRef
+	config SyslogConfig
+
+	packetConn net.PacketConn
+	listeners  []net.Listener
+	conns      map[net.Conn]struct{}
+	closed     bool
+	connMu     sync.Mutex
+	wg         sync.WaitGroup
+}
+
+func NewSyslogTransport(config SyslogConfig) *SyslogTransport {
+	return &SyslogTransport{
+		handlerRef: handlerRef{source: "syslog"},
+		config:     config,
+		conns:      make(map[net.Conn]struct{}),
+	}
+}
+
+func (s *SyslogTransport) Start(ctx context.Context) error {
+	if s.config.UDPAddr != "" {
+		conn, err := net.ListenPacket("udp", s.config.UDPAddr)
+		if err != nil {
+			return err
+		}
+		s.packetConn = conn
+
+		logger.Info("Starting syslog UDP transport", zap.String("address", s.config.UDPAddr))
+		s.wg.Add(1)
+		go s.servePackets(conn)
+	}
+
+	if s.config.TCPAddr != "" {
+		listener, err := net.Listen("tcp", s.config.TCPAddr)
+		if err != nil {
+			s.Stop()
+			return err
+		}
+
+		logger.Info("Starting syslog TCP transport", zap.String("address", s.config.TCPAddr))
+		s.serveListener(listener)
+	}
+
+	if s.config.TLSAddr != "" {
+		cert, err := tls.LoadX509KeyPair(s.config.TLSCertFile, s.config.TLSKeyFile)
+		if err != nil {
+			s.Stop()
+			return fmt.Errorf("loading syslog TLS certificate: %w", err)
+		}
+
+		listener, err := tls.Listen("tcp", s.config.TLSAddr, &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		})
+		if err != nil {
+			s.Stop()
+			return err
+		}
+
+		logger.Info("Starting syslog TLS transport", zap.String("address", s.config.TLSAddr))
+		s.serveListener(listener)
+	}
+
+	go func() {
+		<-ctx.Done()
+		s.Stop()
+	}()
+
+	return nil
+}
+
+func (s *SyslogTransport) Stop() error {
+	s.connMu.Lock()
+	if s.closed {
+		s.connMu.Unlock()
+		return nil
+	}
+	s.closed = true
+
+	logger.Info("Stopping syslog transport")
+	if s.packetConn != nil {
+		s.packetConn.Close()
+	}
+	for _, listener := range s.listeners {
+		listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.connMu.Unlock()
+
+	s.wg.Wait()
+	return nil
+}
+
+func (s *SyslogTransport) Close() error {
+	return s.Stop()
+}
+
+func (s *SyslogTransport) servePackets(conn net.PacketConn) {
+	defer s.wg.Done()
+
+	buf := make([]byte, syslogMaxMessageSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logger.Error("Syslog UDP read error", zap.Error(err))
+			}
+			return
+		}
+
+		s.handleMessage(string(buf[:n]), addr)
+	}
+}
+
+func (s *SyslogTransport) serveListener(listener net.Listener) {
+	s.connMu.Lock()
+	s.listeners = append(s.listeners, listener)
+	s.connMu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					logger.Error("Syslog accept error", zap.Error(err))
+				}
+				return
+			}
+
+			s.connMu.Lock()
+			if s.closed {
+				s.connMu.Unlock()
+				conn.Close()
+				return
+			}
+			s.conns[conn] = struct{}{}
+			s.wg.Add(1)
+			s.connMu.Unlock()
+
+			go s.serveConn(conn)
+		}
+	}()
+}
+
+// serveConn reads messages from a stream connection. Each frame is either
+// octet counted ("LEN SP MSG") or terminated by a newline, detected per frame.
+func (s *SyslogTransport) serveConn(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		s.connMu.Lock()
+		delete(s.conns, conn)
+		s.connMu.Unlock()
+		s.wg.Done()
+	}()
+
+	reader := bufio.NewReaderSize(conn, syslogMaxMessageSize)
+	for {
+		first, err := reader.Peek(1)
+		if err != nil {
+			return
+		}
+
+		var frame string
+		if first[0] >= '0' && first[0] <= '9' {
+			frame, err = readOctetCounted(reader)
+		} else {
+			frame, err = readDelimited(reader, '\n')
+			if err == io.EOF && frame != "" {
+				err = nil
+			}
+		}
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				logger.Warn("Syslog connection error",
+					zap.Error(err),
+					zap.String("remote", conn.RemoteAddr().String()))
+			}
+			return
+		}
+
+		if strings.TrimSpace(frame) != "" {
+			s.handleMessage(frame, conn.RemoteAddr())
+		}
+	}
+}
+
+// readDelimited reads up to and including delim. Frames longer than the
+// buffer of reader, syslogMaxMessageSize for connections, fail rather than
+// being buffered without bound.
+func readDelimited(reader *bufio.Reader, delim byte) (string, error) {
+	line, err := reader.ReadSlice(delim)
+	if err == bufio.ErrBufferFull {
+		return "", fmt.Errorf("syslog frame exceeds %d bytes", reader.Size())
+	}
+	return string(line), err
+}
+
+func readOctetCounted(reader *bufio.Reader) (string, error) {
+	length, err := readDelimited(reader, ' ')
+	if err != nil {
+		return "", err
+	}
+
+	n, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+	if err != nil || n <= 0 || n > syslogMaxMessageSize {
+		return "", fmt.Errorf("invalid syslog frame length %q", length)
+	}
+
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+func (s *SyslogTransport) handleMessage(raw string, addr net.Addr) {
+	metrics.IngestBytes.WithLabelValues("syslog").Add(float64(len(raw)))
+
+	handler := s.eventHandler()
+	if handler == nil {
+		logger.Warn("Dropping syslog message, event handler not configured")
+		return
+	}
+
+	var event models.Event
+	msg, err := parseSyslog(raw, time.Now())
+	if err != nil {
+		logger.Debug("Failed to parse syslog message, keeping it raw", zap.Error(err))
+		event = models.Event{
+			EventTimeMs: uint64(time.Now().UnixMilli()),
+			Message:     strings.TrimRight(raw, "\r\n\x00"),
+		}
+	} else {
+		event = msg.event()
+	}
+
+	if addr != nil {
+		event.RemoteAddr = remoteHost(addr.String())
+		if event.Host == "" {
+			event.Host = event.RemoteAddr
+		}
+	}
+
+	if err := handler(event); err != nil {
+		logger.Error("Failed to process syslog message", zap.Error(err))
+	}
+}
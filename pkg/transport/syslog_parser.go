@@ -0,0 +1,283 @@
+package transport
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/mohammadhptp/pulse/pkg/models"
+)
+
+// syslogMessage is a parsed RFC 5424 or RFC 3164 message.
+type syslogMessage struct {
+	facility       int
+	severity       int
+	timestamp      time.Time
+	hostname       string
+	appName        string
+	procID         string
+	msgID          string
+	structuredData map[string]string
+	message        string
+}
+
+var syslogFacilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+var syslogSeverities = []string{
+	"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug",
+}
+
+// syslogLevels maps syslog severities 0-7 onto canonical levels.
+var syslogLevels = []string{
+	models.LevelFatal, models.LevelFatal, models.LevelFatal, models.LevelError,
+	models.LevelWarn, models.LevelInfo, models.LevelInfo, models.LevelDebug,
+}
+
+var errInvalidPriority = errors.New("invalid syslog priority")
+
+// parseSyslog parses a single syslog message, detecting whether it uses the
+// RFC 5424 or the BSD RFC 3164 format. now is used to complete RFC 3164
+// timestamps, which carry neither a year nor a time zone.
+func parseSyslog(line string, now time.Time) (syslogMessage, error) {
+	line = strings.TrimRight(line, "\r\n\x00")
+
+	pri, rest, err := parsePriority(line)
+	if err != nil {
+		return syslogMessage{}, err
+	}
+
+	msg := syslogMessage{
+		facility: pri / 8,
+		severity: pri % 8,
+	}
+
+	if len(rest) > 1 && rest[0] >= '1' && rest[0] <= '9' && strings.IndexByte(rest, ' ') > 0 {
+		version := rest[:strings.IndexByte(rest, ' ')]
+		if _, err := strconv.Atoi(version); err == nil {
+			return parseRFC5424(msg, rest[len(version)+1:])
+		}
+	}
+
+	return parseRFC3164(msg, rest, now), nil
+}
+
+func parsePriority(line string) (int, string, error) {
+	if len(line) < 3 || line[0] != '<' {
+		return 0, "", errInvalidPriority
+	}
+
+	end := strings.IndexByte(line, '>')
+	if end < 2 || end > 4 {
+		return 0, "", errInvalidPriority
+	}
+
+	pri, err := strconv.Atoi(line[1:end])
+	if err != nil || pri < 0 || pri > 191 {
+		return 0, "", errInvalidPriority
+	}
+
+	return pri, line[end+1:], nil
+}
+
+// parseRFC5424 parses the part of an RFC 5424 message following the version:
+// TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]
+func parseRFC5424(msg syslogMessage, rest string) (syslogMessage, error) {
+	fields := make([]string, 5)
+	for i := range fields {
+		var ok bool
+		fields[i], rest, ok = strings.Cut(rest, " ")
+		if !ok && i < len(fields)-1 {
+			return msg, errors.New("truncated RFC 5424 header")
+		}
+	}
+
+	if fields[0] != "-" {
+		timestamp, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return msg, err
+		}
+		msg.timestamp = timestamp
+	}
+
+	msg.hostname = nilValue(fields[1])
+	msg.appName = nilValue(fields[2])
+	msg.procID = nilValue(fields[3])
+	msg.msgID = nilValue(fields[4])
+
+	sd, rest, err := parseStructuredData(rest)
+	if err != nil {
+		return msg, err
+	}
+	msg.structuredData = sd
+
+	rest = strings.TrimPrefix(rest, " ")
+	msg.message = strings.TrimPrefix(rest, "\ufeff")
+
+	return msg, nil
+}
+
+// parseStructuredData parses the STRUCTURED-DATA part of an RFC 5424 message
+// into "sd-id.param-name" keys, returning the remaining input.
+func parseStructuredData(s string) (map[string]string, string, error) {
+	if strings.HasPrefix(s, "-") {
+		return nil, s[1:], nil
+	}
+
+	data := make(map[string]string)
+	for strings.HasPrefix(s, "[") {
+		s = s[1:]
+		end := strings.IndexAny(s, " ]")
+		if end < 0 {
+			return nil, "", errors.New("unterminated structured data element")
+		}
+		id := s[:end]
+		s = s[end:]
+
+		params := 0
+		for strings.HasPrefix(s, " ") {
+			s = strings.TrimLeft(s, " ")
+			eq := strings.Index(s, "=\"")
+			if eq < 0 {
+				return nil, "", errors.New("invalid structured data parameter")
+			}
+			name := s[:eq]
+			s = s[eq+2:]
+
+			var value strings.Builder
+			closed := false
+			for i := 0; i < len(s); i++ {
+				c := s[i]
+				if c == '\\' && i+1 < len(s) && strings.IndexByte(`"\]`, s[i+1]) >= 0 {
+					value.WriteByte(s[i+1])
+					i++
+					continue
+				}
+				if c == '"' {
+					s = s[i+1:]
+					closed = true
+					break
+				}
+				value.WriteByte(c)
+			}
+			if !closed {
+				return nil, "", errors.New("unterminated structured data value")
+			}
+			data[id+"."+name] = value.String()
+			params++
+		}
+
+		if !strings.HasPrefix(s, "]") {
+			return nil, "", errors.New("unterminated structured data element")
+		}
+		s = s[1:]
+		if params == 0 {
+			data[id] = ""
+		}
+	}
+
+	return data, s, nil
+}
+
+// parseRFC3164 parses the part of a BSD syslog message following the
+// priority: TIMESTAMP HOSTNAME TAG: MSG. The format is loosely specified, so
+// missing parts are tolerated and the remainder is kept as the message.
+func parseRFC3164(msg syslogMessage, rest string, now time.Time) syslogMessage {
+	msg.timestamp = now
+
+	parsed := false
+	if len(rest) >= len(time.Stamp) {
+		if timestamp, err := time.ParseInLocation(time.Stamp, rest[:len(time.Stamp)], now.Location()); err == nil {
+			timestamp = timestamp.AddDate(now.Year(), 0, 0)
+			// Messages from the last days of December arriving in January.
+			if timestamp.After(now.Add(24 * time.Hour)) {
+				timestamp = timestamp.AddDate(-1, 0, 0)
+			}
+			msg.timestamp = timestamp
+			rest = strings.TrimPrefix(rest[len(time.Stamp):], " ")
+			parsed = true
+		}
+	}
+	// Some senders, such as rsyslog, use RFC 3339 timestamps in BSD messages.
+	if token, after, ok := strings.Cut(rest, " "); ok && !parsed {
+		if timestamp, err := time.Parse(time.RFC3339Nano, token); err == nil {
+			msg.timestamp = timestamp
+			rest = after
+		}
+	}
+
+	// The hostname is absent when the first token already is the tag.
+	if token, after, ok := strings.Cut(rest, " "); ok && !isSyslogTag(token) {
+		msg.hostname = token
+		rest = after
+	}
+
+	if token, after, ok := strings.Cut(rest, " "); ok && isSyslogTag(token) {
+		tag := strings.TrimSuffix(token, ":")
+		if open := strings.IndexByte(tag, '['); open > 0 && strings.HasSuffix(tag, "]") {
+			msg.procID = tag[open+1 : len(tag)-1]
+			tag = tag[:open]
+		}
+		msg.appName = tag
+		rest = after
+	}
+
+	msg.message = rest
+	return msg
+}
+
+func isSyslogTag(token string) bool {
+	if !strings.HasSuffix(token, ":") || len(token) < 2 {
+		return false
+	}
+	for _, r := range token[:len(token)-1] {
+		if !unicode.IsPrint(r) || unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func nilValue(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
+}
+
+// event maps the message onto an Event, keeping syslog specific fields and
+// structured data as attributes.
+func (m syslogMessage) event() models.Event {
+	event := models.Event{
+		Service:    m.appName,
+		Host:       m.hostname,
+		Level:      syslogLevels[m.severity],
+		Message:    m.message,
+		Attributes: make(map[string]string, len(m.structuredData)+4),
+	}
+
+	if !m.timestamp.IsZero() {
+		event.EventTimeMs = uint64(m.timestamp.UnixMilli())
+	} else {
+		event.EventTimeMs = uint64(time.Now().UnixMilli())
+	}
+
+	event.Attributes["syslog.facility"] = syslogFacilities[m.facility]
+	event.Attributes["syslog.severity"] = syslogSeverities[m.severity]
+	if m.procID != "" {
+		event.Attributes["syslog.procid"] = m.procID
+	}
+	if m.msgID != "" {
+		event.Attributes["syslog.msgid"] = m.msgID
+	}
+	for key, value := range m.structuredData {
+		event.Attributes[key] = value
+	}
+
+	return event
+}
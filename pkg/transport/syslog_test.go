@@ -0,0 +1,260 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mohammadhptp/pulse/pkg/models"
+)
+
+func TestParseSyslog(t *testing.T) {
+	now := time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC)
+	newYear := time.Date(2024, time.January, 1, 0, 5, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		line string
+		now  time.Time
+		want syslogMessage
+		err  bool
+	}{
+		{
+			name: "RFC 5424",
+			line: "<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog 1234 ID47 - An application event\n",
+			want: syslogMessage{
+				facility: 20, severity: 5,
+				timestamp: time.Date(2003, time.October, 11, 22, 14, 15, 3000000, time.UTC),
+				hostname:  "mymachine.example.com", appName: "evntslog", procID: "1234", msgID: "ID47",
+				message: "An application event",
+			},
+		},
+		{
+			name: "RFC 5424 structured data",
+			line: `<165>1 2003-10-11T22:14:15.003Z host app - - [exampleSDID@32473 iut="3" eventSource="App\"lication\]"][origin] msg`,
+			want: syslogMessage{
+				facility: 20, severity: 5,
+				timestamp: time.Date(2003, time.October, 11, 22, 14, 15, 3000000, time.UTC),
+				hostname:  "host", appName: "app",
+				structuredData: map[string]string{
+					"exampleSDID@32473.iut":         "3",
+					"exampleSDID@32473.eventSource": `App"lication]`,
+					"origin":                        "",
+				},
+				message: "msg",
+			},
+		},
+		{
+			name: "RFC 5424 nil values and BOM",
+			line: "<14>1 - - - - - - \ufeffhello",
+			want: syslogMessage{facility: 1, severity: 6, message: "hello"},
+		},
+		{
+			name: "RFC 5424 without message",
+			line: "<14>1 - host app - - -",
+			want: syslogMessage{facility: 1, severity: 6, hostname: "host", appName: "app"},
+		},
+		{
+			name: "RFC 5424 truncated header",
+			line: "<14>1 2003-10-11T22:14:15Z host",
+			err:  true,
+		},
+		{
+			name: "RFC 5424 invalid timestamp",
+			line: "<14>1 yesterday host app - - - msg",
+			err:  true,
+		},
+		{
+			name: "RFC 5424 unterminated structured data",
+			line: `<14>1 - host app - - [id key="value msg`,
+			err:  true,
+		},
+		{
+			name: "RFC 3164",
+			line: "<34>Oct 11 22:14:15 mymachine su[230]: 'su root' failed for lonvick on /dev/pts/8",
+			want: syslogMessage{
+				facility: 4, severity: 2,
+				timestamp: time.Date(2024, time.October, 11, 22, 14, 15, 0, time.UTC).AddDate(-1, 0, 0),
+				hostname:  "mymachine", appName: "su", procID: "230",
+				message: "'su root' failed for lonvick on /dev/pts/8",
+			},
+		},
+		{
+			name: "RFC 3164 without hostname",
+			line: "<13>Mar  9 08:00:01 cron: job started",
+			want: syslogMessage{
+				facility: 1, severity: 5,
+				timestamp: time.Date(2024, time.March, 9, 8, 0, 1, 0, time.UTC),
+				appName:   "cron", message: "job started",
+			},
+		},
+		{
+			name: "RFC 3164 from last December",
+			line: "<13>Dec 31 23:59:58 host app: late",
+			now:  newYear,
+			want: syslogMessage{
+				facility: 1, severity: 5,
+				timestamp: time.Date(2023, time.December, 31, 23, 59, 58, 0, time.UTC),
+				hostname:  "host", appName: "app", message: "late",
+			},
+		},
+		{
+			name: "RFC 3164 with RFC 3339 timestamp",
+			line: "<13>2024-03-10T11:59:00.5+01:00 host app: rsyslog",
+			want: syslogMessage{
+				facility: 1, severity: 5,
+				timestamp: time.Date(2024, time.March, 10, 10, 59, 0, 500000000, time.UTC),
+				hostname:  "host", appName: "app", message: "rsyslog",
+			},
+		},
+		{
+			name: "RFC 3164 without timestamp or tag",
+			line: "<13>just a message",
+			want: syslogMessage{facility: 1, severity: 5, timestamp: now, hostname: "just", message: "a message"},
+		},
+		{name: "missing priority", line: "Oct 11 22:14:15 host app: msg", err: true},
+		{name: "priority out of range", line: "<192>1 - - - - - -", err: true},
+		{name: "unterminated priority", line: "<13 host app: msg", err: true},
+		{name: "non-numeric priority", line: "<ab>host app: msg", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at := now
+			if !tt.now.IsZero() {
+				at = tt.now
+			}
+			got, err := parseSyslog(tt.line, at)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("parseSyslog(%q) = %+v, want an error", tt.line, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseSyslog(%q) error = %v", tt.line, err)
+			}
+			if !got.timestamp.Equal(tt.want.timestamp) {
+				t.Errorf("timestamp = %v, want %v", got.timestamp, tt.want.timestamp)
+			}
+			got.timestamp, tt.want.timestamp = time.Time{}, time.Time{}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSyslog(%q) = %+v, want %+v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyslogMessageEvent(t *testing.T) {
+	msg := syslogMessage{
+		facility: 16, severity: 3,
+		timestamp: time.UnixMilli(1700000000123),
+		hostname:  "web-1", appName: "nginx", procID: "42", msgID: "ACCESS",
+		structuredData: map[string]string{"meta.region": "eu"},
+		message:        "upstream timed out",
+	}
+	event := msg.event()
+
+	if event.EventTimeMs != 1700000000123 || event.Service != "nginx" || event.Host != "web-1" ||
+		event.Level != "ERROR" || event.Message != "upstream timed out" {
+		t.Errorf("event() = %+v", event)
+	}
+	want := map[string]string{
+		"syslog.facility": "local0",
+		"syslog.severity": "err",
+		"syslog.procid":   "42",
+		"syslog.msgid":    "ACCESS",
+		"meta.region":     "eu",
+	}
+	if !reflect.DeepEqual(event.Attributes, want) {
+		t.Errorf("event() attributes = %v, want %v", event.Attributes, want)
+	}
+}
+
+func TestReadOctetCounted(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+		err   bool
+	}{
+		{"single frame", "5 hello", []string{"hello"}, false},
+		{"consecutive frames", "3 one11 <13>two two", []string{"one", "<13>two two"}, false},
+		{"invalid length", "x hello", nil, true},
+		{"zero length", "0 ", nil, true},
+		{"short frame", "10 short", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := bufio.NewReader(strings.NewReader(tt.input))
+			var got []string
+			var err error
+			for range len(tt.want) + 1 {
+				var frame string
+				if frame, err = readOctetCounted(reader); err != nil {
+					break
+				}
+				got = append(got, frame)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("frames = %q, want %q", got, tt.want)
+			}
+			if tt.err && (err == nil || err.Error() == "EOF") {
+				t.Errorf("error = %v, want a framing error", err)
+			}
+		})
+	}
+}
+
+func TestReadDelimited(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+		err   bool
+	}{
+		{"line", "<13>hello\nnext", "<13>hello\n", false},
+		{"line filling the buffer", strings.Repeat("a", 15) + "\n", strings.Repeat("a", 15) + "\n", false},
+		{"overlong line", strings.Repeat("a", 16) + "\n", "", true},
+		{"unterminated line", "<13>hello", "<13>hello", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readDelimited(bufio.NewReaderSize(strings.NewReader(tt.input), 16), '\n')
+			if got != tt.want || (err != nil) != tt.err {
+				t.Errorf("readDelimited() = %q, %v; want %q, error %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestSyslogServeConnClosesOnOverlongLine(t *testing.T) {
+	s := NewSyslogTransport(SyslogConfig{})
+	events := make(chan models.Event, 1)
+	s.SetEventHandler(func(e models.Event) error {
+		events <- e
+		return nil
+	})
+
+	client, server := net.Pipe()
+	defer client.Close()
+	s.wg.Add(1)
+	go s.serveConn(server)
+
+	if _, err := client.Write([]byte("<13>Mar  9 08:00:01 host app: fits\n")); err != nil {
+		t.Fatal(err)
+	}
+	if e := <-events; e.Message != "fits" {
+		t.Errorf("message = %q, want %q", e.Message, "fits")
+	}
+
+	// The connection is closed once the buffer fills, long before the
+	// client would stop sending.
+	if _, err := client.Write(bytes.Repeat([]byte("a"), 4*syslogMaxMessageSize)); err == nil {
+		t.Error("overlong line was read to the end, want the connection closed")
+	}
+	s.wg.Wait()
+}
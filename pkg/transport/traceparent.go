@@ -0,0 +1,56 @@
+package transport
+
+import (
+	"encoding/hex"
+	"strings"
+
+	"github.com/mohammadhptp/pulse/pkg/models"
+)
+
+// TraceparentHeader is the W3C Trace Context header carrying the trace and
+// parent span of the request.
+const TraceparentHeader = "traceparent"
+
+// parseTraceparent extracts the trace ID, span ID and flags from a W3C
+// traceparent value of the form version-traceid-spanid-flags.
+func parseTraceparent(value string) (traceID, spanID string, flags uint8, ok bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 {
+		return "", "", 0, false
+	}
+
+	version, traceID, spanID, flagsHex := parts[0], parts[1], parts[2], parts[3]
+	if len(version) != 2 || version == "ff" || (version == "00" && len(parts) != 4) {
+		return "", "", 0, false
+	}
+	if !models.IsTraceID(traceID) || !models.IsSpanID(spanID) {
+		return "", "", 0, false
+	}
+
+	decoded, err := hex.DecodeString(flagsHex)
+	if err != nil || len(decoded) != 1 {
+		return "", "", 0, false
+	}
+
+	return strings.ToLower(traceID), strings.ToLower(spanID), decoded[0], true
+}
+
+// applyTraceparent fills in the trace context of an event from a traceparent
+// value unless the event already carries its own valid trace ID.
+func applyTraceparent(event *models.Event, value string) {
+	event.NormalizeTrace()
+	if event.TraceID != "" || value == "" {
+		return
+	}
+
+	traceID, spanID, flags, ok := parseTraceparent(value)
+	if !ok {
+		return
+	}
+
+	event.TraceID = traceID
+	if event.SpanID == "" {
+		event.SpanID = spanID
+		event.TraceFlags = flags
+	}
+}
@@ -0,0 +1,67 @@
+package transport
+
+import (
+	"testing"
+
+	"github.com/mohammadhptp/pulse/pkg/models"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		value   string
+		traceID string
+		spanID  string
+		flags   uint8
+		ok      bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", 1, true},
+		{" 00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-00 ", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", 0, true},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", 1, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", "", "", 0, false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "", "", 0, false},
+		{"0-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "", "", 0, false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", "", "", 0, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", "", "", 0, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01", "", "", 0, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1", "", "", 0, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-zz", "", "", 0, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", "", "", 0, false},
+		{"", "", "", 0, false},
+	}
+	for _, tt := range tests {
+		traceID, spanID, flags, ok := parseTraceparent(tt.value)
+		if traceID != tt.traceID || spanID != tt.spanID || flags != tt.flags || ok != tt.ok {
+			t.Errorf("parseTraceparent(%q) = %q, %q, %d, %v; want %q, %q, %d, %v",
+				tt.value, traceID, spanID, flags, ok, tt.traceID, tt.spanID, tt.flags, tt.ok)
+		}
+	}
+}
+
+func TestApplyTraceparent(t *testing.T) {
+	const header = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	tests := []struct {
+		name    string
+		event   models.Event
+		value   string
+		traceID string
+		spanID  string
+		flags   uint8
+	}{
+		{"from header", models.Event{}, header, "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", 1},
+		{"own trace kept", models.Event{TraceID: "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"}, header, "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", "", 0},
+		{"invalid own trace replaced", models.Event{TraceID: "bogus", SpanID: "bogus"}, header, "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", 1},
+		{"span without trace replaced", models.Event{SpanID: "1111111111111111"}, header, "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", 1},
+		{"invalid header", models.Event{TraceID: "bogus"}, "garbage", "", "", 0},
+		{"no header", models.Event{}, "", "", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := tt.event
+			applyTraceparent(&e, tt.value)
+			if e.TraceID != tt.traceID || e.SpanID != tt.spanID || e.TraceFlags != tt.flags {
+				t.Errorf("got %q/%q/%d, want %q/%q/%d", e.TraceID, e.SpanID, e.TraceFlags, tt.traceID, tt.spanID, tt.flags)
+			}
+		})
+	}
+}
@@ -0,0 +1,590 @@
+'use strict';
+
+// Pulse web UI: search, histogram, facets and live tail on top of the events
+// query API. The query state lives in the page URL, so that it can be shared.
+
+const PER_PAGE = 50;
+const FACET_LIMIT = 5;
+const LIVE_INTERVAL_MS = 2000;
+const LIVE_HISTOGRAM_INTERVAL_MS = 10000;
+// Polls reach back before the newest event shown, as events arrive in storage
+// out of time order. Events already shown are skipped.
+const LIVE_LOOKBACK_MS = 30000;
+const LIVE_PAGE_SIZE = 500;
+const LIVE_MAX_ROWS = 1000;
+
+const RANGES = {
+  '15m': 15 * 60e3,
+  '1h': 60 * 60e3,
+  '6h': 6 * 60 * 60e3,
+  '24h': 24 * 60 * 60e3,
+  '7d': 7 * 24 * 60 * 60e3,
+  '30d': 30 * 24 * 60 * 60e3,
+};
+const DEFAULT_RANGE = '1h';
+const LIVE_RANGE = '15m';
+
+// Fields that can be filtered on by clicking their values, besides level.
+const FILTER_FIELDS = ['service', 'host', 'trace_id', 'request_id'];
+const FACET_FIELDS = ['service', 'level', 'host'];
+
+let endpoint = '/events';
+
+const state = {
+  q: '',
+  level: '',
+  range: DEFAULT_RANGE,
+  from: 0,
+  to: 0,
+  page: 1,
+  live: false,
+  filters: {},
+};
+
+// searchToken discards the responses of superseded searches.
+let searchToken = 0;
+let liveSession = null;
+
+const $ = (id) => document.getElementById(id);
+
+function el(tag, className, text) {
+  const node = document.createElement(tag);
+  if (className) node.className = className;
+  if (text !== undefined) node.textContent = text;
+  return node;
+}
+
+// --- URL state ---
+
+function readURL() {
+  const params = new URLSearchParams(location.search);
+  state.q = params.get('q') || '';
+  state.level = params.get('level') || '';
+  state.range = params.get('range') in RANGES ? params.get('range') : DEFAULT_RANGE;
+  state.from = parseInt(params.get('from'), 10) || 0;
+  state.to = parseInt(params.get('to'), 10) || 0;
+  if (state.from || state.to) state.range = 'custom';
+  state.page = Math.max(1, parseInt(params.get('page'), 10) || 1);
+  state.live = params.get('live') === '1';
+  state.filters = {};
+  for (const field of FILTER_FIELDS) {
+    if (params.get(field)) state.filters[field] = params.get(field);
+  }
+}
+
+function writeURL(push) {
+  const params = new URLSearchParams();
+  if (state.q) params.set('q', state.q);
+  if (state.level) params.set('level', state.level);
+  for (const [field, value] of Object.entries(state.filters)) params.set(field, value);
+  if (state.range === 'custom') {
+    if (state.from) params.set('from', state.from);
+    if (state.to) params.set('to', state.to);
+  } else if (state.range !== DEFAULT_RANGE) {
+    params.set('range', state.range);
+  }
+  if (state.page > 1 && !state.live) params.set('page', state.page);
+  if (state.live) params.set('live', '1');
+
+  const query = params.toString();
+  const url = location.pathname + (query ? '?' + query : '');
+  if (url !== location.pathname + location.search) {
+    history[push ? 'pushState' : 'replaceState'](null, '', url);
+  }
+}
+
+// --- API ---
+
+function timeRange() {
+  if (state.range === 'custom') {
+    return { start: state.from, end: state.to || Date.now() };
+  }
+  const end = Date.now();
+  return { start: end - RANGES[state.range], end };
+}
+
+function filterParams(start, end) {
+  const params = new URLSearchParams();
+  if (state.q) params.set('search', state.q);
+  if (state.level) params.set('level', state.level);
+  for (const [field, value] of Object.entries(state.filters)) params.set(field, value);
+  if (start) params.set('start_time', start);
+  if (end) params.set('end_time', end);
+  return params;
+}
+
+async function api(path, params) {
+  const response = await fetch(endpoint + path + '?' + params, { headers: { Accept: 'application/json' } });
+  if (!response.ok) {
+    const text = (await response.text()).trim();
+    throw new Error(text || response.status + ' ' + response.statusText);
+  }
+  return response.json();
+}
+
+// --- Search ---
+
+function run() {
+  stopLive();
+  if (state.live) {
+    startLive();
+  } else {
+    search();
+  }
+}
+
+async function search() {
+  const token = ++searchToken;
+  setStatus('Loading…');
+  $('pages').hidden = false;
+
+  const { start, end } = timeRange();
+  const params = filterParams(start, end);
+  const query = new URLSearchParams(params);
+  query.set('per_page', PER_PAGE);
+  query.set('page', state.page);
+  query.set('sort_order', 'DESC');
+
+  loadFacets(params, token);
+  try {
+    const [events, histogram] = await Promise.all([api('', query), api('/histogram', params)]);
+    if (token !== searchToken) return;
+
+    renderHistogram(histogram);
+    clearEvents();
+    appendEvents(events.data || []);
+    renderPages(events);
+    setStatus(events.total ? '' : 'No events found');
+  } catch (err) {
+    if (token === searchToken) setStatus(err.message, true);
+  }
+}
+
+async function loadFacets(params, token) {
+  const query = new URLSearchParams(params);
+  query.set('limit', FACET_LIMIT);
+  try {
+    const response = await api('/facets', query);
+    if (token === searchToken) renderFacets(response.facets || {});
+  } catch (err) {
+    if (token === searchToken) $('facets').replaceChildren();
+  }
+}
+
+// --- Live tail ---
+
+function startLive() {
+  const token = ++searchToken;
+  const session = { token, cursor: 0, floor: 0, seen: new Map(), timer: 0, histogramAt: 0 };
+  liveSession = session;
+  $('pages').hidden = true;
+  setStatus('Following new events…');
+
+  const { start, end } = timeRange();
+  const query = filterParams(start, end);
+  query.set('per_page', PER_PAGE);
+  query.set('sort_order', 'DESC');
+
+  loadFacets(filterParams(start, end), token);
+  api('', query)
+    .then((response) => {
+      if (liveSession !== session) return;
+      const events = response.data || [];
+      clearEvents();
+      appendEvents(liveFilter(session, events.slice().reverse()).reverse());
+      // Events older than those shown are left to search.
+      session.floor = session.cursor || Date.now();
+      session.cursor = session.floor;
+    })
+    .catch((err) => {
+      if (liveSession === session) setStatus(err.message, true);
+    })
+    .finally(() => {
+      if (liveSession === session) livePoll(session);
+    });
+}
+
+function stopLive() {
+  if (liveSession) {
+    clearTimeout(liveSession.timer);
+    liveSession = null;
+  }
+}
+
+async function livePoll(session) {
+  try {
+    if (Date.now() - session.histogramAt >= LIVE_HISTOGRAM_INTERVAL_MS) {
+      session.histogramAt = Date.now();
+      const { start, end } = timeRange();
+      const histogram = await api('/histogram', filterParams(start, end));
+      if (liveSession === session) renderHistogram(histogram);
+    }
+
+    const query = filterParams(Math.max(session.cursor - LIVE_LOOKBACK_MS, session.floor), 0);
+    // Under heavy volume only the newest events of each poll are shown.
+    query.set('per_page', LIVE_PAGE_SIZE);
+    query.set('sort_order', 'DESC');
+    const response = await api('', query);
+    if (liveSession !== session) return;
+
+    const fresh = liveFilter(session, (response.data || []).reverse());
+    prependEvents(fresh.reverse());
+    pruneLive(session);
+    setStatus('Following new events…');
+  } catch (err) {
+    if (liveSession === session) setStatus(err.message, true);
+  }
+  if (liveSession === session) {
+    session.timer = setTimeout(() => livePoll(session), LIVE_INTERVAL_MS);
+  }
+}
+
+// liveFilter returns the events, oldest first, not shown yet.
+function liveFilter(session, events) {
+  const fresh = [];
+  for (const event of events) {
+    const key = [event.event_time_ms, event.request_id, event.service, event.host, event.message].join('\u0000');
+    if (session.seen.has(key) || event.event_time_ms < session.floor) continue;
+    session.seen.set(key, event.event_time_ms);
+    session.cursor = Math.max(session.cursor, event.event_time_ms);
+    fresh.push(event);
+  }
+  return fresh;
+}
+
+function pruneLive(session) {
+  const start = session.cursor - LIVE_LOOKBACK_MS;
+  for (const [key, time] of session.seen) {
+    if (time < start) session.seen.delete(key);
+  }
+
+  const rows = $('events').tBodies[0].querySelectorAll('tr.event');
+  for (let i = LIVE_MAX_ROWS; i < rows.length; i++) {
+    const details = rows[i].nextElementSibling;
+    if (details && details.classList.contains('details')) details.remove();
+    rows[i].remove();
+  }
+}
+
+// --- Rendering ---
+
+function setStatus(text, error) {
+  const status = $('status');
+  status.textContent = text;
+  status.classList.toggle('error', !!error);
+}
+
+function formatTime(ms) {
+  const d = new Date(ms);
+  const pad = (n, width = 2) => String(n).padStart(width, '0');
+  return `${d.getFullYear()}-${pad(d.getMonth() + 1)}-${pad(d.getDate())} ` +
+    `${pad(d.getHours())}:${pad(d.getMinutes())}:${pad(d.getSeconds())}.${pad(d.getMilliseconds(), 3)}`;
+}
+
+function toLocalInput(ms) {
+  return ms ? formatTime(ms).slice(0, 19).replace(' ', 'T') : '';
+}
+
+function formatCount(n) {
+  return Number(n || 0).toLocaleString();
+}
+
+// valueLink renders a field value that adds a filter when clicked.
+function valueLink(field, value, className) {
+  const link = el('a', 'value' + (className ? ' ' + className : ''), value);
+  link.href = '#';
+  link.title = `Filter on ${field} ${value}`;
+  link.addEventListener('click', (e) => {
+    e.preventDefault();
+    e.stopPropagation();
+    addFilter(field, value);
+  });
+  return link;
+}
+
+function eventRow(event) {
+  const row = el('tr', 'event');
+  const time = el('td', 'time', formatTime(event.event_time_ms));
+  const level = el('td', 'level');
+  level.append(valueLink('level', event.level, 'level-' + event.level));
+  const service = el('td');
+  service.append(valueLink('service', event.service));
+  const host = el('td');
+  if (event.host) host.append(valueLink('host', event.host));
+  const message = el('td', 'message', event.message);
+  if (event.repeat_count > 1) message.append(el('span', 'level-TRACE', ` ×${event.repeat_count}`));
+  row.append(time, level, service, host, message);
+
+  row.addEventListener('click', () => {
+    const next = row.nextElementSibling;
+    if (next && next.classList.contains('details')) {
+      next.remove();
+    } else {
+      row.after(detailsRow(event));
+    }
+  });
+  return row;
+}
+
+function detailsRow(event) {
+  const row = el('tr', 'details');
+  const cell = el('td');
+  cell.colSpan = 5;
+  const list = el('dl');
+
+  const add = (name, value, field) => {
+    if (value === undefined || value === null || value === '' || value === 0) return;
+    list.append(el('dt', '', name));
+    const dd = el('dd');
+    if (field) {
+      dd.append(valueLink(field, String(value)));
+    } else {
+      dd.textContent = String(value);
+    }
+    list.append(dd);
+  };
+
+  add('time', new Date(event.event_time_ms).toISOString());
+  add('service', event.service, 'service');
+  add('level', event.level, 'level');
+  add('severity_number', event.severity_number);
+  add('host', event.host, 'host');
+  add('message', event.message);
+  add('request_id', event.request_id, 'request_id');
+  add('trace_id', event.trace_id, 'trace_id');
+  add('span_id', event.span_id);
+  add('trace_flags', event.trace_flags);
+  add('sample_rate', event.sample_rate);
+  add('repeat_count', event.repeat_count);
+  if (event.first_seen_ms) add('first_seen', new Date(event.first_seen_ms).toISOString());
+  if (event.last_seen_ms) add('last_seen', new Date(event.last_seen_ms).toISOString());
+  for (const name of Object.keys(event.attributes || {}).sort()) {
+    add('attributes.' + name, event.attributes[name]);
+  }
+
+  cell.append(list);
+  row.append(cell);
+  return row;
+}
+
+function clearEvents() {
+  $('events').tBodies[0].replaceChildren();
+}
+
+function appendEvents(events) {
+  $('events').tBodies[0].append(...events.map(eventRow));
+}
+
+function prependEvents(events) {
+  const rows = events.map((event) => {
+    const row = eventRow(event);
+    row.classList.add('new');
+    return row;
+  });
+  $('events').tBodies[0].prepend(...rows);
+}
+
+function renderPages(response) {
+  const from = response.total ? response.from : 0;
+  let info = `${formatCount(from)}–${formatCount(response.to)} of ${formatCount(response.total)}`;
+  if (response.estimated_total && response.estimated_total !== response.total) {
+    info += ` (≈${formatCount(response.estimated_total)} logged)`;
+  }
+  $('page-info').textContent = info;
+  $('prev').disabled = state.page <= 1;
+  $('next').disabled = state.page >= (response.last_page || 1);
+}
+
+function renderHistogram(histogram) {
+  const container = $('histogram');
+  const interval = histogram.interval_ms;
+  const buckets = histogram.buckets || [];
+  if (!interval) {
+    container.replaceChildren();
+    return;
+  }
+
+  // Buckets are aligned on multiples of the interval, and empty buckets are
+  // omitted by the API.
+  const first = Math.floor(histogram.start_time / interval) * interval;
+  const count = Math.max(1, Math.ceil((histogram.end_time - first + 1) / interval));
+  const largest = Math.max(1, ...buckets.map((b) => b.count));
+
+  const ns = 'http://www.w3.org/2000/svg';
+  const svg = document.createElementNS(ns, 'svg');
+  svg.setAttribute('viewBox', `0 0 ${count} 100`);
+  svg.setAttribute('preserveAspectRatio', 'none');
+  for (const bucket of buckets) {
+    const index = Math.round((bucket.time_ms - first) / interval);
+    const height = Math.max(1, (bucket.count / largest) * 100);
+    const rect = document.createElementNS(ns, 'rect');
+    rect.setAttribute('x', index + 0.05);
+    rect.setAttribute('width', 0.9);
+    rect.setAttribute('y', 100 - height);
+    rect.setAttribute('height', height);
+    const title = document.createElementNS(ns, 'title');
+    title.textContent = `${formatTime(bucket.time_ms)}: ${formatCount(bucket.count)} events` +
+      (bucket.estimated_count !== bucket.count ? ` (≈${formatCount(bucket.estimated_count)} logged)` : '');
+    rect.append(title);
+    rect.addEventListener('click', () => {
+      state.range = 'custom';
+      state.from = bucket.time_ms;
+      state.to = bucket.time_ms + interval - 1;
+      state.page = 1;
+      state.live = false;
+      update();
+    });
+    svg.append(rect);
+  }
+  container.replaceChildren(svg);
+}
+
+function renderFacets(facets) {
+  const aside = $('facets');
+  aside.replaceChildren();
+  for (const field of FACET_FIELDS) {
+    const values = facets[field];
+    if (!values || !values.length) continue;
+    aside.append(el('h2', '', field));
+    const list = el('ul');
+    for (const value of values) {
+      const item = el('li');
+      // Empty values cannot be filtered on.
+      const label = value.value ?
+        valueLink(field, value.value, field === 'level' ? 'level-' + value.value : '') :
+        el('span', 'count', '(empty)');
+      item.append(label, el('span', 'count', formatCount(value.count)));
+      list.append(item);
+    }
+    aside.append(list);
+  }
+}
+
+function renderFilters() {
+  const container = $('filters');
+  container.replaceChildren();
+  for (const [field, value] of Object.entries(state.filters)) {
+    const chip = el('span', 'chip', `${field}: ${value}`);
+    const remove = el('button', '', '×');
+    remove.type = 'button';
+    remove.title = `Remove ${field} filter`;
+    remove.addEventListener('click', () => {
+      delete state.filters[field];
+      state.page = 1;
+      update();
+    });
+    chip.append(remove);
+    container.append(chip);
+  }
+}
+
+// --- Form ---
+
+function syncForm() {
+  $('q').value = state.q;
+  const level = $('level');
+  if (state.level && ![...level.options].some((o) => o.value === state.level)) {
+    level.append(new Option(state.level, state.level));
+  }
+  level.value = state.level;
+  $('range').value = state.range;
+  $('custom-range').hidden = state.range !== 'custom';
+  $('from').value = toLocalInput(state.from);
+  $('to').value = toLocalInput(state.to);
+  $('live').setAttribute('aria-pressed', String(state.live));
+  renderFilters();
+}
+
+// update records the state in the URL and runs it.
+function update() {
+  writeURL(true);
+  syncForm();
+  run();
+}
+
+function addFilter(field, value) {
+  if (field === 'level') {
+    state.level = value;
+  } else {
+    state.filters[field] = value;
+  }
+  state.page = 1;
+  update();
+}
+
+function readForm() {
+  state.q = $('q').value.trim();
+  state.level = $('level').value;
+  state.range = $('range').value;
+  if (state.range === 'custom') {
+    state.from = $('from').value ? new Date($('from').value).getTime() : 0;
+    state.to = $('to').value ? new Date($('to').value).getTime() : 0;
+  } else {
+    state.from = 0;
+    state.to = 0;
+  }
+  state.page = 1;
+}
+
+function init() {
+  $('search').addEventListener('submit', (e) => {
+    e.preventDefault();
+    readForm();
+    update();
+  });
+  $('level').addEventListener('change', () => {
+    readForm();
+    update();
+  });
+  $('range').addEventListener('change', () => {
+    if ($('range').value === 'custom') {
+      // Start from the range shown so far.
+      const { start, end } = timeRange();
+      state.range = 'custom';
+      state.from = start;
+      state.to = end;
+      state.live = false;
+      syncForm();
+      return;
+    }
+    readForm();
+    update();
+  });
+  $('live').addEventListener('click', () => {
+    readForm();
+    state.live = !state.live;
+    if (state.live && state.range === 'custom') {
+      state.range = LIVE_RANGE;
+      state.from = 0;
+      state.to = 0;
+    }
+    update();
+  });
+  $('prev').addEventListener('click', () => {
+    state.page = Math.max(1, state.page - 1);
+    update();
+    window.scrollTo(0, 0);
+  });
+  $('next').addEventListener('click', () => {
+    state.page++;
+    update();
+    window.scrollTo(0, 0);
+  });
+  window.addEventListener('popstate', () => {
+    readURL();
+    syncForm();
+    run();
+  });
+
+  readURL();
+  syncForm();
+  run();
+}
+
+fetch('config.json')
+  .then((response) => response.json())
+  .then((config) => {
+    endpoint = config.events_endpoint || endpoint;
+  })
+  .catch(() => {})
+  .finally(init);
@@ -0,0 +1,48 @@
+// Package ui serves the web UI for searching and tailing events. The UI is a
+// single page built on the query API, embedded in the binary.
+package ui
+
+import (
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+)
+
+// Prefix is the path the UI is served below.
+const Prefix = "/ui/"
+
+//go:embed static
+var static embed.FS
+
+// config is served to the UI as config.json, so that it follows the
+// configured events endpoint.
+type config struct {
+	EventsEndpoint string `json:"events_endpoint"`
+}
+
+// Handler serves the UI below Prefix. eventsEndpoint is the path of the
+// events query API, such as /events.
+func Handler(eventsEndpoint string) http.Handler {
+	assets, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+Prefix+"config.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		json.NewEncoder(w).Encode(config{EventsEndpoint: eventsEndpoint})
+	})
+	mux.Handle("GET "+Prefix, http.StripPrefix(Prefix, http.FileServerFS(assets)))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Assets are served from the same origin as the API and run no
+		// inline code.
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; img-src 'self' data:")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		mux.ServeHTTP(w, r)
+	})
+}
@@ -1,13 +1,26 @@
+-- Creates the schema of a new deployment. The collector migrates the table of
+-- an existing deployment to the current columns and indexes on startup.
 CREATE DATABASE IF NOT EXISTS gologcentral;
 
 CREATE TABLE IF NOT EXISTS gologcentral.logs (
     EventTimeMs UInt64,
     Timestamp   DateTime MATERIALIZED toDateTime(EventTimeMs / 1000),
     Service     String,
-    Level       Enum8('DEBUG'=1, 'INFO'=2, 'WARN'=3, 'ERROR'=4),
+    Level       Enum8('TRACE'=1, 'DEBUG'=5, 'INFO'=9, 'WARN'=13, 'ERROR'=17, 'FATAL'=21),
+    SeverityNumber UInt8 DEFAULT multiIf(Level = 'TRACE', 1, Level = 'DEBUG', 5, Level = 'INFO', 9, Level = 'WARN', 13, Level = 'ERROR', 17, Level = 'FATAL', 21, 0),
     Message     String,
     Host        String,
-    RequestID   UUID
+    RequestID   UUID,
+    TraceID     String,
+    SpanID      String,
+    TraceFlags  UInt8,
+    SampleRate  UInt32 DEFAULT 1,
+    RepeatCount UInt32 DEFAULT 1,
+    FirstSeenMs UInt64,
+    LastSeenMs  UInt64,
+    Attributes  Map(String, String),
+    INDEX idx_trace_id TraceID TYPE bloom_filter(0.01) GRANULARITY 4,
+    INDEX idx_span_id SpanID TYPE bloom_filter(0.01) GRANULARITY 4
 ) ENGINE = MergeTree
 PARTITION BY toYYYYMMDD(Timestamp)
 ORDER BY (Service, Level, Timestamp)